@@ -0,0 +1,119 @@
+// Package assets watches asset files so they can be reloaded while the game
+// runs.
+package assets
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Watcher polls files for changes to their size or modification time. A
+// change is reported once the file has stayed the same for a whole poll, so
+// files are not picked up halfway through being written.
+type Watcher struct {
+	mu      sync.Mutex
+	files   map[string]stamp // as last reported
+	pending map[string]stamp // changed, waiting to settle
+	changed map[string]bool  // settled, not yet returned by Changed
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type stamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func stat(path string) stamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return stamp{}
+	}
+	return stamp{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// NewWatcher starts polling every interval.
+func NewWatcher(interval time.Duration) *Watcher {
+	w := &Watcher{
+		files:   make(map[string]stamp),
+		pending: make(map[string]stamp),
+		changed: make(map[string]bool),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.poll(interval)
+	return w
+}
+
+// Add watches path, which need not exist yet.
+func (w *Watcher) Add(path string) {
+	s := stat(path)
+	w.mu.Lock()
+	w.files[path] = s
+	w.mu.Unlock()
+}
+
+func (w *Watcher) poll(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		w.mu.Lock()
+		paths := make([]string, 0, len(w.files))
+		for path := range w.files {
+			paths = append(paths, path)
+		}
+		w.mu.Unlock()
+
+		for _, path := range paths {
+			s := stat(path)
+			w.mu.Lock()
+			pending, waiting := w.pending[path]
+			switch {
+			case waiting && s == pending:
+				delete(w.pending, path)
+				w.files[path] = s
+				if s.exists {
+					w.changed[path] = true
+				}
+			case s != w.files[path]:
+				w.pending[path] = s
+			default:
+				delete(w.pending, path)
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// Changed returns the watched files that changed since the last call, in
+// path order. Deleted files are not reported until they are created again.
+func (w *Watcher) Changed() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.changed) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(w.changed))
+	for path := range w.changed {
+		paths = append(paths, path)
+	}
+	clear(w.changed)
+	sort.Strings(paths)
+	return paths
+}
+
+// Close stops polling.
+func (w *Watcher) Close() {
+	close(w.stop)
+	<-w.done
+}
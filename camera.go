@@ -6,3 +6,8 @@ type Camera struct {
 	Position glm.Vec3 // Camera position
 	Rotation glm.Quat // Camera rotation
 }
+
+// NewCamera returns a camera at the origin looking down -Z.
+func NewCamera() Camera {
+	return Camera{Rotation: glm.QuatLookAtV(&glm.Vec3{}, &glm.Vec3{0, 0, -1}, &glm.Vec3{0, 1, 0})}
+}
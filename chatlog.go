@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"wgpu_server/chat"
+	"wgpu_server/ws"
+)
+
+// chatLogSize is how many received lines the chat log keeps.
+const chatLogSize = 100
+
+// ChatLog holds received chat lines and the line being typed. While it is
+// open, keystrokes go to the input instead of moving the camera.
+type ChatLog struct {
+	mu    sync.Mutex
+	lines []string
+	input []rune
+	open  bool
+}
+
+func (c *ChatLog) Open() {
+	c.mu.Lock()
+	c.open = true
+	c.input = c.input[:0]
+	c.mu.Unlock()
+}
+
+func (c *ChatLog) Close() {
+	c.mu.Lock()
+	c.open = false
+	c.input = c.input[:0]
+	c.mu.Unlock()
+}
+
+func (c *ChatLog) IsOpen() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.open
+}
+
+// Type appends r to the input if the chat is open.
+func (c *ChatLog) Type(r rune) {
+	c.mu.Lock()
+	if c.open && len(c.input) < chat.MaxLength {
+		c.input = append(c.input, r)
+	}
+	c.mu.Unlock()
+}
+
+func (c *ChatLog) Backspace() {
+	c.mu.Lock()
+	if len(c.input) > 0 {
+		c.input = c.input[:len(c.input)-1]
+	}
+	c.mu.Unlock()
+}
+
+// Input returns the line being typed.
+func (c *ChatLog) Input() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return string(c.input)
+}
+
+// Submit closes the chat and returns the typed line as a chat message, or
+// nil if nothing was typed.
+func (c *ChatLog) Submit() []byte {
+	c.mu.Lock()
+	input := string(c.input)
+	c.open = false
+	c.input = c.input[:0]
+	c.mu.Unlock()
+	if input == "" {
+		return nil
+	}
+	return append([]byte{ws.MessageChat}, input...)
+}
+
+// Receive adds a chat line sent by the server to the log.
+func (c *ChatLog) Receive(message []byte) {
+	kind, from, text, err := chat.Decode(message)
+	if err != nil {
+		slog.Warn("invalid chat message", "err", err)
+		return
+	}
+	var line string
+	switch kind {
+	case chat.Global:
+		line = fmt.Sprintf("[%d] %s", from, text)
+	case chat.Room:
+		line = fmt.Sprintf("[room][%d] %s", from, text)
+	case chat.Whisper:
+		line = fmt.Sprintf("[whisper][%d] %s", from, text)
+	case chat.System:
+		line = fmt.Sprintf("[server] %s", text)
+	}
+	slog.Info("chat", "line", line)
+
+	c.mu.Lock()
+	c.lines = append(c.lines, line)
+	if len(c.lines) > chatLogSize {
+		c.lines = c.lines[len(c.lines)-chatLogSize:]
+	}
+	c.mu.Unlock()
+}
+
+// Lines returns the received lines, oldest first.
+func (c *ChatLog) Lines() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.lines...)
+}
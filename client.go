@@ -3,36 +3,100 @@ package main
 import (
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"wgpu_server/logging"
+	"wgpu_server/replay"
+	"wgpu_server/ws"
 
 	"github.com/gorilla/websocket"
 )
 
 var addr = flag.String("addr", "localhost:8080", "http service address")
+var compress = flag.Bool("compress", false, "deflate large messages sent to the server")
+var name = flag.String("name", defaultName(), "identity the server saves your player under, used by one client at a time")
+var replayPath = flag.String("replay", "", "play back this replay file instead of connecting to a server")
+var replayClient = flag.Int("replay-client", -1, "when replaying, also show messages sent only to this client")
+var netRate = flag.Int("net-rate", 60, "network ticks per second at which batched messages are flushed, 0 sends immediately")
+
+// netConditions are applied to the client's connection after the handshake.
+var netConditions ws.Conditions
+
+var logOptions logging.Options
+
+func init() {
+	netConditions.RegisterFlags(flag.CommandLine)
+	logOptions.RegisterFlags(flag.CommandLine)
+}
+
+// defaultName is the user's login name, if it is a valid identity.
+func defaultName() string {
+	if _, err := ws.DecodeHello([]byte(os.Getenv("USER"))); err == nil {
+		return os.Getenv("USER")
+	}
+	return "player"
+}
+
+// writeErrors limits how often failed sends are logged.
+var writeErrors = logging.Every(time.Second)
 
 type message struct {
 	data string
 }
 
 type Client struct {
-	conn *websocket.Conn
-	id   int
+	conn  ws.Conn
+	codec *ws.Codec
+	id    int
+	mu    sync.Mutex
+	state []byte
+	ack   uint64
 }
 
 func (c *Client) Send(msg []byte) {
 	err := c.conn.WriteMessage(websocket.TextMessage, msg)
 	if err != nil {
-		log.Println("write:", err)
+		if ok, suppressed := writeErrors.Allow(); ok {
+			slog.Warn("write failed", "client", c.id, "err", err, "suppressed", suppressed)
+		}
+		return
+	}
+}
+
+// SendState replaces the state sent on the next network tick, so only the
+// latest state is sent however often it is called. Without a network tick
+// the state is sent immediately.
+func (c *Client) SendState(msg []byte) {
+	if *netRate <= 0 {
+		c.Send(msg)
+		return
+	}
+	c.mu.Lock()
+	c.state = msg
+	c.mu.Unlock()
+}
+
+// Ack acknowledges the latest snapshot received, letting the server estimate
+// the round trip time. Like SendState it is sent on the next network tick.
+func (c *Client) Ack(tick uint64) {
+	if *netRate <= 0 {
+		c.Send(ws.EncodeAck(tick))
 		return
 	}
+	c.mu.Lock()
+	c.ack = tick
+	c.mu.Unlock()
 }
 
 func (c *Client) Recv(f func([]byte)) {
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
-			log.Println("read:", err)
+			slog.Warn("connection closed", "client", c.id, "err", err)
 			return
 		}
 		f(message)
@@ -41,27 +105,20 @@ func (c *Client) Recv(f func([]byte)) {
 	}
 }
 func (c *Client) init() {
-	flag.Parse()
-	log.SetFlags(0)
-
 	// interrupt := make(chan os.Signal, 1)
 	// signal.Notify(interrupt, os.Interrupt)
 
 	u := url.URL{Scheme: "ws", Host: *addr, Path: "/echo"}
-	log.Printf("connecting to %s", u.String())
+	slog.Info("connecting", "url", u.String())
 
 	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
 	if err != nil {
-		log.Fatal("dial:", err)
+		slog.Error("dial failed", "url", u.String(), "err", err)
+		os.Exit(1)
 	}
 	c.conn = conn
-	_, message, err := c.conn.ReadMessage()
-	if err != nil {
-		log.Println("read:", err)
-		return
-	}
-	fmt.Sscanf(string(message), "%d", &c.id)
-	println(c.id)
+	c.handshake()
+	c.wrap()
 
 	// defer c.Close()
 
@@ -110,3 +167,72 @@ func (c *Client) init() {
 	// 	}
 	// }
 }
+
+// initLocal connects the client to a server running in the same process
+// through an in-memory pipe instead of a socket.
+func (c *Client) initLocal(server *ws.Server) {
+	conn, remote := ws.Pipe()
+	go server.Serve(remote)
+	c.conn = conn
+	c.handshake()
+	c.wrap()
+}
+
+// initReplay plays back a recorded session through the client's connection,
+// so Recv sees the recorded messages. Nothing sent is delivered anywhere.
+func (c *Client) initReplay(player *replay.Player) {
+	c.conn = player
+	c.id = *replayClient
+}
+
+// handshake reads the id the server assigns to a new connection.
+func (c *Client) handshake() {
+	_, message, err := c.conn.ReadMessage()
+	if err != nil {
+		slog.Error("handshake failed", "err", err)
+		return
+	}
+	fmt.Sscanf(string(message), "%d", &c.id)
+	slog.Info("connected", "client", c.id)
+}
+
+// wrap layers network simulation and message framing over the connection
+// once the handshake is done.
+func (c *Client) wrap() {
+	if netConditions.Enabled() {
+		c.conn = ws.Simulate(c.conn, netConditions)
+	}
+	c.codec = ws.NewCodec(c.conn, ws.CodecOptions{
+		Compress:          *compress,
+		CompressThreshold: 256,
+		Batch:             *netRate > 0,
+	}, nil)
+	c.conn = c.codec
+	c.Send(ws.EncodeHello(*name))
+	if *netRate > 0 {
+		go c.flush(time.Second / time.Duration(*netRate))
+	}
+}
+
+// flush sends the latest state and any batched messages once per network
+// tick.
+func (c *Client) flush(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.mu.Lock()
+		state, ack := c.state, c.ack
+		c.state, c.ack = nil, 0
+		c.mu.Unlock()
+		if state != nil {
+			c.Send(state)
+		}
+		if ack != 0 {
+			c.Send(ws.EncodeAck(ack))
+		}
+		if err := c.codec.Flush(); err != nil {
+			slog.Warn("flush failed, stopping network tick", "client", c.id, "err", err)
+			return
+		}
+	}
+}
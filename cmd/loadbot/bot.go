@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+	"wgpu_server/ws"
+
+	"github.com/EngoEngine/glm"
+	"github.com/gorilla/websocket"
+)
+
+// sentHistory is how many sent states a bot remembers to match against the
+// snapshots echoing them back.
+const sentHistory = 64
+
+type sent struct {
+	position glm.Vec3
+	at       time.Time
+}
+
+// bot is one simulated player speaking the same protocol as the game
+// client: a text id handshake, a codec, a hello, then a state and an ack
+// every send tick.
+type bot struct {
+	index int
+	id    int
+	conn  ws.Conn
+	codec *ws.Codec
+	stats *Stats
+	rng   *rand.Rand
+
+	mu       sync.Mutex
+	data     ws.PlayerData
+	velocity glm.Vec3
+	sent     [sentHistory]sent
+	next     int
+	last     glm.Vec3 // position of the latest state sent
+	ack      uint64
+}
+
+func newBot(index int, stats *Stats) *bot {
+	b := &bot{
+		index: index,
+		stats: stats,
+		rng:   rand.New(rand.NewSource(int64(index))),
+	}
+	b.data = ws.PlayerData{
+		Position: glm.Vec3{b.rng.Float32()*200 - 100, 0, b.rng.Float32()*200 - 100},
+		Rotation: glm.QuatIdent(),
+	}
+	return b
+}
+
+// connect dials the server and performs the handshake.
+func (b *bot) connect(addr string) error {
+	u := url.URL{Scheme: "ws", Host: addr, Path: "/echo"}
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		return err
+	}
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	fmt.Sscanf(string(message), "%d", &b.id)
+	b.conn = conn
+	if conditions.Enabled() {
+		b.conn = ws.Simulate(b.conn, conditions)
+	}
+	b.codec = ws.NewCodec(b.conn, ws.CodecOptions{
+		Compress:          *compress,
+		CompressThreshold: 256,
+		Batch:             true,
+	}, &b.stats.Wire)
+	return b.codec.WriteMessage(websocket.BinaryMessage, ws.EncodeHello(fmt.Sprintf("%s%d", *prefix, b.index)))
+}
+
+// run sends the bot's state every interval and reads snapshots until done is
+// closed or the connection drops.
+func (b *bot) run(interval time.Duration, done <-chan struct{}) {
+	b.stats.Connected.Add(1)
+	defer b.stats.Connected.Add(-1)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		b.read()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		select {
+		case <-done:
+			b.codec.Close()
+			<-closed
+			return
+		case <-closed:
+			b.stats.Disconnects.Add(1)
+			slog.Warn("bot disconnected", "bot", b.index, "client", b.id)
+			return
+		case now := <-ticker.C:
+			if err := b.send(now, now.Sub(start).Seconds(), interval.Seconds()); err != nil {
+				b.codec.Close()
+			}
+		}
+	}
+}
+
+func (b *bot) send(now time.Time, t, dt float64) error {
+	b.mu.Lock()
+	b.move(t, dt)
+	data, ack := b.data, b.ack
+	b.ack = 0
+	// Only states that moved can be told apart when they come back.
+	if b.next == 0 || data.Position != b.last {
+		b.sent[b.next%sentHistory] = sent{data.Position, now}
+		b.next++
+		b.last = data.Position
+	}
+	b.mu.Unlock()
+
+	if err := b.codec.WriteMessage(websocket.BinaryMessage, ws.EncodePlayerData(data)); err != nil {
+		return err
+	}
+	b.stats.States.Add(1)
+	if ack != 0 {
+		if err := b.codec.WriteMessage(websocket.BinaryMessage, ws.EncodeAck(ack)); err != nil {
+			return err
+		}
+	}
+	return b.codec.Flush()
+}
+
+// move advances the bot along its script.
+func (b *bot) move(t, dt float64) {
+	switch *script {
+	case "circle":
+		angle := t*0.5 + float64(b.index)
+		radius := 20 + float64(b.index%50)
+		b.data.Position[0] = float32(radius * math.Cos(angle))
+		b.data.Position[2] = float32(radius * math.Sin(angle))
+		b.data.Rotation = glm.QuatRotate(float32(-angle), &glm.Vec3{0, 1, 0})
+	case "random":
+		if b.rng.Float64() < dt {
+			b.velocity = glm.Vec3{b.rng.Float32()*20 - 10, b.rng.Float32()*4 - 2, b.rng.Float32()*20 - 10}
+			yaw := float32(math.Atan2(float64(b.velocity[0]), float64(b.velocity[2])))
+			b.data.Rotation = glm.QuatRotate(yaw, &glm.Vec3{0, 1, 0})
+		}
+		for i := range b.data.Position {
+			b.data.Position[i] += b.velocity[i] * float32(dt)
+			b.data.Position[i] = max(-1000, min(b.data.Position[i], 1000))
+		}
+	}
+}
+
+// read handles messages from the server until the connection closes.
+func (b *bot) read() {
+	for {
+		_, message, err := b.codec.ReadMessage()
+		if err != nil {
+			return
+		}
+		b.stats.Received.Add(1)
+		if len(message) == 0 {
+			continue
+		}
+		switch message[0] {
+		case ws.ServerSnapshot:
+			b.snapshot(message)
+		case ws.ServerTeleport:
+			if position, err := ws.DecodeTeleport(message); err == nil {
+				b.mu.Lock()
+				b.data.Position = position
+				b.mu.Unlock()
+			}
+		}
+	}
+}
+
+// snapshot acks the snapshot and, when it echoes a state the bot sent,
+// records how long the round trip through the server took.
+func (b *bot) snapshot(message []byte) {
+	tick, messages, err := ws.DecodeSnapshot(message)
+	if err != nil {
+		b.stats.InvalidSnapshot(err)
+		return
+	}
+	b.stats.Snapshots.Add(1)
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ack = tick
+	for _, m := range messages {
+		if m.Client != b.id {
+			continue
+		}
+		for i := range b.sent {
+			if b.sent[i].at.IsZero() || b.sent[i].position != m.Data.Position {
+				continue
+			}
+			b.stats.Latency(now.Sub(b.sent[i].at))
+			// Older states were superseded on the server.
+			at := b.sent[i].at
+			for j := range b.sent {
+				if !b.sent[j].at.After(at) {
+					b.sent[j] = sent{}
+				}
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Command loadbot load tests a server with simulated players speaking the
+// game client's protocol, reporting latency, throughput and disconnects as
+// seen by the bots and by the server's /metrics.
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+	"wgpu_server/logging"
+	"wgpu_server/ws"
+)
+
+var addr = flag.String("addr", "localhost:8080", "http service address of the server")
+var bots = flag.Int("bots", 10, "number of simulated players")
+var rate = flag.Int("rate", 60, "states each bot sends per second")
+var script = flag.String("script", "random", "bot movement: random, circle or still")
+var ramp = flag.Duration("ramp", 5*time.Second, "time over which the bots connect")
+var duration = flag.Duration("duration", time.Minute, "how long to run once every bot has been started, 0 to run until interrupted")
+var interval = flag.Duration("report", 5*time.Second, "how often to report")
+var compress = flag.Bool("compress", false, "deflate large messages sent to the server")
+var prefix = flag.String("prefix", "bot-", "identity prefix bots log in with")
+
+// conditions are applied to every bot's connection.
+var conditions ws.Conditions
+
+var logOptions logging.Options
+
+func main() {
+	conditions.RegisterFlags(flag.CommandLine)
+	logOptions.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := logOptions.Setup(os.Stderr); err != nil {
+		slog.Error("invalid logging options", "err", err)
+		os.Exit(2)
+	}
+	switch *script {
+	case "random", "circle", "still":
+	default:
+		slog.Error("unknown script", "script", *script)
+		os.Exit(2)
+	}
+	if *bots <= 0 || *rate <= 0 {
+		slog.Error("-bots and -rate must be positive")
+		os.Exit(2)
+	}
+
+	stats := &Stats{}
+	start, _ := scrape(*addr)
+	first := stats.counters(start)
+	last := first
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	slog.Info("starting bots", "addr", *addr, "bots", *bots, "rate", *rate, "script", *script, "ramp", *ramp)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		spawn := time.NewTicker(max(*ramp/time.Duration(*bots), time.Microsecond))
+		defer spawn.Stop()
+		for i := range *bots {
+			select {
+			case <-done:
+				return
+			case <-spawn.C:
+			}
+			b := newBot(i, stats)
+			if err := b.connect(*addr); err != nil {
+				stats.DialErrors.Add(1)
+				slog.Warn("bot could not connect", "bot", i, "err", err)
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b.run(time.Second/time.Duration(*rate), done)
+			}()
+		}
+	}()
+
+	var end <-chan time.Time
+	if *duration > 0 {
+		end = time.After(*ramp + *duration)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			last = stats.report("load", last, false)
+		case <-end:
+			break loop
+		case <-signals:
+			break loop
+		}
+	}
+
+	stats.report("summary", first, true)
+	close(done)
+	wg.Wait()
+}
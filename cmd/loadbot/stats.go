@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wgpu_server/logging"
+	"wgpu_server/ws"
+)
+
+// Stats counts the activity of every bot.
+type Stats struct {
+	Wire        ws.CodecStats
+	Connected   atomic.Int64
+	Disconnects atomic.Int64 // connections dropped before the test ended
+	DialErrors  atomic.Int64
+	States      atomic.Int64 // states sent
+	Received    atomic.Int64 // messages received
+	Snapshots   atomic.Int64
+	Invalid     atomic.Int64 // snapshots that failed to decode
+
+	mu         sync.Mutex
+	latency    []time.Duration
+	reported   int   // latencies already reported
+	invalidErr error // why the latest invalid snapshot failed to decode
+}
+
+// InvalidSnapshot counts a snapshot that failed to decode with err.
+func (s *Stats) InvalidSnapshot(err error) {
+	s.Invalid.Add(1)
+	s.mu.Lock()
+	s.invalidErr = err
+	s.mu.Unlock()
+}
+
+// Latency records the time between sending a state and seeing it in a
+// snapshot.
+func (s *Stats) Latency(d time.Duration) {
+	s.mu.Lock()
+	s.latency = append(s.latency, d)
+	s.mu.Unlock()
+}
+
+// takeLatency returns the latencies recorded since the last call, or all of
+// them, sorted.
+func (s *Stats) takeLatency(all bool) []time.Duration {
+	s.mu.Lock()
+	latency := s.latency[s.reported:]
+	if all {
+		latency = s.latency
+	}
+	latency = slices.Clone(latency)
+	s.reported = len(s.latency)
+	s.mu.Unlock()
+	slices.Sort(latency)
+	return latency
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[min(len(sorted)-1, int(p*float64(len(sorted))))]
+}
+
+// counters is a snapshot of the totals in Stats, to report rates between
+// two snapshots.
+type counters struct {
+	at                 time.Time
+	states, received   int64
+	snapshots, invalid int64
+	wireOut, wireIn    int64
+	tickSum, tickCount float64
+}
+
+func (s *Stats) counters(server serverMetrics) counters {
+	return counters{
+		at:        time.Now(),
+		states:    s.States.Load(),
+		received:  s.Received.Load(),
+		snapshots: s.Snapshots.Load(),
+		invalid:   s.Invalid.Load(),
+		wireOut:   s.Wire.WireOut.Load(),
+		wireIn:    s.Wire.WireIn.Load(),
+		tickSum:   server.values["ws_tick_duration_seconds_sum"],
+		tickCount: server.values["ws_tick_duration_seconds_count"],
+	}
+}
+
+// serverMetrics holds the samples scraped from the server's /metrics.
+type serverMetrics struct {
+	values map[string]float64 // unlabelled samples by name
+	rtt    []float64          // ws_client_rtt_seconds of every client
+}
+
+// scrape reads the server's metrics. Servers without the endpoint yield
+// empty metrics.
+func scrape(addr string) (serverMetrics, error) {
+	m := serverMetrics{values: make(map[string]float64)}
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		return m, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return m, fmt.Errorf("metrics: %s", resp.Status)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		name, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(name, "ws_client_rtt_seconds{") {
+			m.rtt = append(m.rtt, v)
+		} else if !strings.Contains(name, "{") {
+			m.values[name] = v
+		}
+	}
+	return m, scanner.Err()
+}
+
+// scrapeErrors limits how often failing to read the server's metrics is
+// logged.
+var scrapeErrors = logging.Every(time.Minute)
+
+// report logs the rates since last and returns the new totals. The summary
+// covers latencies since the start rather than since last.
+func (s *Stats) report(msg string, last counters, summary bool) counters {
+	server, err := scrape(*addr)
+	if err != nil {
+		if ok, _ := scrapeErrors.Allow(); ok {
+			slog.Warn("could not read server metrics", "err", err)
+		}
+	}
+	now := s.counters(server)
+	elapsed := now.at.Sub(last.at).Seconds()
+	rate := func(a, b int64) float64 {
+		return float64(a-b) / elapsed
+	}
+	latency := s.takeLatency(summary)
+	args := []any{
+		"bots", s.Connected.Load(),
+		"disconnects", s.Disconnects.Load(),
+		"dial_errors", s.DialErrors.Load(),
+		"states_per_second", rate(now.states, last.states),
+		"received_per_second", rate(now.received, last.received),
+		"snapshots_per_second", rate(now.snapshots, last.snapshots),
+		"bytes_out_per_second", rate(now.wireOut, last.wireOut),
+		"bytes_in_per_second", rate(now.wireIn, last.wireIn),
+		"invalid_snapshots", s.Invalid.Load(),
+		"latency_samples", len(latency),
+		"latency_p50", percentile(latency, 0.5).Round(time.Microsecond),
+		"latency_p99", percentile(latency, 0.99).Round(time.Microsecond),
+		"latency_max", percentile(latency, 1).Round(time.Microsecond),
+	}
+	if len(server.values) > 0 {
+		var mean, worst float64
+		for _, rtt := range server.rtt {
+			mean += rtt / float64(len(server.rtt))
+			worst = max(worst, rtt)
+		}
+		args = append(args,
+			"server_clients", server.values["ws_connected_clients"],
+			"server_rtt_mean", seconds(mean),
+			"server_rtt_max", seconds(worst),
+			"server_dropped_sends", server.values["ws_dropped_sends_total"],
+			"server_rate_limited", server.values["ws_rate_limited_total"],
+		)
+		if ticks := now.tickCount - last.tickCount; ticks > 0 && last.tickCount > 0 {
+			args = append(args, "server_tick_mean", seconds((now.tickSum-last.tickSum)/ticks))
+		}
+	}
+	slog.Info(msg, args...)
+	if invalid := now.invalid - last.invalid; invalid > 0 {
+		s.mu.Lock()
+		err := s.invalidErr
+		s.mu.Unlock()
+		// Bots cannot find their states in snapshots they cannot read, so
+		// the latencies above miss them.
+		slog.Error("snapshots from the server failed to decode, latency is not measured for them", "invalid", invalid, "err", err)
+	}
+	return now
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Microsecond)
+}
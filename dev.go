@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"go_wgpu/assets"
+	"log/slog"
+	"os"
+	"time"
+)
+
+var dev = flag.Bool("dev", false, "watch the shader and scene files and reload them when they change")
+var devPoll = flag.Duration("dev-poll", 250*time.Millisecond, "dev: how often to check files for changes")
+var shaderPath = flag.String("shader", "shader.wgsl", "dev: shader file to load and watch instead of the built in one")
+
+// devAssets watches the files dev mode reloads. Reload applies their
+// changes, and is called between frames so nothing is reloaded mid-frame.
+//
+// Only the shader and the scene are watched: the engine has no texture or
+// mesh files yet. The texture is generated by createTexels and the cube mesh
+// is built in, so changing either means rebuilding the client.
+type devAssets struct {
+	watcher *assets.Watcher
+}
+
+// openDevAssets starts watching if -dev is set. The shader is only watched
+// if watchShader is set, as there is none without a window.
+func openDevAssets(watchShader bool) *devAssets {
+	d := &devAssets{}
+	if !*dev {
+		return d
+	}
+	d.watcher = assets.NewWatcher(*devPoll)
+	if watchShader {
+		d.watcher.Add(*shaderPath)
+	}
+	if *scenePath != "" {
+		d.watcher.Add(*scenePath)
+	}
+	slog.Info("dev mode: watching assets", "shader", watchShader, "scene", *scenePath, "poll", *devPoll)
+	return d
+}
+
+// Reload reloads the files that changed since the last call. reloadShader
+// is given the new shader source, and may be nil when there is nothing to
+// render.
+func (d *devAssets) Reload(session *Session, reloadShader func(code string) error) {
+	if d.watcher == nil {
+		return
+	}
+	for _, path := range d.watcher.Changed() {
+		switch path {
+		case *shaderPath:
+			if reloadShader == nil {
+				continue
+			}
+			code, err := os.ReadFile(path)
+			if err == nil {
+				err = reloadShader(string(code))
+			}
+			if err != nil {
+				slog.Error("dev mode: shader not reloaded", "path", path, "err", err)
+				continue
+			}
+			slog.Info("dev mode: reloaded shader", "path", path)
+		case *scenePath:
+			session.reloadScene()
+		}
+	}
+}
+
+func (d *devAssets) Close() {
+	if d.watcher != nil {
+		d.watcher.Close()
+	}
+}
@@ -0,0 +1,106 @@
+package ecs
+
+import "go_wgpu/jobs"
+
+// Query1 visits every entity with an A component.
+type Query1[A any] struct {
+	a *Storage[A]
+}
+
+func NewQuery1[A any](w *World) Query1[A] {
+	return Query1[A]{Components[A](w)}
+}
+
+// Each calls fn for every match. fn must not add or remove components of the
+// queried types.
+func (q Query1[A]) Each(fn func(e Entity, a *A)) {
+	for i, e := range q.a.entities {
+		fn(e, &q.a.data[i])
+	}
+}
+
+// ParallelEach calls fn for every match from the pool's workers, in chunks
+// of grain entities. fn must only modify the component it is given.
+func (q Query1[A]) ParallelEach(pool *jobs.Pool, grain int, fn func(e Entity, a *A)) {
+	pool.ParallelFor(q.a.Len(), grain, func(start, end int) {
+		for i := start; i < end; i++ {
+			fn(q.a.entities[i], &q.a.data[i])
+		}
+	})
+}
+
+func (q Query1[A]) Len() int {
+	return q.a.Len()
+}
+
+// Query2 visits every entity with both an A and a B component.
+type Query2[A, B any] struct {
+	a *Storage[A]
+	b *Storage[B]
+}
+
+func NewQuery2[A, B any](w *World) Query2[A, B] {
+	return Query2[A, B]{Components[A](w), Components[B](w)}
+}
+
+// Each calls fn for every match, walking the smaller storage. fn must not add
+// or remove components of the queried types.
+func (q Query2[A, B]) Each(fn func(e Entity, a *A, b *B)) {
+	if q.a.Len() <= q.b.Len() {
+		for i, e := range q.a.entities {
+			if b := q.b.Get(e); b != nil {
+				fn(e, &q.a.data[i], b)
+			}
+		}
+		return
+	}
+	for i, e := range q.b.entities {
+		if a := q.a.Get(e); a != nil {
+			fn(e, a, &q.b.data[i])
+		}
+	}
+}
+
+// ParallelEach calls fn for every match from the pool's workers, splitting
+// the smaller storage into chunks of grain entities. fn must only modify the
+// components it is given.
+func (q Query2[A, B]) ParallelEach(pool *jobs.Pool, grain int, fn func(e Entity, a *A, b *B)) {
+	if q.a.Len() <= q.b.Len() {
+		pool.ParallelFor(q.a.Len(), grain, func(start, end int) {
+			for i := start; i < end; i++ {
+				if b := q.b.Get(q.a.entities[i]); b != nil {
+					fn(q.a.entities[i], &q.a.data[i], b)
+				}
+			}
+		})
+		return
+	}
+	pool.ParallelFor(q.b.Len(), grain, func(start, end int) {
+		for i := start; i < end; i++ {
+			if a := q.a.Get(q.b.entities[i]); a != nil {
+				fn(q.b.entities[i], a, &q.b.data[i])
+			}
+		}
+	})
+}
+
+// Query3 visits every entity with an A, a B and a C component.
+type Query3[A, B, C any] struct {
+	a *Storage[A]
+	b *Storage[B]
+	c *Storage[C]
+}
+
+func NewQuery3[A, B, C any](w *World) Query3[A, B, C] {
+	return Query3[A, B, C]{Components[A](w), Components[B](w), Components[C](w)}
+}
+
+// Each calls fn for every match. fn must not add or remove components of the
+// queried types.
+func (q Query3[A, B, C]) Each(fn func(e Entity, a *A, b *B, c *C)) {
+	Query2[A, B]{q.a, q.b}.Each(func(e Entity, a *A, b *B) {
+		if c := q.c.Get(e); c != nil {
+			fn(e, a, b, c)
+		}
+	})
+}
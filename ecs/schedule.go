@@ -0,0 +1,135 @@
+package ecs
+
+import (
+	"fmt"
+	"go_wgpu/jobs"
+	"reflect"
+)
+
+// System updates the world by one frame of dt seconds.
+type System func(w *World, dt float64)
+
+// Access declares that a system reads or writes a component type, or a
+// resource: shared state outside the world, such as a camera, named by a
+// string.
+type Access struct {
+	typ      reflect.Type
+	resource string
+	write    bool
+}
+
+func Read[T any]() Access {
+	return Access{typ: reflect.TypeFor[T]()}
+}
+
+func Write[T any]() Access {
+	return Access{typ: reflect.TypeFor[T](), write: true}
+}
+
+func ReadResource(name string) Access {
+	return Access{resource: name}
+}
+
+func WriteResource(name string) Access {
+	return Access{resource: name, write: true}
+}
+
+func (a Access) String() string {
+	what := "resource " + a.resource
+	if a.typ != nil {
+		what = a.typ.String()
+	}
+	if a.write {
+		return "write " + what
+	}
+	return "read " + what
+}
+
+type system struct {
+	name   string
+	run    System
+	access []Access // nil for exclusive systems
+	after  []int    // earlier systems this one must wait for
+}
+
+// conflicts reports whether a and b may not run at the same time.
+func (a *system) conflicts(b *system) bool {
+	if a.access == nil || b.access == nil {
+		return true
+	}
+	for _, x := range a.access {
+		for _, y := range b.access {
+			if x.typ == y.typ && x.resource == y.resource && (x.write || y.write) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Schedule runs systems in the order they were added. With a Pool, systems
+// that do not conflict with any unfinished earlier system run concurrently.
+type Schedule struct {
+	Pool *jobs.Pool
+
+	systems []*system
+}
+
+// Add appends a system declaring what it reads and writes. A system
+// declaring nothing is exclusive: it runs alone, and may spawn and despawn
+// entities. Names must be unique.
+func (s *Schedule) Add(name string, run System, access ...Access) {
+	for _, other := range s.systems {
+		if other.name == name {
+			panic(fmt.Sprintf("ecs: system %q added twice", name))
+		}
+	}
+	added := &system{name: name, run: run, access: access}
+	for i, other := range s.systems {
+		if other.conflicts(added) {
+			added.after = append(added.after, i)
+		}
+	}
+	s.systems = append(s.systems, added)
+}
+
+// Run runs every system once. Without a Pool they run in order on the
+// calling goroutine.
+func (s *Schedule) Run(w *World, dt float64) {
+	if s.Pool == nil {
+		for _, system := range s.systems {
+			system.run(w, dt)
+		}
+		return
+	}
+
+	started := make([]*jobs.Job, len(s.systems))
+	for i, system := range s.systems {
+		after := make([]*jobs.Job, len(system.after))
+		for k, j := range system.after {
+			after[k] = started[j]
+		}
+		started[i] = s.Pool.Go(func() { system.run(w, dt) }, after...)
+	}
+	jobs.WaitAll(started...)
+}
+
+// Systems returns the names of the systems in the order they were added.
+func (s *Schedule) Systems() []string {
+	names := make([]string, len(s.systems))
+	for i, system := range s.systems {
+		names[i] = system.name
+	}
+	return names
+}
+
+// Conflicts returns, for each system, the earlier systems it waits for.
+func (s *Schedule) Conflicts() map[string][]string {
+	conflicts := make(map[string][]string)
+	for _, system := range s.systems {
+		for _, j := range system.after {
+			conflicts[system.name] = append(conflicts[system.name], s.systems[j].name)
+		}
+	}
+	return conflicts
+}
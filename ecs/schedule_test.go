@@ -0,0 +1,161 @@
+package ecs
+
+import (
+	"go_wgpu/jobs"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// events logs when systems start and end.
+type events struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (e *events) add(event string) {
+	e.mu.Lock()
+	e.log = append(e.log, event)
+	e.mu.Unlock()
+}
+
+// system returns a system logging its start and end, taking a little while
+// in between so that systems wrongly run together overlap.
+func (e *events) system(name string) System {
+	return func(*World, float64) {
+		e.add("start " + name)
+		time.Sleep(5 * time.Millisecond)
+		e.add("end " + name)
+	}
+}
+
+// before reports whether event a was logged before event b.
+func (e *events) before(a, b string) bool {
+	i, j := slices.Index(e.log, a), slices.Index(e.log, b)
+	return i >= 0 && j >= 0 && i < j
+}
+
+func TestScheduleReadsRunTogether(t *testing.T) {
+	s := Schedule{Pool: jobs.NewPool(2)}
+	var started sync.WaitGroup
+	started.Add(2)
+	together := make(chan bool, 2)
+	// Each reader waits for the other to start, which only happens if they
+	// run at the same time.
+	reader := func(*World, float64) {
+		started.Done()
+		done := make(chan struct{})
+		go func() {
+			started.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			together <- true
+		case <-time.After(time.Second):
+			together <- false
+		}
+	}
+	s.Add("a", reader, Read[position](), Read[name]())
+	s.Add("b", reader, Read[position](), ReadResource("camera"))
+	if len(s.Conflicts()) != 0 {
+		t.Fatalf("readers conflict: %v", s.Conflicts())
+	}
+	s.Run(NewWorld(), 0)
+	if !<-together || !<-together {
+		t.Error("two readers of the same component did not run together")
+	}
+}
+
+func TestScheduleWritesSerialized(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		first []Access
+		then  []Access
+	}{
+		{"read then write", []Access{Read[position]()}, []Access{Write[position](), Read[name]()}},
+		{"write then read", []Access{Write[position]()}, []Access{Read[position]()}},
+		{"write then write", []Access{Write[name]()}, []Access{Write[name]()}},
+		{"resources", []Access{ReadResource("camera")}, []Access{WriteResource("camera")}},
+	} {
+		var e events
+		s := Schedule{Pool: jobs.NewPool(4)}
+		s.Add("first", e.system("first"), test.first...)
+		s.Add("then", e.system("then"), test.then...)
+		for range 3 {
+			e.log = nil
+			s.Run(NewWorld(), 0)
+			if !e.before("end first", "start then") {
+				t.Errorf("%s: systems overlapped: %v", test.name, e.log)
+			}
+		}
+		if got := s.Conflicts()["then"]; !slices.Equal(got, []string{"first"}) {
+			t.Errorf("%s: then waits for %v, want [first]", test.name, got)
+		}
+	}
+}
+
+func TestScheduleResourcesAreNotComponents(t *testing.T) {
+	var s Schedule
+	s.Add("component", func(*World, float64) {}, Write[position]())
+	s.Add("resource", func(*World, float64) {}, WriteResource("position"), WriteResource("ecs.position"))
+	s.Add("other", func(*World, float64) {}, WriteResource("camera"))
+	if c := s.Conflicts(); len(c) != 0 {
+		t.Errorf("unrelated accesses conflict: %v", c)
+	}
+	if got, want := WriteResource("camera").String(), "write resource camera"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got, want := Read[position]().String(), "read ecs.position"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestScheduleExclusiveBarrier(t *testing.T) {
+	var e events
+	s := Schedule{Pool: jobs.NewPool(4)}
+	s.Add("a", e.system("a"), Read[position]())
+	s.Add("exclusive", e.system("exclusive"))
+	s.Add("b", e.system("b"), Read[name]())
+	s.Add("c", e.system("c"), Write[name]())
+	s.Run(NewWorld(), 0)
+	if !e.before("end a", "start exclusive") || !e.before("end exclusive", "start b") {
+		t.Errorf("the exclusive system overlapped another: %v", e.log)
+	}
+	if !e.before("end b", "start c") {
+		t.Errorf("b and c overlapped: %v", e.log)
+	}
+	want := map[string][]string{
+		"exclusive": {"a"},
+		"b":         {"exclusive"},
+		"c":         {"exclusive", "b"},
+	}
+	for system, after := range want {
+		if got := s.Conflicts()[system]; !slices.Equal(got, after) {
+			t.Errorf("%s waits for %v, want %v", system, got, after)
+		}
+	}
+}
+
+func TestScheduleWithoutPool(t *testing.T) {
+	var e events
+	var s Schedule
+	for _, name := range []string{"a", "b", "c"} {
+		s.Add(name, e.system(name), Read[position]())
+	}
+	s.Run(NewWorld(), 0)
+	want := []string{"start a", "end a", "start b", "end b", "start c", "end c"}
+	if !slices.Equal(e.log, want) {
+		t.Errorf("ran %v, want %v", e.log, want)
+	}
+	if !slices.Equal(s.Systems(), []string{"a", "b", "c"}) {
+		t.Errorf("Systems() = %v", s.Systems())
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("adding a system twice did not panic")
+		}
+	}()
+	s.Add("b", e.system("b"))
+}
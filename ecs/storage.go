@@ -0,0 +1,115 @@
+package ecs
+
+import "reflect"
+
+// Storage holds every component of type T in a sparse set.
+type Storage[T any] struct {
+	sparse   []int32 // position in dense plus one by entity index, 0 if absent
+	entities []Entity
+	data     []T
+}
+
+// Components returns the storage for components of type T, creating it on
+// first use.
+func Components[T any](w *World) *Storage[T] {
+	t := reflect.TypeFor[T]()
+	w.storagesMu.RLock()
+	s, ok := w.storages[t]
+	w.storagesMu.RUnlock()
+	if ok {
+		return s.(*Storage[T])
+	}
+	w.storagesMu.Lock()
+	defer w.storagesMu.Unlock()
+	if s, ok := w.storages[t]; ok {
+		return s.(*Storage[T])
+	}
+	created := &Storage[T]{}
+	w.storages[t] = created
+	return created
+}
+
+// Add sets the T component of e, returning a pointer to it that is valid
+// until the next component of this type is added or removed. Dead entities
+// get no component and Add returns nil.
+func Add[T any](w *World, e Entity, value T) *T {
+	if !w.Alive(e) {
+		return nil
+	}
+	return Components[T](w).set(e, value)
+}
+
+// Get returns e's T component, or nil if it has none.
+func Get[T any](w *World, e Entity) *T {
+	return Components[T](w).Get(e)
+}
+
+// Has reports whether e has a T component.
+func Has[T any](w *World, e Entity) bool {
+	return Get[T](w, e) != nil
+}
+
+// Remove removes e's T component, reporting whether it had one.
+func Remove[T any](w *World, e Entity) bool {
+	return Components[T](w).remove(e)
+}
+
+func (s *Storage[T]) set(e Entity, value T) *T {
+	if p := s.Get(e); p != nil {
+		*p = value
+		return p
+	}
+	index := int(e.index())
+	if index >= len(s.sparse) {
+		s.sparse = append(s.sparse, make([]int32, index+1-len(s.sparse))...)
+	}
+	s.entities = append(s.entities, e)
+	s.data = append(s.data, value)
+	s.sparse[index] = int32(len(s.data))
+	return &s.data[len(s.data)-1]
+}
+
+func (s *Storage[T]) Get(e Entity) *T {
+	index := int(e.index())
+	if index >= len(s.sparse) || s.sparse[index] == 0 {
+		return nil
+	}
+	i := s.sparse[index] - 1
+	if s.entities[i] != e {
+		return nil
+	}
+	return &s.data[i]
+}
+
+// remove swaps the last component into the removed one's place.
+func (s *Storage[T]) remove(e Entity) bool {
+	if s.Get(e) == nil {
+		return false
+	}
+	i := s.sparse[e.index()] - 1
+	last := int32(len(s.data) - 1)
+	moved := s.entities[last]
+	s.entities[i], s.data[i] = moved, s.data[last]
+	s.sparse[moved.index()] = i + 1
+	s.sparse[e.index()] = 0
+	var zero T
+	s.data[last] = zero
+	s.entities = s.entities[:last]
+	s.data = s.data[:last]
+	return true
+}
+
+// Len returns the number of components.
+func (s *Storage[T]) Len() int {
+	return len(s.data)
+}
+
+// Data returns the components in storage order. Entities returns their
+// owners in the same order. Both are invalidated by adds and removes.
+func (s *Storage[T]) Data() []T {
+	return s.data
+}
+
+func (s *Storage[T]) Entities() []Entity {
+	return s.entities
+}
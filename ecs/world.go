@@ -0,0 +1,90 @@
+// Package ecs stores game state as entities with components, iterated by
+// typed queries and updated by systems run in an ordered schedule.
+//
+// Components live in one sparse set per type: a dense slice of values that
+// queries walk in order, and a sparse index from entity to value. A World is
+// not safe for concurrent use, except by systems a Schedule runs
+// concurrently, which touch disjoint component types.
+package ecs
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Entity identifies an entity. The low 32 bits are an index that is reused
+// once the entity is despawned, the high 32 bits a generation telling the
+// reuses apart, so a stale Entity never refers to a newer entity.
+type Entity uint64
+
+// Nil is never a live entity.
+const Nil Entity = 0
+
+func newEntity(index, generation uint32) Entity {
+	return Entity(generation)<<32 | Entity(index)
+}
+
+func (e Entity) index() uint32 {
+	return uint32(e)
+}
+
+func (e Entity) generation() uint32 {
+	return uint32(e >> 32)
+}
+
+// World holds entities and their components.
+type World struct {
+	generations []uint32 // current generation of each index, odd while alive
+	free        []uint32
+	alive       int
+	storagesMu  sync.RWMutex
+	storages    map[reflect.Type]storage
+}
+
+// storage is the part of a Storage that does not depend on its type.
+type storage interface {
+	remove(e Entity) bool
+}
+
+func NewWorld() *World {
+	return &World{storages: make(map[reflect.Type]storage)}
+}
+
+// Spawn creates an entity without components.
+func (w *World) Spawn() Entity {
+	w.alive++
+	if n := len(w.free); n > 0 {
+		index := w.free[n-1]
+		w.free = w.free[:n-1]
+		w.generations[index]++
+		return newEntity(index, w.generations[index])
+	}
+	index := uint32(len(w.generations))
+	w.generations = append(w.generations, 1)
+	return newEntity(index, 1)
+}
+
+// Alive reports whether e has been spawned and not despawned.
+func (w *World) Alive(e Entity) bool {
+	index := e.index()
+	return int(index) < len(w.generations) && w.generations[index] == e.generation() && e.generation()%2 == 1
+}
+
+// Despawn removes e and all its components, reporting whether it was alive.
+func (w *World) Despawn(e Entity) bool {
+	if !w.Alive(e) {
+		return false
+	}
+	for _, s := range w.storages {
+		s.remove(e)
+	}
+	w.generations[e.index()]++
+	w.free = append(w.free, e.index())
+	w.alive--
+	return true
+}
+
+// Len returns the number of live entities.
+func (w *World) Len() int {
+	return w.alive
+}
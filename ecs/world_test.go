@@ -0,0 +1,125 @@
+package ecs
+
+import "testing"
+
+type position struct{ x, y float32 }
+
+type name string
+
+func TestStaleEntityRejected(t *testing.T) {
+	w := NewWorld()
+	old := w.Spawn()
+	Add(w, old, position{1, 2})
+	if !w.Despawn(old) {
+		t.Fatal("Despawn of a live entity reported false")
+	}
+	reused := w.Spawn()
+	if reused.index() != old.index() {
+		t.Fatalf("index %d was not reused, got %d", old.index(), reused.index())
+	}
+	if reused == old {
+		t.Fatal("reused index has the same generation")
+	}
+
+	if w.Alive(old) {
+		t.Error("stale entity is alive")
+	}
+	if w.Despawn(old) {
+		t.Error("Despawn of a stale entity reported true")
+	}
+	if !w.Alive(reused) {
+		t.Error("Despawn of a stale entity killed its reuse")
+	}
+	if p := Add(w, old, position{3, 4}); p != nil {
+		t.Error("Add to a stale entity returned a component")
+	}
+	if p := Get[position](w, old); p != nil {
+		t.Errorf("stale entity has component %v", *p)
+	}
+	if Has[position](w, reused) {
+		t.Error("reused entity inherited its index's component")
+	}
+
+	Add(w, reused, position{5, 6})
+	if p := Get[position](w, old); p != nil {
+		t.Errorf("stale entity sees its reuse's component %v", *p)
+	}
+	if Remove[position](w, old) {
+		t.Error("Remove through a stale entity reported true")
+	}
+	if p := Get[position](w, reused); p == nil || *p != (position{5, 6}) {
+		t.Errorf("reused entity's component is %v after Remove through a stale entity", p)
+	}
+	if w.Len() != 1 {
+		t.Errorf("Len %d, want 1", w.Len())
+	}
+	if w.Alive(Nil) {
+		t.Error("Nil is alive")
+	}
+}
+
+func TestRemoveMovesLast(t *testing.T) {
+	w := NewWorld()
+	var entities []Entity
+	for i := range 5 {
+		e := w.Spawn()
+		entities = append(entities, e)
+		Add(w, e, position{float32(i), 0})
+	}
+
+	// Removing the first moves the last into its place.
+	if !Remove[position](w, entities[0]) {
+		t.Fatal("Remove reported false")
+	}
+	s := Components[position](w)
+	if s.Len() != 4 || s.Entities()[0] != entities[4] {
+		t.Fatalf("after removing the first, storage holds %v", s.Entities())
+	}
+	for i, e := range entities[1:] {
+		if p := Get[position](w, e); p == nil || p.x != float32(i+1) {
+			t.Errorf("entity %d has %v after the swap", i+1, p)
+		}
+	}
+	if Has[position](w, entities[0]) {
+		t.Error("removed component is still there")
+	}
+	if Remove[position](w, entities[0]) {
+		t.Error("second Remove reported true")
+	}
+
+	// Removing the last moves nothing.
+	Remove[position](w, entities[3])
+	for _, i := range []int{1, 2, 4} {
+		if p := Get[position](w, entities[i]); p == nil || p.x != float32(i) {
+			t.Errorf("entity %d has %v after removing the last", i, p)
+		}
+	}
+
+	// Every remaining component is found through its entity.
+	for i, e := range s.Entities() {
+		if Get[position](w, e) != &s.Data()[i] {
+			t.Errorf("entity %v does not map to its place %d", e, i)
+		}
+	}
+}
+
+func TestDespawnRemovesComponents(t *testing.T) {
+	w := NewWorld()
+	a, b := w.Spawn(), w.Spawn()
+	Add(w, a, position{1, 1})
+	Add(w, a, name("a"))
+	Add(w, b, position{2, 2})
+	w.Despawn(a)
+	if Components[position](w).Len() != 1 || Components[name](w).Len() != 0 {
+		t.Fatal("despawned entity's components remain")
+	}
+	if p := Get[position](w, b); p == nil || *p != (position{2, 2}) {
+		t.Errorf("other entity's component is %v", p)
+	}
+
+	count := 0
+	NewQuery2[position, name](w).Each(func(e Entity, p *position, n *name) { count++ })
+	if count != 0 {
+		t.Errorf("query found %d despawned entities", count)
+	}
+}
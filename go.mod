@@ -3,12 +3,21 @@ module go_wgpu
 go 1.23.0
 
 require (
-	github.com/EngoEngine/glm v0.0.0-20170725114841-9c08f4d1f668 // indirect
 	github.com/EngoEngine/math v1.0.4 // indirect
-	github.com/go-gl/glfw/v3.3/glfw v0.0.0-20240506104042-037f3cc74f2a // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
 	github.com/rajveermalviya/go-webgpu-examples v0.0.0-20230730112648-c29c7b8006e5 // indirect
-	github.com/rajveermalviya/go-webgpu/wgpu v0.17.1 // indirect
-	github.com/rajveermalviya/go-webgpu/wgpuext/glfw v0.1.1 // indirect
+	golang.org/x/crypto v0.27.0 // indirect
 	golang.org/x/net v0.29.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
+	golang.org/x/text v0.18.0 // indirect
 )
+
+require (
+	github.com/EngoEngine/glm v0.0.0-20170725114841-9c08f4d1f668
+	github.com/go-gl/glfw/v3.3/glfw v0.0.0-20240506104042-037f3cc74f2a
+	github.com/gorilla/websocket v1.5.3
+	github.com/rajveermalviya/go-webgpu/wgpu v0.17.1
+	github.com/rajveermalviya/go-webgpu/wgpuext/glfw v0.1.1
+	wgpu_server v0.0.0
+)
+
+replace wgpu_server => ./server
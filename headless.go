@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var headlessFrames = flag.Int("frames", 0, "headless: stop after this many frames, 0 to run until the input playback ends or the process is interrupted")
+var frameRate = flag.Float64("frame-rate", 60, "headless: frames per second, 0 to run as fast as possible")
+
+// parseFlags parses the command line and sets up logging.
+func parseFlags() {
+	flag.Parse()
+	if err := logOptions.Setup(os.Stderr); err != nil {
+		slog.Error("invalid logging options", "err", err)
+		os.Exit(2)
+	}
+}
+
+// runHeadless runs the client without a window or GPU. Frames have a fixed
+// length of 1/-frame-rate seconds unless input is played back, and the
+// player instances are written to memory instead of a GPU buffer.
+func runHeadless() {
+	camera := NewCamera()
+	session := newSession(&camera)
+	defer session.Close()
+	flying := session.StartFlying()
+	inputs := openInputs()
+	defer inputs.Close()
+	devAssets := openDevAssets(false)
+	defer devAssets.Close()
+	instances := make([][16]float32, maxInstances)
+
+	dt := 1.0 / 60
+	var pace <-chan time.Time
+	if *frameRate > 0 {
+		dt = 1 / *frameRate
+		ticker := time.NewTicker(time.Duration(float64(time.Second) * dt))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	stats := time.NewTicker(time.Second)
+	defer stats.Stop()
+
+	slog.Info("running headless", "frames", *headlessFrames, "frame_rate", *frameRate)
+	start, second, count, rendered := time.Now(), time.Now(), 0, 0
+	for frame := 0; *headlessFrames == 0 || frame < *headlessFrames; frame++ {
+		select {
+		case <-signals:
+			slog.Info("interrupted", "frames", frame)
+			return
+		case <-stats.C:
+			session.logStats(float32(count) / float32(time.Since(second).Seconds()))
+			second, count = time.Now(), 0
+		default:
+		}
+
+		devAssets.Reload(session, nil)
+		frameDT, input, played := inputs.Next(dt, Input{Rotation: camera.Rotation, Fly: flying})
+		if !played && inputs.playback != nil && *headlessFrames == 0 {
+			slog.Info("input playback finished", "frames", frame)
+			break
+		}
+		session.Update(frameDT, input)
+		rendered = writeInstances(session.World, instances)
+		count++
+		if pace != nil {
+			<-pace
+		}
+	}
+	slog.Info("headless run finished", "elapsed", time.Since(start).Round(time.Millisecond), "instances", rendered, "position", camera.Position)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/EngoEngine/glm"
+)
+
+var recordInput = flag.String("record-input", "", "record every frame's input to this file")
+var playInput = flag.String("play-input", "", "play back input recorded with -record-input instead of reading the keyboard and mouse")
+
+// Input is what the player does in one frame.
+type Input struct {
+	Move     glm.Vec3 // movement in camera space, each axis -1, 0 or 1
+	Rotation glm.Quat // camera rotation
+	Jump     bool
+	Fly      bool // fly through colliders instead of walking
+}
+
+// inputVersion is written at the start of every input recording, after
+// inputMagic. Recordings of other versions are refused, as their frames are
+// laid out differently.
+const inputVersion = 1
+
+const inputMagic = "go_engine input"
+
+// inputFrame is one frame of a recording, as stored in the file.
+type inputFrame struct {
+	DT       float64
+	Move     [3]float32
+	Rotation [4]float32
+	Jump     bool
+	Fly      bool
+}
+
+// InputRecorder writes the input of every frame to a file, so a session can
+// be played back frame for frame with the same frame times.
+type InputRecorder struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func CreateInputRecorder(path string) (*InputRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	header := binary.AppendUvarint([]byte(inputMagic), inputVersion)
+	if _, err := w.Write(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &InputRecorder{f: f, w: w}, nil
+}
+
+func (r *InputRecorder) Record(dt float64, input Input) error {
+	frame := inputFrame{
+		DT:       dt,
+		Move:     input.Move,
+		Rotation: [4]float32{input.Rotation.W, input.Rotation.V[0], input.Rotation.V[1], input.Rotation.V[2]},
+		Jump:     input.Jump,
+		Fly:      input.Fly,
+	}
+	return binary.Write(r.w, binary.LittleEndian, &frame)
+}
+
+func (r *InputRecorder) Close() error {
+	err := r.w.Flush()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// InputPlayback returns recorded frames in order.
+type InputPlayback struct {
+	frames []inputFrame
+	next   int
+}
+
+// LoadInput reads a recording made by an InputRecorder. A frame cut off at
+// the end of the file is dropped.
+func LoadInput(path string) (*InputPlayback, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	header := make([]byte, len(inputMagic))
+	if _, err := io.ReadFull(r, header); err != nil || string(header) != inputMagic {
+		return nil, fmt.Errorf("%s is not an input recording", path)
+	}
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if version != inputVersion {
+		return nil, fmt.Errorf("%s has version %d, only %d can be played", path, version, inputVersion)
+	}
+
+	playback := &InputPlayback{}
+	for {
+		var frame inputFrame
+		err := binary.Read(r, binary.LittleEndian, &frame)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return playback, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		playback.frames = append(playback.frames, frame)
+	}
+}
+
+// Next returns the next frame's time and input, or false once every frame
+// has been played.
+func (p *InputPlayback) Next() (float64, Input, bool) {
+	if p.next >= len(p.frames) {
+		return 0, Input{}, false
+	}
+	frame := p.frames[p.next]
+	p.next++
+	return frame.DT, Input{
+		Move:     frame.Move,
+		Rotation: glm.Quat{W: frame.Rotation[0], V: glm.Vec3{frame.Rotation[1], frame.Rotation[2], frame.Rotation[3]}},
+		Jump:     frame.Jump,
+		Fly:      frame.Fly,
+	}, true
+}
+
+// Len returns the number of recorded frames.
+func (p *InputPlayback) Len() int {
+	return len(p.frames)
+}
+
+// inputSource picks each frame's input from the -play-input recording while
+// it lasts, or else the live input, and records it if -record-input is set.
+type inputSource struct {
+	playback *InputPlayback
+	recorder *InputRecorder
+}
+
+func openInputs() *inputSource {
+	inputs := &inputSource{}
+	if *playInput != "" {
+		playback, err := LoadInput(*playInput)
+		if err != nil {
+			slog.Error("could not load input", "path", *playInput, "err", err)
+			os.Exit(1)
+		}
+		slog.Info("playing input", "path", *playInput, "frames", playback.Len())
+		inputs.playback = playback
+	}
+	if *recordInput != "" {
+		recorder, err := CreateInputRecorder(*recordInput)
+		if err != nil {
+			slog.Error("could not record input", "path", *recordInput, "err", err)
+			os.Exit(1)
+		}
+		inputs.recorder = recorder
+	}
+	return inputs
+}
+
+// Next returns the frame time and input to use for the next frame, given the
+// live ones, and whether they came from the recording.
+func (inputs *inputSource) Next(dt float64, live Input) (float64, Input, bool) {
+	played := false
+	if inputs.playback != nil {
+		if recorded, input, ok := inputs.playback.Next(); ok {
+			dt, live, played = recorded, input, true
+		}
+	}
+	if inputs.recorder != nil {
+		if err := inputs.recorder.Record(dt, live); err != nil {
+			slog.Error("input recording stopped", "path", *recordInput, "err", err)
+			inputs.recorder.Close()
+			inputs.recorder = nil
+		}
+	}
+	return dt, live, played
+}
+
+func (inputs *inputSource) Close() {
+	if inputs.recorder != nil {
+		if err := inputs.recorder.Close(); err != nil {
+			slog.Error("could not finish input recording", "path", *recordInput, "err", err)
+		}
+	}
+}
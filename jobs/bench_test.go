@@ -0,0 +1,125 @@
+package jobs_test
+
+import (
+	"go_wgpu/ecs"
+	"go_wgpu/jobs"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/EngoEngine/glm"
+)
+
+// The benchmarks compare ways of updating a million model matrices each
+// frame: serially, by starting a goroutine per CPU with a WaitGroup as the
+// client used to, with ParallelFor, and through an ECS query.
+
+const (
+	models = 1_000_000
+	grain  = 4096
+)
+
+type Model [16]float32
+
+var (
+	axis        = glm.Vec3{0, 1, 0}
+	rotation    = glm.HomogRotate3D(0.01, &axis)
+	translation = glm.Translate3D(0, 0, 0.05)
+)
+
+// update is the per-matrix work of the client's simulation.
+func update(model *Model) {
+	m := glm.Mat4(*model)
+	m = m.Mul4(&rotation)
+	*model = Model(m.Mul4(&translation))
+}
+
+// light is a much cheaper per-element update, where scheduling overhead
+// dominates.
+func light(model *Model) {
+	model[12] += 0.05
+}
+
+var work = []struct {
+	name string
+	fn   func(*Model)
+}{{"matrix", update}, {"light", light}}
+
+func BenchmarkSerial(b *testing.B) {
+	data := make([]Model, models)
+	for _, w := range work {
+		b.Run(w.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				for i := range data {
+					w.fn(&data[i])
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGoroutines is the approach the client used before the job
+// system: a new goroutine per CPU and a fresh WaitGroup every frame.
+func BenchmarkGoroutines(b *testing.B) {
+	data := make([]Model, models)
+	workers := runtime.NumCPU()
+	for _, w := range work {
+		b.Run(w.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				wg := sync.WaitGroup{}
+				for a := range workers {
+					wg.Add(1)
+					go func() {
+						start := a * len(data) / workers
+						end := (a + 1) * len(data) / workers
+						for i := start; i < end; i++ {
+							w.fn(&data[i])
+						}
+						wg.Done()
+					}()
+				}
+				wg.Wait()
+			}
+		})
+	}
+}
+
+func BenchmarkParallelFor(b *testing.B) {
+	pool := jobs.NewPool(0)
+	defer pool.Close()
+	data := make([]Model, models)
+	for _, w := range work {
+		b.Run(w.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				pool.ParallelFor(len(data), grain, func(start, end int) {
+					for i := start; i < end; i++ {
+						w.fn(&data[i])
+					}
+				})
+			}
+		})
+	}
+}
+
+func BenchmarkQueryParallelEach(b *testing.B) {
+	pool := jobs.NewPool(0)
+	defer pool.Close()
+	world := ecs.NewWorld()
+	for range models {
+		ecs.Add(world, world.Spawn(), Model{})
+	}
+	q := ecs.NewQuery1[Model](world)
+	for _, w := range work {
+		b.Run(w.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				q.ParallelEach(pool, grain, func(e ecs.Entity, model *Model) {
+					w.fn(model)
+				})
+			}
+		})
+	}
+}
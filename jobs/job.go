@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Job is a handle to a function submitted to a Pool.
+type Job struct {
+	pool    *Pool
+	fn      func()
+	pending atomic.Int32 // unfinished dependencies, plus one until submitted
+	done    chan struct{}
+
+	mu         sync.Mutex
+	finished   bool
+	dependents []*Job
+}
+
+// Go runs fn on the pool once every job in after has finished, and returns a
+// handle to it.
+func (p *Pool) Go(fn func(), after ...*Job) *Job {
+	job := p.newJob(fn)
+	job.pending.Store(int32(len(after)) + 1)
+	for _, dep := range after {
+		dep.mu.Lock()
+		if dep.finished {
+			dep.mu.Unlock()
+			job.pending.Add(-1)
+			continue
+		}
+		dep.dependents = append(dep.dependents, job)
+		dep.mu.Unlock()
+	}
+	if job.pending.Add(-1) == 0 {
+		p.submit(job)
+	}
+	return job
+}
+
+func (p *Pool) newJob(fn func()) *Job {
+	return &Job{pool: p, fn: fn, done: make(chan struct{})}
+}
+
+func (j *Job) run() {
+	j.fn()
+	j.mu.Lock()
+	j.finished = true
+	dependents := j.dependents
+	j.dependents = nil
+	j.mu.Unlock()
+	close(j.done)
+
+	var ready []*Job
+	for _, dependent := range dependents {
+		if dependent.pending.Add(-1) == 0 {
+			ready = append(ready, dependent)
+		}
+	}
+	j.pool.submit(ready...)
+}
+
+// Done is closed once the job has run.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait returns once the job has run. While waiting, the calling goroutine
+// runs other queued jobs, so jobs may wait for the jobs they start.
+func (j *Job) Wait() {
+	for {
+		select {
+		case <-j.done:
+			return
+		default:
+		}
+		if !j.pool.help() {
+			<-j.done
+			return
+		}
+	}
+}
+
+// WaitAll waits for every job.
+func WaitAll(jobs ...*Job) {
+	for _, job := range jobs {
+		job.Wait()
+	}
+}
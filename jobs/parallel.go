@@ -0,0 +1,18 @@
+package jobs
+
+// ParallelFor calls fn for consecutive ranges of at most grain indexes
+// covering [0, n), spread over the workers, and returns once every call has.
+// The caller runs ranges too while it waits.
+func (p *Pool) ParallelFor(n, grain int, fn func(start, end int)) {
+	if n <= 0 {
+		return
+	}
+	grain = max(grain, 1)
+	chunks := make([]*Job, 0, (n+grain-1)/grain)
+	for start := 0; start < n; start += grain {
+		end := min(start+grain, n)
+		chunks = append(chunks, p.newJob(func() { fn(start, end) }))
+	}
+	p.submit(chunks...)
+	WaitAll(chunks...)
+}
@@ -0,0 +1,153 @@
+// Package jobs runs short jobs on a fixed set of worker goroutines. Every
+// worker owns a queue; jobs are spread over the queues and idle workers
+// steal from the others, so per-frame work needs no new goroutines.
+package jobs
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Pool is a set of persistent workers.
+type Pool struct {
+	queues []queue
+	next   atomic.Uint32 // queue the next submitted job goes to
+	queued atomic.Int64  // jobs waiting in the queues
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	closed bool
+}
+
+// queue is a worker's deque. The owner takes the newest job, thieves the
+// oldest.
+type queue struct {
+	mu   sync.Mutex
+	jobs []*Job
+	_    [32]byte // keep queues on separate cache lines
+}
+
+func (q *queue) push(jobs ...*Job) {
+	q.mu.Lock()
+	q.jobs = append(q.jobs, jobs...)
+	q.mu.Unlock()
+}
+
+func (q *queue) pop() *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.jobs)
+	if n == 0 {
+		return nil
+	}
+	job := q.jobs[n-1]
+	q.jobs[n-1] = nil
+	q.jobs = q.jobs[:n-1]
+	return job
+}
+
+func (q *queue) steal() *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.jobs) == 0 {
+		return nil
+	}
+	job := q.jobs[0]
+	q.jobs[0] = nil
+	q.jobs = q.jobs[1:]
+	return job
+}
+
+// NewPool starts workers goroutines, or one per CPU if workers is not
+// positive.
+func NewPool(workers int) *Pool {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	p := &Pool{queues: make([]queue, workers)}
+	p.cond = sync.NewCond(&p.mu)
+	for i := range workers {
+		go p.work(i)
+	}
+	return p
+}
+
+func (p *Pool) Workers() int {
+	return len(p.queues)
+}
+
+func (p *Pool) work(self int) {
+	for {
+		if job := p.find(self); job != nil {
+			job.run()
+			continue
+		}
+		p.mu.Lock()
+		for p.queued.Load() == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		closed := p.closed && p.queued.Load() == 0
+		p.mu.Unlock()
+		if closed {
+			return
+		}
+	}
+}
+
+// find takes a job from queue self, or steals one from another queue.
+func (p *Pool) find(self int) *Job {
+	if p.queued.Load() == 0 {
+		return nil
+	}
+	if job := p.queues[self].pop(); job != nil {
+		p.queued.Add(-1)
+		return job
+	}
+	for i := 1; i < len(p.queues); i++ {
+		if job := p.queues[(self+i)%len(p.queues)].steal(); job != nil {
+			p.queued.Add(-1)
+			return job
+		}
+	}
+	return nil
+}
+
+// submit queues runnable jobs, spreading them over the workers' queues.
+func (p *Pool) submit(jobs ...*Job) {
+	if len(jobs) == 0 {
+		return
+	}
+	n := len(p.queues)
+	per := (len(jobs) + n - 1) / n
+	for len(jobs) > 0 {
+		count := min(per, len(jobs))
+		q := int(p.next.Add(1)) % n
+		p.queues[q].push(jobs[:count]...)
+		p.queued.Add(int64(count))
+		jobs = jobs[count:]
+	}
+	p.mu.Lock()
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+// help runs one queued job on the calling goroutine, reporting whether there
+// was one.
+func (p *Pool) help() bool {
+	start := int(p.next.Load()) % len(p.queues)
+	if job := p.find(start); job != nil {
+		job.run()
+		return true
+	}
+	return false
+}
+
+// Close stops the workers once every queued job has run. Jobs must not be
+// submitted after Close.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
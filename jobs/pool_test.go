@@ -0,0 +1,180 @@
+package jobs
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// finished reports whether job has run.
+func finished(job *Job) bool {
+	select {
+	case <-job.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// waitWithin waits for job, failing the test if it takes over a second.
+func waitWithin(t *testing.T, job *Job) {
+	t.Helper()
+	select {
+	case <-job.Done():
+	case <-time.After(time.Second):
+		t.Fatal("job did not finish")
+	}
+}
+
+func TestGoAfter(t *testing.T) {
+	pool := NewPool(4)
+	defer pool.Close()
+
+	// Every job checks that the jobs it depends on finished before it
+	// started, in a random graph with some dependencies finished before
+	// their dependents are submitted.
+	r := rand.New(rand.NewSource(1))
+	var started []*Job
+	var failures atomic.Int32
+	for i := range 500 {
+		var after []*Job
+		for range r.Intn(4) {
+			if i > 0 {
+				after = append(after, started[r.Intn(i)])
+			}
+		}
+		started = append(started, pool.Go(func() {
+			for _, dep := range after {
+				if !finished(dep) {
+					failures.Add(1)
+				}
+			}
+		}, after...))
+		if i%50 == 0 {
+			started[i].Wait()
+		}
+	}
+	WaitAll(started...)
+	if n := failures.Load(); n != 0 {
+		t.Errorf("%d jobs ran before their dependencies", n)
+	}
+}
+
+func TestWaitHelps(t *testing.T) {
+	pool := NewPool(1)
+	defer pool.Close()
+
+	// Block the only worker, so queued jobs only run if Wait runs them.
+	release := make(chan struct{})
+	blocker := pool.Go(func() { <-release })
+	defer close(release)
+	for pool.queued.Load() != 0 {
+		runtime.Gosched()
+	}
+
+	ran := false
+	job := pool.Go(func() { ran = true })
+	done := make(chan struct{})
+	go func() {
+		job.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not run the queued job while the worker was busy")
+	}
+	if !ran || finished(blocker) {
+		t.Errorf("ran %v, blocker finished %v", ran, finished(blocker))
+	}
+
+	// Jobs waiting for the jobs they start do not deadlock the pool.
+	nested := pool.Go(func() {
+		inner := pool.Go(func() {})
+		inner.Wait()
+	})
+	go nested.Wait()
+	waitWithin(t, nested)
+}
+
+func TestParallelForCoversEveryIndex(t *testing.T) {
+	pool := NewPool(3)
+	defer pool.Close()
+	for _, n := range []int{0, 1, 7, 100, 1000, 4097} {
+		for _, grain := range []int{-1, 1, 3, 64, 5000} {
+			counts := make([]atomic.Int32, n)
+			var tooLarge atomic.Bool
+			pool.ParallelFor(n, grain, func(start, end int) {
+				if end-start > max(grain, 1) || start >= end {
+					tooLarge.Store(true)
+				}
+				for i := start; i < end; i++ {
+					counts[i].Add(1)
+				}
+			})
+			if tooLarge.Load() {
+				t.Errorf("n %d, grain %d: a range was empty or larger than grain", n, grain)
+			}
+			for i := range counts {
+				if c := counts[i].Load(); c != 1 {
+					t.Fatalf("n %d, grain %d: index %d visited %d times", n, grain, i, c)
+				}
+			}
+		}
+	}
+
+	// ParallelFor from inside jobs, on every worker at once.
+	var total atomic.Int64
+	var wg sync.WaitGroup
+	outer := make([]*Job, 6)
+	for i := range outer {
+		wg.Add(1)
+		outer[i] = pool.Go(func() {
+			defer wg.Done()
+			pool.ParallelFor(1000, 10, func(start, end int) {
+				total.Add(int64(end - start))
+			})
+		})
+	}
+	WaitAll(outer...)
+	wg.Wait()
+	if n := total.Load(); n != 6000 {
+		t.Errorf("nested ParallelFor visited %d indexes, want 6000", n)
+	}
+}
+
+func TestClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	pool := NewPool(4)
+
+	// Jobs queued before Close still run.
+	release := make(chan struct{})
+	var ran atomic.Int32
+	var queued []*Job
+	for range 100 {
+		queued = append(queued, pool.Go(func() {
+			<-release
+			ran.Add(1)
+		}))
+	}
+	pool.Close()
+	close(release)
+	for _, job := range queued {
+		waitWithin(t, job)
+	}
+	if n := ran.Load(); n != 100 {
+		t.Errorf("%d of 100 queued jobs ran", n)
+	}
+
+	// And then the workers exit.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines after Close, %d before NewPool", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -1,12 +1,15 @@
+//go:build !headless
+
 package main
 
 import (
-	"fmt"
+	"flag"
+	"go_wgpu/ecs"
+	"log/slog"
 	"math"
 	"os"
 	"runtime"
 	"strings"
-	"sync"
 	"time"
 	"unsafe"
 
@@ -21,6 +24,8 @@ import (
 
 var forceFallbackAdapter = os.Getenv("WGPU_FORCE_FALLBACK_ADAPTER") == "1"
 
+var headless = flag.Bool("headless", false, "run without a window or GPU")
+
 func init() {
 	runtime.LockOSThread()
 
@@ -180,6 +185,20 @@ func generateMatrix(camera *Camera, aspectRatio float32) Transform {
 //go:embed shader.wgsl
 var shader string
 
+// loadShader returns the shader's source: the -shader file in dev mode if
+// it can be read, the built in shader otherwise.
+func loadShader() string {
+	if !*dev {
+		return shader
+	}
+	code, err := os.ReadFile(*shaderPath)
+	if err != nil {
+		slog.Warn("dev mode: using the built in shader", "err", err)
+		return shader
+	}
+	return string(code)
+}
+
 type State struct {
 	surface      *wgpu.Surface
 	swapChain    *wgpu.SwapChain
@@ -193,6 +212,7 @@ type State struct {
 	instanceBuf  *wgpu.Buffer
 	indexBuf     *wgpu.Buffer
 	uniformBuf   *wgpu.Buffer
+	textureView  *wgpu.TextureView
 	pipeline     *wgpu.RenderPipeline
 	bindGroup    *wgpu.BindGroup
 	camera       Camera
@@ -244,17 +264,6 @@ func (s *State) createRenderPassDepthAttachmentView() (*wgpu.RenderPassDepthSten
 	}, nil
 }
 
-var model [][16]float32 = make([][16]float32, 1_000_000)
-
-type Player struct {
-	Position glm.Vec3
-	Rotation glm.Quat
-}
-
-var players = make(map[int]Player)
-var mu = sync.Mutex{}
-var numPlayers = 0
-
 func InitState(window *glfw.Window) (s *State, err error) {
 	defer func() {
 		if err != nil {
@@ -264,7 +273,7 @@ func InitState(window *glfw.Window) (s *State, err error) {
 	}()
 	s = &State{}
 
-	s.camera.Rotation = glm.QuatLookAtV(&glm.Vec3{}, &glm.Vec3{0, 0, -1}, &glm.Vec3{0, 1, 0})
+	s.camera = NewCamera()
 
 	// pos := glm.Vec3{0, 0, 0}
 	// for i := range model {
@@ -338,7 +347,7 @@ func InitState(window *glfw.Window) (s *State, err error) {
 
 	{
 		s.instanceBuf, err = s.device.CreateBuffer(&wgpu.BufferDescriptor{
-			Size:             uint64(unsafe.Sizeof(model[0]) * uintptr(len(model))),
+			Size:             uint64(unsafe.Sizeof(Model{}) * maxInstances),
 			Usage:            wgpu.BufferUsage_Storage | wgpu.BufferUsage_CopyDst,
 			MappedAtCreation: false,
 		})
@@ -366,11 +375,10 @@ func InitState(window *glfw.Window) (s *State, err error) {
 	}
 	defer texture.Release()
 
-	textureView, err := texture.CreateView(nil)
+	s.textureView, err = texture.CreateView(nil)
 	if err != nil {
 		return s, err
 	}
-	defer textureView.Release()
 
 	s.queue.WriteTexture(
 		texture.AsImageCopy(),
@@ -397,23 +405,58 @@ func InitState(window *glfw.Window) (s *State, err error) {
 		}
 	}
 
-	shader, err := s.device.CreateShaderModule(&wgpu.ShaderModuleDescriptor{
+	if err := s.createPipeline(loadShader()); err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+func (s *State) Resize(width, height int) {
+	if width > 0 && height > 0 {
+		s.config.Width = uint32(width)
+		s.config.Height = uint32(height)
+
+		// mxTotal := generateMatrix(&s.camera, float32(width)/float32(height))
+		// s.queue.WriteBuffer(s.uniformBuf, 0, wgpu.ToBytes(mxTotal[:]))
+
+		if s.swapChain != nil {
+			s.swapChain.Release()
+		}
+		var err error
+		s.swapChain, err = s.device.CreateSwapChain(s.surface, s.config)
+		if err != nil {
+			panic(err)
+		}
+		s.depth, err = s.createRenderPassDepthAttachmentView()
+		if err != nil {
+			panic(err)
+		}
+
+	}
+}
+
+// createPipeline compiles the shader code and builds the render pipeline
+// and bind group from it. They replace the current ones only if everything
+// succeeds, so a broken shader leaves the old pipeline drawing.
+func (s *State) createPipeline(code string) error {
+	module, err := s.device.CreateShaderModule(&wgpu.ShaderModuleDescriptor{
 		Label:          "shader.wgsl",
-		WGSLDescriptor: &wgpu.ShaderModuleWGSLDescriptor{Code: shader},
+		WGSLDescriptor: &wgpu.ShaderModuleWGSLDescriptor{Code: code},
 	})
 	if err != nil {
-		return s, err
+		return err
 	}
-	defer shader.Release()
+	defer module.Release()
 
-	s.pipeline, err = s.device.CreateRenderPipeline(&wgpu.RenderPipelineDescriptor{
+	pipeline, err := s.device.CreateRenderPipeline(&wgpu.RenderPipelineDescriptor{
 		Vertex: wgpu.VertexState{
-			Module:     shader,
+			Module:     module,
 			EntryPoint: "vs_main",
 			Buffers:    []wgpu.VertexBufferLayout{VertexBufferLayout},
 		},
 		Fragment: &wgpu.FragmentState{
-			Module:     shader,
+			Module:     module,
 			EntryPoint: "fs_main",
 			Targets: []wgpu.ColorTargetState{
 				{
@@ -446,13 +489,13 @@ func InitState(window *glfw.Window) (s *State, err error) {
 		},
 	})
 	if err != nil {
-		return s, err
+		return err
 	}
 
-	bindGroupLayout := s.pipeline.GetBindGroupLayout(0)
+	bindGroupLayout := pipeline.GetBindGroupLayout(0)
 	defer bindGroupLayout.Release()
 
-	s.bindGroup, err = s.device.CreateBindGroup(&wgpu.BindGroupDescriptor{
+	bindGroup, err := s.device.CreateBindGroup(&wgpu.BindGroupDescriptor{
 		Layout: bindGroupLayout,
 		Entries: []wgpu.BindGroupEntry{
 			{
@@ -462,7 +505,7 @@ func InitState(window *glfw.Window) (s *State, err error) {
 			},
 			{
 				Binding:     1,
-				TextureView: textureView,
+				TextureView: s.textureView,
 				Size:        wgpu.WholeSize,
 			},
 			{
@@ -473,40 +516,24 @@ func InitState(window *glfw.Window) (s *State, err error) {
 		},
 	})
 	if err != nil {
-		return s, err
+		pipeline.Release()
+		return err
 	}
 
-	return s, nil
-}
-
-func (s *State) Resize(width, height int) {
-	if width > 0 && height > 0 {
-		s.config.Width = uint32(width)
-		s.config.Height = uint32(height)
-
-		// mxTotal := generateMatrix(&s.camera, float32(width)/float32(height))
-		// s.queue.WriteBuffer(s.uniformBuf, 0, wgpu.ToBytes(mxTotal[:]))
-
-		if s.swapChain != nil {
-			s.swapChain.Release()
-		}
-		var err error
-		s.swapChain, err = s.device.CreateSwapChain(s.surface, s.config)
-		if err != nil {
-			panic(err)
-		}
-		s.depth, err = s.createRenderPassDepthAttachmentView()
-		if err != nil {
-			panic(err)
-		}
-
+	if s.bindGroup != nil {
+		s.bindGroup.Release()
+	}
+	if s.pipeline != nil {
+		s.pipeline.Release()
 	}
+	s.pipeline, s.bindGroup = pipeline, bindGroup
+	return nil
 }
 
-var numThreads = runtime.NumCPU()
 var staging *wgpu.Buffer = nil
 
-func (s *State) Render() error {
+func (s *State) Render(world *ecs.World) error {
+	numInstances := 0
 	nextTexture, err := s.swapChain.GetCurrentTextureView()
 	if err != nil {
 		return err
@@ -543,7 +570,7 @@ func (s *State) Render() error {
 		// modelBytes := unsafe.Slice((*byte)(unsafe.Pointer(&model[0])), unsafe.Sizeof(model[0])*uintptr(len(model)))
 		if staging == nil {
 			staging, err = s.device.CreateBuffer(&wgpu.BufferDescriptor{
-				Size:             uint64(unsafe.Sizeof(model[0]) * uintptr(len(model))),
+				Size:             uint64(unsafe.Sizeof(Model{}) * maxInstances),
 				Usage:            wgpu.BufferUsage_CopySrc | wgpu.BufferUsage_MapWrite,
 				MappedAtCreation: false,
 			})
@@ -551,10 +578,8 @@ func (s *State) Render() error {
 				return err
 			}
 		}
-		_len := uint(unsafe.Sizeof(model[0]) * uintptr(len(model)))
+		_len := uint(unsafe.Sizeof(Model{}) * maxInstances)
 		{
-			mu.Lock()
-			numPlayers = len(players)
 			// println("Num Players:", numPlayers)
 			// wg := sync.WaitGroup{}
 			staging.MapAsync(wgpu.MapMode_Write, 0, uint64(_len), func(status wgpu.BufferMapAsyncStatus) {
@@ -564,18 +589,8 @@ func (s *State) Render() error {
 			})
 			s.device.Poll(true, nil)
 			byteMap := staging.GetMappedRange(0, _len)
-			modelMap := unsafe.Slice((*[16]float32)(unsafe.Pointer(&byteMap[0])), len(model))
-			i := 0
-			for _, player := range players {
-				rotation := player.Rotation.Mat4()
-				translation := glm.Translate3D(player.Position[0], player.Position[1], player.Position[2])
-				m := glm.Ident4()
-				m = m.Mul4(&translation)
-				m = m.Mul4(&rotation)
-				modelMap[i] = *(*[16]float32)(unsafe.Pointer(&m))
-				i++
-			}
-			mu.Unlock()
+			modelMap := unsafe.Slice((*[16]float32)(unsafe.Pointer(&byteMap[0])), maxInstances)
+			numInstances = writeInstances(world, modelMap)
 			// for a := range numThreads {
 			// 	wg.Add(1)
 			// 	go func() {
@@ -611,7 +626,7 @@ func (s *State) Render() error {
 	renderPass.SetBindGroup(0, s.bindGroup, nil)
 	renderPass.SetIndexBuffer(s.indexBuf, wgpu.IndexFormat_Uint16, 0, wgpu.WholeSize)
 	renderPass.SetVertexBuffer(0, s.vertexBuf, 0, wgpu.WholeSize)
-	renderPass.DrawIndexed(uint32(len(indexData)), uint32(numPlayers), 0, 0, 0)
+	renderPass.DrawIndexed(uint32(len(indexData)), uint32(numInstances), 0, 0, 0)
 	renderPass.End()
 
 	cmdBuffer, err := encoder.Finish(nil)
@@ -635,6 +650,10 @@ func (s *State) Destroy() {
 		s.pipeline.Release()
 		s.pipeline = nil
 	}
+	if s.textureView != nil {
+		s.textureView.Release()
+		s.textureView = nil
+	}
 	if s.uniformBuf != nil {
 		s.uniformBuf.Release()
 		s.uniformBuf = nil
@@ -678,19 +697,21 @@ func (s *State) Destroy() {
 
 }
 
-type Message struct {
-	Client int
-	Data   Player
-}
-
 func main() {
+	parseFlags()
+	if *headless {
+		runHeadless()
+		return
+	}
+
 	if err := glfw.Init(); err != nil {
 		panic(err)
 	}
 	defer glfw.Terminate()
 
+	const title = "go-webgpu with glfw"
 	glfw.WindowHint(glfw.ClientAPI, glfw.NoAPI)
-	window, err := glfw.CreateWindow(640, 480, "go-webgpu with glfw", nil, nil)
+	window, err := glfw.CreateWindow(640, 480, title, nil, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -702,18 +723,62 @@ func main() {
 	}
 	defer s.Destroy()
 
+	// Client()
+	session := newSession(&s.camera)
+	defer session.Close()
+	client := &session.client
+	chatLog := &session.chatLog
+	inputs := openInputs()
+	defer inputs.Close()
+	devAssets := openDevAssets(true)
+	defer devAssets.Close()
+
 	mouseX, mouseY := float32(0), float32(0)
+	look := s.camera.Rotation
 	window.SetInputMode(glfw.CursorMode, glfw.CursorDisabled)
 	window.SetCursorPosCallback(func(w *glfw.Window, xpos, ypos float64) {
 		mouseX += (float32(xpos) - float32(s.config.Width)/2) / 10
 		mouseY -= (float32(ypos) - float32(s.config.Height)/2) / 10
 		rotx := glm.QuatRotate(mouseY/100, &glm.Vec3{1, 0, 0})
 		roty := glm.QuatRotate(-mouseX/100, &glm.Vec3{0, 1, 0})
-		s.camera.Rotation = roty.Mul(&rotx)
+		look = roty.Mul(&rotx)
 	})
 
 	keys := map[glfw.Key]bool{}
+	flying := session.StartFlying()
 	window.SetKeyCallback(func(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+		if chatLog.IsOpen() {
+			if action == glfw.Press || action == glfw.Repeat {
+				switch key {
+				case glfw.KeyEnter:
+					if message := chatLog.Submit(); message != nil {
+						client.Send(message)
+					}
+					w.SetTitle(title)
+				case glfw.KeyEscape:
+					chatLog.Close()
+					w.SetTitle(title)
+				case glfw.KeyBackspace:
+					chatLog.Backspace()
+					w.SetTitle("> " + chatLog.Input())
+				}
+			}
+			return
+		}
+		if session.player != nil && action == glfw.Press && replayControl(session.player, key) {
+			return
+		}
+		if key == glfw.KeyF && action == glfw.Press {
+			flying = !flying
+			return
+		}
+		if key == glfw.KeyEnter && action == glfw.Press {
+			clear(keys)
+			chatLog.Open()
+			w.SetTitle("> ")
+			return
+		}
+
 		if action == glfw.Press || action == glfw.Repeat {
 			keys[key] = true
 		}
@@ -723,6 +788,13 @@ func main() {
 		}
 	})
 
+	window.SetCharCallback(func(w *glfw.Window, char rune) {
+		if chatLog.IsOpen() {
+			chatLog.Type(char)
+			w.SetTitle("> " + chatLog.Input())
+		}
+	})
+
 	window.SetSizeCallback(func(w *glfw.Window, width, height int) {
 		s.Resize(width, height)
 	})
@@ -738,59 +810,13 @@ func main() {
 			{
 				_avg := float32(avg) / float32(frames)
 				fps := float32(time.Second) / _avg
-				fmt.Println("FPS:", fps)
+				session.logStats(fps)
 				frames = 0
 				avg = 0
 			}
 		}
 	}()
 
-	// Client()
-	client := Client{}
-	client.init()
-	go client.Recv(func(s []byte) {
-
-		mNumPlayers := int(s[0])
-		if mNumPlayers == 0 {
-			return
-		}
-		// mplayers := make([]*Message, mNumPlayers)
-		println("Num Players:", mNumPlayers)
-		// s = s[1:]
-		messages := unsafe.Slice((*Message)(unsafe.Pointer(&s[1])), mNumPlayers)
-		// for i := 0; i < mNumPlayers; i++ {
-		// 	message := &messages[i]
-		// 	mplayers[i] = message
-		// }
-		// message := (*Message)(unsafe.Pointer(&s[0]))
-		// id := message.Client
-		mu.Lock()
-		for _, message := range messages {
-			id := message.Client
-			players[id] = message.Data
-			fmt.Printf("Received: %d, Position: %v, Rotation: %v\n", id, players[id].Position, players[id].Rotation)
-
-		}
-		// players[id] = message.Data
-		// fmt.Printf("Received: %d, Position: %v, Rotation: %v\n", id, players[id].Position, players[id].Rotation)
-		mu.Unlock()
-		// // println("Received:", s)
-		// id := 0
-		// position := glm.Vec3{}
-		// rotation := glm.Quat{}
-		// // println(s)
-		// _, err := fmt.Sscanf(s, "%d, [%v %v %v], {%v [%v %v %v]}", &id, &position[0], &position[1], &position[2], &rotation.W, &rotation.V[0], &rotation.V[1], &rotation.V[2])
-		// // println("scanned")
-		// // _, err := fmt.Sscanf(s, "%d, %d, %v", &id, &position, &rotation)
-		// if err != nil {
-		// 	fmt.Println("Error:", err)
-		// }
-		// mu.Lock()
-		// players[id] = Player{Position: position, Rotation: rotation}
-		// fmt.Printf("Received: %d, Position: %v, Rotation: %v\n", id, players[id].Position, players[id].Rotation)
-		// mu.Unlock()
-	})
-
 	last_time := time.Now()
 	for !window.ShouldClose() {
 		frames++
@@ -801,70 +827,34 @@ func main() {
 
 		// println("dt:", dt)
 		glfw.PollEvents()
+		devAssets.Reload(session, s.createPipeline)
 
-		move := glm.Vec3{0, 0, 0}
+		live := Input{Rotation: look, Jump: keys[glfw.KeySpace], Fly: flying}
 		if keys[glfw.KeyW] {
-			move = move.Add(&glm.Vec3{0, 0, -0.1})
+			live.Move[2]--
 		}
 		if keys[glfw.KeyS] {
-			move = move.Add(&glm.Vec3{0, 0, 0.1})
+			live.Move[2]++
 		}
 		if keys[glfw.KeyA] {
-			move = move.Add(&glm.Vec3{-0.1, 0, 0})
+			live.Move[0]--
 		}
 		if keys[glfw.KeyD] {
-			move = move.Add(&glm.Vec3{0.1, 0, 0})
+			live.Move[0]++
 		}
 		if keys[glfw.KeyQ] {
-			move = move.Add(&glm.Vec3{0, -0.1, 0})
+			live.Move[1]--
 		}
 		if keys[glfw.KeyE] {
-			move = move.Add(&glm.Vec3{0, 0.1, 0})
+			live.Move[1]++
 		}
-		move = move.Mul(float32(dt) * 500.0)
-		move = s.camera.Rotation.Rotate(&move)
-		s.camera.Position = s.camera.Position.Add(&move)
-		player := Player{Position: s.camera.Position, Rotation: s.camera.Rotation}
-		message := (*[unsafe.Sizeof(player)]byte)(unsafe.Pointer(&player))
-		newMessage := append([]byte{0}, message[:]...)
-		client.Send(newMessage)
-		// client.Send(fmt.Sprintf("%v, %v", s.camera.Position, s.camera.Rotation))
-
-		// if keys[glfw.KeyT] {
-		// 	client.Send("Hello")
-		// }
+		dt, input, _ := inputs.Next(dt, live)
+		session.Update(dt, input)
 
-		// model := make([][16]float32, 1)
-		axis := glm.Vec3{0, 1, 0}
-		axis = glm.NormalizeVec3(axis)
-		wg := sync.WaitGroup{}
-
-		for a := range numThreads {
-			wg.Add(1)
-			go func() {
-				start := a * len(model) / numThreads
-				end := (a + 1) * len(model) / numThreads
-				for i := start; i < end; i++ {
-					rotation := glm.HomogRotate3D(float32(dt), &axis)
-					translation := glm.Translate3D(0, 0, float32(dt)*5.0)
-					m := glm.Mat4(model[i])
-					m = m.Mul4(&rotation)
-					model[i] = m.Mul4(&translation)
-				}
-				wg.Done()
-			}()
-		}
-		wg.Wait()
-
-		// for i := range model {
-		// 	rotation := glm.HomogRotate3D(float32(dt)*0.1, &axis)
-		// 	m := glm.Mat4(model[i])
-		// 	model[i] = m.Mul4(&rotation)
-		// }
-		err := s.Render()
+		err := s.Render(session.World)
 		window.SetCursorPos(float64(s.config.Width)/2, float64(s.config.Height)/2)
 		if err != nil {
-			fmt.Println("error occured while rendering:", err)
+			slog.Error("error occured while rendering", "err", err)
 
 			errstr := err.Error()
 			switch {
@@ -0,0 +1,10 @@
+//go:build headless
+
+package main
+
+// Built with the headless tag the client does not link glfw or wgpu, so it
+// builds and runs on machines without a display, GPU or their libraries.
+func main() {
+	parseFlags()
+	runHeadless()
+}
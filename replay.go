@@ -0,0 +1,38 @@
+//go:build !headless
+
+package main
+
+import (
+	"log/slog"
+	"time"
+	"wgpu_server/replay"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// replaySeek is how far the arrow keys seek in a replay.
+const replaySeek = 5 * time.Second
+
+// replayControl handles the replay keys: space pauses, left and right seek,
+// up and down change the speed and home restarts. It reports whether key was
+// one of them.
+func replayControl(player *replay.Player, key glfw.Key) bool {
+	switch key {
+	case glfw.KeySpace:
+		player.SetPaused(!player.Paused())
+	case glfw.KeyLeft:
+		player.Seek(player.Position() - replaySeek)
+	case glfw.KeyRight:
+		player.Seek(player.Position() + replaySeek)
+	case glfw.KeyUp:
+		player.SetSpeed(min(player.Speed()*2, 16))
+	case glfw.KeyDown:
+		player.SetSpeed(max(player.Speed()/2, 1.0/16))
+	case glfw.KeyHome:
+		player.Seek(0)
+	default:
+		return false
+	}
+	slog.Info("replay", "position", player.Position().Round(time.Millisecond), "speed", player.Speed(), "paused", player.Paused())
+	return true
+}
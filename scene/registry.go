@@ -0,0 +1,107 @@
+package scene
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go_wgpu/ecs"
+	"go_wgpu/transform"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// component is a registered component type, with functions to read and
+// write it without knowing the type.
+type component struct {
+	name string
+	typ  reflect.Type
+	save func(w *ecs.World, e ecs.Entity) (json.RawMessage, bool, error)
+	load func(w *ecs.World, e ecs.Entity, data json.RawMessage) error
+}
+
+var (
+	registryMu sync.RWMutex
+	byName     = map[string]*component{}
+	byType     = map[reflect.Type]*component{}
+)
+
+func init() {
+	Register[transform.Transform]("transform")
+	Register[Mesh]("mesh")
+	Register[Material]("material")
+}
+
+// Register makes components of type T saveable under name. T is written
+// with encoding/json, so only its exported fields are saved, and loading
+// rejects fields T does not have. It panics if the name or the type is
+// already registered.
+func Register[T any](name string) {
+	t := reflect.TypeFor[T]()
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := byName[name]; ok {
+		panic("scene: component " + name + " registered twice")
+	}
+	if c, ok := byType[t]; ok {
+		panic("scene: " + t.String() + " already registered as " + c.name)
+	}
+	c := &component{
+		name: name,
+		typ:  t,
+		save: func(w *ecs.World, e ecs.Entity) (json.RawMessage, bool, error) {
+			value := ecs.Get[T](w, e)
+			if value == nil {
+				return nil, false, nil
+			}
+			data, err := json.Marshal(value)
+			return data, true, err
+		},
+		load: func(w *ecs.World, e ecs.Entity, data json.RawMessage) error {
+			var value T
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&value); err != nil {
+				return err
+			}
+			ecs.Add(w, e, value)
+			return nil
+		},
+	}
+	byName[name] = c
+	byType[t] = c
+}
+
+// Registered returns the names of the registered component types, sorted.
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookup(name string) (*component, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	c, ok := byName[name]
+	if !ok {
+		return nil, errors.New("unknown component")
+	}
+	return c, nil
+}
+
+// components returns the registered component types in name order.
+func components() []*component {
+	names := Registered()
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	list := make([]*component, len(names))
+	for i, name := range names {
+		list[i] = byName[name]
+	}
+	return list
+}
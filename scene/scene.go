@@ -0,0 +1,245 @@
+// Package scene saves entities and their components to JSON files and
+// spawns them back, so levels can be written by hand instead of in code.
+//
+// A scene file lists entities by an id local to the file. Each has a
+// parent id, 0 for none, and its components keyed by the name their type
+// was registered under. Missing transform fields take their defaults:
+//
+//	{
+//	  "version": 1,
+//	  "entities": [
+//	    {"id": 1, "components": {
+//	      "mesh": {"name":"cube"},
+//	      "transform": {"position":[0,0,-10]}
+//	    }},
+//	    {"id": 2, "parent": 1, "components": {
+//	      "transform": {"position":[0,2,0],"scale":[0.5,0.5,0.5]}
+//	    }}
+//	  ]
+//	}
+package scene
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go_wgpu/ecs"
+	"go_wgpu/transform"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Version is written to every scene. Scenes from newer versions are
+// refused.
+const Version = 1
+
+// Mesh refers to a mesh asset by name.
+type Mesh struct {
+	Name string `json:"name"`
+}
+
+// Material refers to a material asset by name.
+type Material struct {
+	Name string `json:"name"`
+}
+
+// Scene is the contents of a scene file.
+type Scene struct {
+	Version  int      `json:"version"`
+	Entities []Entity `json:"entities"`
+}
+
+type Entity struct {
+	ID         int                        `json:"id"`
+	Parent     int                        `json:"parent,omitempty"`
+	Components map[string]json.RawMessage `json:"components"`
+}
+
+// Capture describes entities and their registered components as a scene.
+// A parent that is not among entities is left out, making its children
+// roots.
+func Capture(w *ecs.World, entities []ecs.Entity) (*Scene, error) {
+	ids := make(map[ecs.Entity]int, len(entities))
+	for i, e := range entities {
+		ids[e] = i + 1
+	}
+	types := components()
+	s := &Scene{Version: Version, Entities: make([]Entity, 0, len(entities))}
+	for i, e := range entities {
+		entity := Entity{ID: i + 1, Components: make(map[string]json.RawMessage)}
+		if t := ecs.Get[transform.Transform](w, e); t != nil {
+			entity.Parent = ids[t.Parent()]
+		}
+		for _, c := range types {
+			data, ok, err := c.save(w, e)
+			if err != nil {
+				return nil, fmt.Errorf("scene: entity %d: %s: %w", entity.ID, c.name, err)
+			}
+			if ok {
+				entity.Components[c.name] = data
+			}
+		}
+		s.Entities = append(s.Entities, entity)
+	}
+	return s, nil
+}
+
+// Spawn spawns the scene's entities into w and returns them in scene
+// order. On error nothing is spawned.
+func (s *Scene) Spawn(w *ecs.World) ([]ecs.Entity, error) {
+	if s.Version > Version {
+		return nil, fmt.Errorf("scene: version %d is newer than %d", s.Version, Version)
+	}
+	if s.Version < 1 {
+		return nil, fmt.Errorf("scene: missing version")
+	}
+	spawned := make([]ecs.Entity, 0, len(s.Entities))
+	ids := make(map[int]ecs.Entity, len(s.Entities))
+	fail := func(err error) ([]ecs.Entity, error) {
+		for _, e := range spawned {
+			w.Despawn(e)
+		}
+		return nil, err
+	}
+	for _, entity := range s.Entities {
+		if entity.ID <= 0 {
+			return fail(fmt.Errorf("scene: entity ids must be positive, got %d", entity.ID))
+		}
+		if _, ok := ids[entity.ID]; ok {
+			return fail(fmt.Errorf("scene: duplicate entity id %d", entity.ID))
+		}
+		e := w.Spawn()
+		spawned = append(spawned, e)
+		ids[entity.ID] = e
+		for name, data := range entity.Components {
+			c, err := lookup(name)
+			if err == nil {
+				err = c.load(w, e, data)
+			}
+			if err != nil {
+				return fail(fmt.Errorf("scene: entity %d: %s: %w", entity.ID, name, err))
+			}
+		}
+	}
+	for _, entity := range s.Entities {
+		if entity.Parent == 0 {
+			continue
+		}
+		parent, ok := ids[entity.Parent]
+		if !ok {
+			return fail(fmt.Errorf("scene: entity %d: unknown parent %d", entity.ID, entity.Parent))
+		}
+		if err := setParent(w, ids[entity.ID], parent); err != nil {
+			return fail(fmt.Errorf("scene: entity %d: %w", entity.ID, err))
+		}
+	}
+	return spawned, nil
+}
+
+// setParent is transform.SetParent, returning its panics as errors since
+// scenes come from files.
+func setParent(w *ecs.World, child, parent ecs.Entity) (err error) {
+	if !ecs.Has[transform.Transform](w, child) || !ecs.Has[transform.Transform](w, parent) {
+		return fmt.Errorf("parent links need a transform on both entities")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	transform.SetParent(w, child, parent)
+	return nil
+}
+
+// Write writes the scene as JSON with one component per line.
+func (s *Scene) Write(out io.Writer) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "{\n  \"version\": %d,\n  \"entities\": [", s.Version)
+	for i, entity := range s.Entities {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(&buf, "\n    {\"id\": %d", entity.ID)
+		if entity.Parent != 0 {
+			fmt.Fprintf(&buf, ", \"parent\": %d", entity.Parent)
+		}
+		buf.WriteString(", \"components\": {")
+		names := make([]string, 0, len(entity.Components))
+		for name := range entity.Components {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for j, name := range names {
+			if j > 0 {
+				buf.WriteString(",")
+			}
+			key, _ := json.Marshal(name)
+			fmt.Fprintf(&buf, "\n      %s: ", key)
+			if err := json.Compact(&buf, entity.Components[name]); err != nil {
+				return fmt.Errorf("scene: entity %d: %s: %w", entity.ID, name, err)
+			}
+		}
+		buf.WriteString("\n    }}")
+	}
+	buf.WriteString("\n  ]\n}\n")
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+// Read reads a scene written by Write or by hand. Unknown fields are
+// errors, to catch typos.
+func Read(in io.Reader) (*Scene, error) {
+	decoder := json.NewDecoder(in)
+	decoder.DisallowUnknownFields()
+	s := &Scene{}
+	if err := decoder.Decode(s); err != nil {
+		return nil, fmt.Errorf("scene: %w", err)
+	}
+	return s, nil
+}
+
+// Save writes entities to path, replacing the previous file only once the
+// new one is completely written.
+func Save(path string, w *ecs.World, entities []ecs.Entity) error {
+	s, err := Capture(w, entities)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := s.Write(&buf); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load spawns the scene at path into w.
+func Load(path string, w *ecs.World) ([]ecs.Entity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	entities, err := s.Spawn(w)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entities, nil
+}
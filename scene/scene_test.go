@@ -0,0 +1,163 @@
+package scene
+
+import (
+	"bytes"
+	"go_wgpu/ecs"
+	"go_wgpu/transform"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/EngoEngine/glm"
+)
+
+// health is a component registered by the test, to check scenes carry
+// types beyond the built in ones.
+type health struct {
+	Points int     `json:"points"`
+	Regen  float32 `json:"regen"`
+}
+
+func init() {
+	Register[health]("health")
+}
+
+// panics reports whether fn panics.
+func panics(fn func()) (panicked bool) {
+	defer func() { panicked = recover() != nil }()
+	fn()
+	return false
+}
+
+func TestSaveLoad(t *testing.T) {
+	w := ecs.NewWorld()
+	root := w.Spawn()
+	rotation := glm.QuatRotate(0.5, &glm.Vec3{0, 1, 0})
+	rootTransform := transform.New(glm.Vec3{1, 2, 3}, rotation)
+	rootTransform.SetScale(glm.Vec3{2, 2, 2})
+	ecs.Add(w, root, rootTransform)
+	ecs.Add(w, root, Mesh{Name: "cube"})
+	ecs.Add(w, root, Material{Name: "stone"})
+	child := w.Spawn()
+	ecs.Add(w, child, transform.New(glm.Vec3{0, 1, 0}, glm.QuatIdent()))
+	ecs.Add(w, child, health{Points: 30, Regen: 1.5})
+	transform.SetParent(w, child, root)
+	bare := w.Spawn()
+
+	path := filepath.Join(t.TempDir(), "level.json")
+	if err := Save(path, w, []ecs.Entity{root, child, bare}); err != nil {
+		t.Fatal(err)
+	}
+	loaded := ecs.NewWorld()
+	entities, err := Load(path, loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entities) != 3 || loaded.Len() != 3 {
+		t.Fatalf("loaded %d entities into a world of %d, want 3", len(entities), loaded.Len())
+	}
+	root, child, bare = entities[0], entities[1], entities[2]
+
+	rt := ecs.Get[transform.Transform](loaded, root)
+	if rt == nil {
+		t.Fatal("root lost its transform")
+	}
+	if p, s := rt.Position(), rt.Scale(); p != (glm.Vec3{1, 2, 3}) || s != (glm.Vec3{2, 2, 2}) {
+		t.Errorf("root at %v scaled %v, want [1 2 3] and [2 2 2]", p, s)
+	}
+	if r := rt.Rotation(); !r.OrientationEqualThreshold(&rotation, 1e-6) {
+		t.Errorf("root rotated %v, want %v", r, rotation)
+	}
+	if m := ecs.Get[Mesh](loaded, root); m == nil || m.Name != "cube" {
+		t.Errorf("root mesh is %v, want cube", m)
+	}
+	if m := ecs.Get[Material](loaded, root); m == nil || m.Name != "stone" {
+		t.Errorf("root material is %v, want stone", m)
+	}
+
+	ct := ecs.Get[transform.Transform](loaded, child)
+	if ct == nil || ct.Parent() != root {
+		t.Fatal("child is not parented to root")
+	}
+	if h := ecs.Get[health](loaded, child); h == nil || *h != (health{Points: 30, Regen: 1.5}) {
+		t.Errorf("child health is %v, want {30 1.5}", h)
+	}
+	if ecs.Has[Mesh](loaded, child) {
+		t.Error("child gained a mesh")
+	}
+	for _, name := range Registered() {
+		c, _ := lookup(name)
+		if _, ok, _ := c.save(loaded, bare); ok {
+			t.Errorf("bare entity gained %s", name)
+		}
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	w := ecs.NewWorld()
+	e := w.Spawn()
+	ecs.Add(w, e, Mesh{Name: "cube"})
+	ecs.Add(w, e, health{Points: 5})
+	s, err := Capture(w, []ecs.Entity{e})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first, second bytes.Buffer
+	if err := s.Write(&first); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(bytes.NewReader(first.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := read.Write(&second); err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != second.String() {
+		t.Errorf("rewritten scene\n%s\nwant\n%s", second.String(), first.String())
+	}
+}
+
+func TestSpawnErrors(t *testing.T) {
+	for _, test := range []struct {
+		name, scene, want string
+	}{
+		{"newer version", `{"version": 2, "entities": []}`, "newer"},
+		{"missing version", `{"entities": []}`, "missing version"},
+		{"unknown component", `{"version": 1, "entities": [{"id": 1, "components": {"sound": {}}}]}`, "unknown component"},
+		{"unknown field", `{"version": 1, "entities": [{"id": 1, "components": {"mesh": {"nmae": "cube"}}}]}`, "unknown field"},
+		{"duplicate id", `{"version": 1, "entities": [{"id": 1, "components": {}}, {"id": 1, "components": {}}]}`, "duplicate entity id"},
+		{"unknown parent", `{"version": 1, "entities": [{"id": 1, "parent": 2, "components": {"transform": {}}}]}`, "unknown parent"},
+		{"parent without transform", `{"version": 1, "entities": [{"id": 1, "components": {}}, {"id": 2, "parent": 1, "components": {"transform": {}}}]}`, "need a transform"},
+		{"cycle", `{"version": 1, "entities": [{"id": 1, "parent": 2, "components": {"transform": {}}}, {"id": 2, "parent": 1, "components": {"transform": {}}}]}`, "scene: entity"},
+	} {
+		s, err := Read(strings.NewReader(test.scene))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		w := ecs.NewWorld()
+		if _, err := s.Spawn(w); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want one mentioning %q", test.name, err, test.want)
+		}
+		if w.Len() != 0 {
+			t.Errorf("%s: a failed spawn left %d entities", test.name, w.Len())
+		}
+	}
+	if _, err := Read(strings.NewReader(`{"version": 1, "entites": []}`)); err == nil {
+		t.Error("Read accepted a misspelt field")
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	if !panics(func() { Register[struct{ X int }]("health") }) {
+		t.Error("registering a second type as health did not panic")
+	}
+	if !panics(func() { Register[health]("hp") }) {
+		t.Error("registering health under a second name did not panic")
+	}
+	for _, name := range Registered() {
+		if name == "hp" {
+			t.Error("a refused registration was kept")
+		}
+	}
+}
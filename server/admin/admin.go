@@ -0,0 +1,236 @@
+// Package admin runs operator commands against a running server, from the
+// terminal or over HTTP.
+package admin
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"wgpu_server/chat"
+	"wgpu_server/game"
+	"wgpu_server/ws"
+)
+
+const help = `Commands:
+  list                  connected players
+  kick <id>             disconnect a player
+  ban <id>              disconnect a player and refuse their address
+  unban <host>          accept an address again
+  teleport <id> x y z   move a player
+  tickrate <hz>         change the simulation rate
+  say <msg>             send a chat line to everyone
+  status                server summary
+  help                  this text`
+
+var started = time.Now()
+
+// States of a command queued by Run.
+const (
+	queued int32 = iota
+	running
+	cancelled
+)
+
+// Run executes line on the server's Poll goroutine and returns its output.
+// It blocks until the next tick, or until timeout if Poll is not running, in
+// which case the command is cancelled and never runs.
+func Run(server *ws.Server, line string, timeout time.Duration) string {
+	var state atomic.Int32
+	done := make(chan string, 1)
+	server.Do(func() {
+		if state.CompareAndSwap(queued, running) {
+			done <- Execute(server, line)
+		}
+	})
+	select {
+	case out := <-done:
+		return out
+	case <-time.After(timeout):
+		if state.CompareAndSwap(queued, cancelled) {
+			return "timed out waiting for the simulation tick, the command was not run"
+		}
+		// The tick started running it just now.
+		return <-done
+	}
+}
+
+// Execute runs a single command. It must be called on the Poll goroutine,
+// as Run does.
+func Execute(server *ws.Server, line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	command, args := fields[0], fields[1:]
+	switch command {
+	case "list":
+		return list(server)
+	case "kick", "ban":
+		id, err := playerArg(args)
+		if err != nil {
+			return err.Error()
+		}
+		host := server.Addr(id)
+		if !server.Kick(id) {
+			return fmt.Sprintf("player %d is not connected", id)
+		}
+		if command == "kick" {
+			return fmt.Sprintf("kicked player %d", id)
+		}
+		if host == "" {
+			return fmt.Sprintf("kicked player %d; in-process clients cannot be banned", id)
+		}
+		server.Ban(host)
+		return fmt.Sprintf("banned player %d (%s)", id, host)
+	case "unban":
+		if len(args) != 1 {
+			return "usage: unban <host>"
+		}
+		if !server.Unban(args[0]) {
+			return args[0] + " is not banned"
+		}
+		return "unbanned " + args[0]
+	case "teleport":
+		return teleport(server, args)
+	case "tickrate":
+		if len(args) != 1 {
+			return "usage: tickrate <hz>"
+		}
+		hz, err := strconv.ParseFloat(args[0], 64)
+		fastest := float64(time.Second / ws.MinTickRate)
+		if err != nil || hz <= 0 || hz > fastest {
+			return fmt.Sprintf("tick rate must be between 0 and %g Hz", fastest)
+		}
+		server.SetTickRate(time.Duration(float64(time.Second) / hz))
+		return fmt.Sprintf("tick rate set to %g Hz", hz)
+	case "say":
+		text := chat.Sanitize(strings.Join(args, " "))
+		if text == "" {
+			return "usage: say <msg>"
+		}
+		server.WriteMessage(-1, chat.Encode(chat.System, -1, text))
+		return "sent"
+	case "status":
+		return status(server)
+	case "help":
+		return help
+	}
+	return "unknown command " + command + "\n" + help
+}
+
+func playerArg(args []string) (int, error) {
+	if len(args) < 1 {
+		return 0, fmt.Errorf("missing player id")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid player id %q", args[0])
+	}
+	return id, nil
+}
+
+func list(server *ws.Server) string {
+	ids := server.Clients()
+	if len(ids) == 0 {
+		return "no players connected"
+	}
+	sort.Ints(ids)
+	var b strings.Builder
+	for _, id := range ids {
+		server.Lock.Lock()
+		player := ws.Players[id]
+		server.Lock.Unlock()
+		addr := server.Addr(id)
+		if addr == "" {
+			addr = "local"
+		}
+		fmt.Fprintf(&b, "%d\t%s\troom=%s\trtt=%v\tpos=%v\n", id, addr, game.Chat.Room(id), server.RTT(id), player.Position)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func teleport(server *ws.Server, args []string) string {
+	if len(args) != 4 {
+		return "usage: teleport <id> x y z"
+	}
+	id, err := playerArg(args)
+	if err != nil {
+		return err.Error()
+	}
+	server.Lock.Lock()
+	player, ok := ws.Players[id]
+	server.Lock.Unlock()
+	if !ok {
+		return fmt.Sprintf("player %d is not connected", id)
+	}
+	for i, arg := range args[1:] {
+		v, err := strconv.ParseFloat(arg, 32)
+		if err != nil {
+			return fmt.Sprintf("invalid coordinate %q", arg)
+		}
+		player.Position[i] = float32(v)
+	}
+	if err := player.Validate(); err != nil {
+		return "position is out of bounds"
+	}
+	server.Lock.Lock()
+	ws.Players[id] = player
+	server.Lock.Unlock()
+	server.WriteMessage(id, ws.EncodeTeleport(player.Position))
+	return fmt.Sprintf("teleported player %d to %v", id, player.Position)
+}
+
+func status(server *ws.Server) string {
+	return fmt.Sprintf("uptime %v, tick %d at %.1f Hz, %d players, %d B in, %d B out",
+		time.Since(started).Round(time.Second),
+		server.Tick(),
+		float64(time.Second)/float64(server.TickRate()),
+		len(server.Clients()),
+		server.Stats.WireIn.Load(),
+		server.Stats.WireOut.Load(),
+	)
+}
+
+// Console reads commands line by line from r and writes their output to w
+// until r is exhausted.
+func Console(server *ws.Server, r io.Reader, w io.Writer) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if out := Run(server, scanner.Text(), 5*time.Second); out != "" {
+			fmt.Fprintln(w, out)
+		}
+	}
+}
+
+// Handler serves commands posted as the request body, authorized by a
+// bearer token. An empty token disables the handler.
+func Handler(server *ws.Server, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		auth, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !bearer || subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintln(w, Run(server, string(body), 5*time.Second))
+	})
+}
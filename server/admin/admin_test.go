@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"wgpu_server/game"
+)
+
+func TestRunTimeoutCancels(t *testing.T) {
+	server := game.NewServer()
+	out := Run(server, "tickrate 10", 10*time.Millisecond)
+	if !strings.Contains(out, "not run") {
+		t.Fatalf("Run without a tick returned %q", out)
+	}
+
+	// The cancelled command is still queued in front of the next one, and
+	// must not change the tick rate when the tick drains it.
+	go server.Poll(5*time.Millisecond, func() {})
+	if out := Run(server, "help", time.Second); out != help {
+		t.Fatalf("Run returned %q", out)
+	}
+	if rate := server.TickRate(); rate != 5*time.Millisecond {
+		t.Errorf("cancelled command ran, tick rate is %v", rate)
+	}
+}
+
+func TestHandlerRequiresBearer(t *testing.T) {
+	handler := Handler(game.NewServer(), "secret")
+	for _, test := range []struct {
+		auth string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Basic secret", http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/admin", strings.NewReader("status"))
+		if test.auth != "" {
+			r.Header.Set("Authorization", test.auth)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.want {
+			t.Errorf("Authorization %q: status %d, want %d", test.auth, w.Code, test.want)
+		}
+	}
+
+	// The right token gets as far as the method check.
+	r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Bearer secret: status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,274 @@
+// Package character moves a player's capsule through a collision world:
+// walking with gravity, jumping, sliding along walls and stepping up onto
+// ledges, or flying through everything.
+//
+// The controller is kinematic: nothing pushes it, it only stops at or slides
+// along what it runs into.
+package character
+
+import (
+	"math"
+	"wgpu_server/collision"
+	"wgpu_server/physics"
+
+	"github.com/EngoEngine/glm"
+)
+
+// up is the direction opposite gravity; the controller always stands
+// upright along it.
+var up = glm.Vec3{0, 1, 0}
+
+const (
+	// skin is how far the capsule keeps from what it touches, so the next
+	// cast does not start overlapping it.
+	skin = 0.01
+	// maxSlides is how many surfaces one movement can slide along.
+	maxSlides = 4
+	// maxPushes is how many times an overlap is pushed out of per frame.
+	maxPushes = 4
+	// groundProbe is how far below the feet ground is still stood on.
+	groundProbe = 0.05
+)
+
+// Controller is a character standing upright as a capsule.
+type Controller struct {
+	Position glm.Vec3 // bottom of the capsule
+	Velocity glm.Vec3 // units per second
+
+	Radius float32
+	Height float32 // from the bottom of the capsule to its top
+	// StepHeight is the highest ledge walked onto without jumping.
+	StepHeight float32
+	// MaxSlope is the cosine of the steepest slope that can be stood on.
+	MaxSlope float32
+
+	Speed     float32 // units per second
+	FlySpeed  float32
+	JumpSpeed float32 // upwards speed at the start of a jump
+	Gravity   float32 // downwards acceleration, units per second squared
+	// MaxFallSpeed is the fastest the controller falls, 0 for no limit. New
+	// sets it to about the terminal velocity of a falling person.
+	MaxFallSpeed float32
+
+	// Flying moves freely in every direction, through colliders and without
+	// gravity.
+	Flying bool
+
+	grounded bool
+	ground   glm.Vec3 // normal of the ground stood on
+}
+
+// New returns a controller standing at position, sized like a person.
+func New(position glm.Vec3) Controller {
+	return Controller{
+		Position:     position,
+		Radius:       0.4,
+		Height:       1.8,
+		StepHeight:   0.4,
+		MaxSlope:     float32(math.Cos(50 * math.Pi / 180)),
+		Speed:        10,
+		FlySpeed:     50,
+		JumpSpeed:    6,
+		Gravity:      -physics.Gravity[1],
+		MaxFallSpeed: 55,
+	}
+}
+
+// Capsule returns the controller's collision shape.
+func (c *Controller) Capsule() collision.Capsule {
+	return c.capsuleAt(c.Position)
+}
+
+func (c *Controller) capsuleAt(position glm.Vec3) collision.Capsule {
+	a, b := position, position
+	a.AddScaledVec(c.Radius, &up)
+	b.AddScaledVec(max(c.Height-c.Radius, c.Radius), &up)
+	return collision.Capsule{A: a, B: b, Radius: c.Radius}
+}
+
+// Grounded reports whether the controller stood on walkable ground after
+// its last move.
+func (c *Controller) Grounded() bool {
+	return c.grounded
+}
+
+// Ground returns the normal of the ground stood on, or zero in the air.
+func (c *Controller) Ground() glm.Vec3 {
+	if !c.grounded {
+		return glm.Vec3{}
+	}
+	return c.ground
+}
+
+// Move advances the controller by dt seconds. When walking, wish is the
+// horizontal direction to walk in, its length the fraction of Speed, and
+// jump starts a jump if the controller is on the ground. When flying, wish
+// is the movement in every direction, as a fraction of FlySpeed, and jump is
+// ignored. Shapes of world for which skip returns true are walked through;
+// skip may be nil.
+func (c *Controller) Move(world *collision.World, wish glm.Vec3, jump bool, dt float32, skip func(p collision.Proxy) bool) {
+	if c.Flying {
+		c.Position.AddScaledVec(c.FlySpeed*dt, &wish)
+		c.Velocity, c.grounded = glm.Vec3{}, false
+		return
+	}
+	c.depenetrate(world, skip)
+
+	horizontal := flatten(wish)
+	horizontal.MulWith(c.Speed)
+	vertical := c.Velocity.Dot(&up)
+	if c.grounded && jump {
+		vertical, c.grounded = c.JumpSpeed, false
+	}
+	if c.grounded {
+		vertical = 0
+	} else {
+		vertical -= c.Gravity * dt
+		if c.MaxFallSpeed > 0 {
+			vertical = max(vertical, -c.MaxFallSpeed)
+		}
+	}
+	c.Velocity = horizontal
+	c.Velocity.AddScaledVec(vertical, &up)
+
+	c.walk(world, horizontal.Mul(dt), skip)
+	start := c.Position
+	c.Position = c.slide(world, c.Position, up.Mul(vertical*dt), skip)
+	moved := c.Position.Sub(&start)
+	if vertical*dt != 0 && math.Abs(float64(moved.Dot(&up))) < math.Abs(float64(vertical*dt))-skin {
+		// Landed on something or hit a ceiling.
+		c.Velocity.AddScaledVec(-vertical, &up)
+	}
+
+	probe := float32(groundProbe)
+	if c.grounded && vertical <= 0 {
+		// Stay on the ground walking down stairs and slopes.
+		probe = c.StepHeight
+	}
+	c.findGround(world, probe, skip)
+}
+
+// walk moves the controller horizontally by delta, stepping up onto what
+// it runs into if that gets it further.
+func (c *Controller) walk(world *collision.World, delta glm.Vec3, skip func(p collision.Proxy) bool) {
+	if delta == (glm.Vec3{}) {
+		return
+	}
+	flat := c.slide(world, c.Position, delta, skip)
+	target := c.Position.Add(&delta)
+	short := target.Sub(&flat)
+	if !c.grounded || c.StepHeight <= 0 || short.Len() < skin {
+		c.Position = flat
+		return
+	}
+
+	// Lift, move, then put the capsule back down, and keep the result if it
+	// ends on walkable ground further along than sliding did.
+	lifted := c.slide(world, c.Position, up.Mul(c.StepHeight), skip)
+	stepped := c.slide(world, lifted, delta, skip)
+	rise := lifted.Sub(&c.Position)
+	drop := rise.Dot(&up)
+	_, hit, ok := world.Cast(c.capsuleAt(stepped), up.Mul(-drop), skip)
+	if !ok || hit.Normal.Dot(&up) < c.MaxSlope {
+		c.Position = flat
+		return
+	}
+	landed := stepped
+	landed.AddScaledVec(-drop*hit.Distance, &up)
+	if horizontalDistance(landed, c.Position) > horizontalDistance(flat, c.Position)+skin {
+		c.Position = landed
+		c.Position.AddScaledVec(skin, &up)
+	} else {
+		c.Position = flat
+	}
+}
+
+// slide moves the capsule from position by delta, and whenever it runs into
+// something carries on with what is left of delta along that surface. It
+// returns where the capsule ends up.
+func (c *Controller) slide(world *collision.World, position, delta glm.Vec3, skip func(p collision.Proxy) bool) glm.Vec3 {
+	var normals [maxSlides]glm.Vec3
+	for i := range maxSlides {
+		l := delta.Len()
+		if l < 1e-6 {
+			break
+		}
+		_, hit, ok := world.Cast(c.capsuleAt(position), delta, skip)
+		if !ok {
+			return position.Add(&delta)
+		}
+		t := max(hit.Distance-skin/l, 0)
+		position.AddScaledVec(t, &delta)
+
+		normal := hit.Normal
+		if c.grounded && normal.Dot(&up) < c.MaxSlope && delta.Dot(&up) <= 0 {
+			// Walls and steep slopes stop the walk, they are not climbed.
+			if flat := flatten(normal); flat.Len() > 1e-6 {
+				normal = flat.Normalized()
+			}
+		}
+		normals[i] = normal
+		delta.MulWith(1 - t)
+		delta.AddScaledVec(-delta.Dot(&normal), &normal)
+		// Running into a crease between two surfaces leaves only the
+		// direction along it.
+		for _, n := range normals[:i] {
+			if delta.Dot(&n) < 0 {
+				crease := n.Cross(&normal)
+				if crease.Len() > 1e-6 {
+					crease.Normalize()
+					delta = crease.Mul(delta.Dot(&crease))
+				} else {
+					delta = glm.Vec3{}
+				}
+				break
+			}
+		}
+	}
+	return position
+}
+
+// findGround looks for walkable ground within probe below the feet, and
+// puts the controller on it if there is.
+func (c *Controller) findGround(world *collision.World, probe float32, skip func(p collision.Proxy) bool) {
+	c.grounded = false
+	if c.Velocity.Dot(&up) > 0 {
+		return
+	}
+	_, hit, ok := world.Cast(c.Capsule(), up.Mul(-(probe + skin)), skip)
+	if !ok || hit.Normal.Dot(&up) < c.MaxSlope {
+		return
+	}
+	c.grounded, c.ground = true, hit.Normal
+	drop := max((probe+skin)*hit.Distance-skin, 0)
+	c.Position.AddScaledVec(-drop, &up)
+	c.Velocity = flatten(c.Velocity)
+}
+
+// depenetrate pushes the capsule out of whatever it overlaps, which it can
+// after a teleport or when a collider moves into it.
+func (c *Controller) depenetrate(world *collision.World, skip func(p collision.Proxy) bool) {
+	for range maxPushes {
+		var push glm.Vec3
+		world.Overlaps(c.Capsule(), skip, func(p collision.Proxy, m *collision.Manifold) {
+			if depth := m.Depth(); depth > 0 {
+				push.AddScaledVec(-(depth + skin), &m.Normal)
+			}
+		})
+		if push == (glm.Vec3{}) {
+			return
+		}
+		c.Position.AddWith(&push)
+	}
+}
+
+// flatten returns v without its component along up.
+func flatten(v glm.Vec3) glm.Vec3 {
+	v.AddScaledVec(-v.Dot(&up), &up)
+	return v
+}
+
+func horizontalDistance(a, b glm.Vec3) float32 {
+	d := flatten(a.Sub(&b))
+	return d.Len()
+}
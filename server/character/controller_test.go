@@ -0,0 +1,292 @@
+package character
+
+import (
+	"math"
+	"testing"
+	"wgpu_server/collision"
+
+	"github.com/EngoEngine/glm"
+)
+
+func TestFallSpeedCapped(t *testing.T) {
+	var empty collision.World
+	c := New(glm.Vec3{0, 100, 0})
+	for range 600 {
+		c.Move(&empty, glm.Vec3{}, false, 1.0/60, nil)
+		if -c.Velocity[1] > c.MaxFallSpeed {
+			t.Fatalf("falling at %v, faster than %v", -c.Velocity[1], c.MaxFallSpeed)
+		}
+	}
+	if -c.Velocity[1] != c.MaxFallSpeed {
+		t.Errorf("falling at %v after ten seconds, want %v", -c.Velocity[1], c.MaxFallSpeed)
+	}
+}
+
+func TestLandsOnGround(t *testing.T) {
+	var world collision.World
+	world.Add(collision.AABB{Min: glm.Vec3{-10, -1, -10}, Max: glm.Vec3{10, 0, 10}})
+	c := New(glm.Vec3{0, 5, 0})
+	for range 120 {
+		c.Move(&world, glm.Vec3{}, false, 1.0/60, nil)
+	}
+	if !c.Grounded() || c.Position[1] < 0 || c.Position[1] > 0.05 {
+		t.Errorf("at %v, grounded %v, want standing on the ground", c.Position, c.Grounded())
+	}
+	if c.Velocity != (glm.Vec3{}) {
+		t.Errorf("velocity %v on the ground", c.Velocity)
+	}
+}
+
+const frame = 1.0 / 60
+
+// floor returns a world with a floor whose top is at height 0.
+func floor() *collision.World {
+	var world collision.World
+	world.Add(collision.AABB{Min: glm.Vec3{-50, -1, -50}, Max: glm.Vec3{50, 0, 50}})
+	return &world
+}
+
+// run moves c for a number of frames, walking by wish.
+func run(c *Controller, world *collision.World, wish glm.Vec3, frames int) {
+	for range frames {
+		c.Move(world, wish, false, frame, nil)
+	}
+}
+
+// depth returns how deep c's capsule is in the deepest shape it overlaps.
+func depth(c *Controller, world *collision.World) float32 {
+	var deepest float32
+	world.Overlaps(c.Capsule(), nil, func(p collision.Proxy, m *collision.Manifold) {
+		deepest = max(deepest, m.Depth())
+	})
+	return deepest
+}
+
+// ramp returns a world with a slope rising at angle degrees towards +x,
+// its surface above the origin.
+func ramp(angle float64) *collision.World {
+	var world collision.World
+	rotation := glm.QuatRotate(float32(angle*math.Pi/180), &glm.Vec3{0, 0, 1})
+	world.Add(collision.OBB{HalfExtents: glm.Vec3{20, 1, 20}, Rotation: rotation})
+	return &world
+}
+
+func TestWallSlide(t *testing.T) {
+	world := floor()
+	world.Add(collision.AABB{Min: glm.Vec3{2, 0, -50}, Max: glm.Vec3{3, 5, 50}})
+	c := New(glm.Vec3{0, 0, 0})
+	wish := glm.Vec3{1, 0, 1}
+	wish.Normalize()
+	for range 60 {
+		c.Move(world, wish, false, frame, nil)
+		if d := depth(&c, world); d > 2*skin {
+			t.Fatalf("%v deep in the wall at %v", d, c.Position)
+		}
+	}
+	// Blocked along x, the walk carries on along z.
+	if x := c.Position[0]; x > 2-c.Radius || x < 2-c.Radius-0.05 {
+		t.Errorf("stopped at x %v, want against the wall at %v", x, 2-c.Radius)
+	}
+	if z := c.Position[2]; z < 6 {
+		t.Errorf("slid to z %v along the wall, want about %v", z, c.Speed*wish[2])
+	}
+	if !c.Grounded() || math.Abs(float64(c.Position[1])) > 0.05 {
+		t.Errorf("at %v, grounded %v, want walking on the floor", c.Position, c.Grounded())
+	}
+}
+
+func TestCorner(t *testing.T) {
+	// Two walls meet at an acute angle at x 5 ahead. Walking straight into
+	// them slides into the corner and stops there, inside neither.
+	world := floor()
+	for _, side := range []float32{-1, 1} {
+		// Mirrored about z 0, each wall runs back from the crease with its
+		// inner face on the line through it.
+		rotation := glm.QuatRotate(-side*math.Pi/6, &glm.Vec3{0, 1, 0})
+		along, out := rotation.Rotate(&glm.Vec3{1, 0, 0}), rotation.Rotate(&glm.Vec3{0, 0, -side})
+		center := glm.Vec3{5, 2, 0}
+		center.AddScaledVec(-5, &along)
+		center.AddScaledVec(0.5, &out)
+		world.Add(collision.OBB{Center: center, HalfExtents: glm.Vec3{5, 2, 0.5}, Rotation: rotation})
+	}
+	c := New(glm.Vec3{-2, 0, 0.3})
+	for range 180 {
+		c.Move(world, glm.Vec3{1, 0, 0}, false, frame, nil)
+		if d := depth(&c, world); d > 2*skin {
+			t.Fatalf("%v deep in a wall at %v", d, c.Position)
+		}
+	}
+	// The capsule touches both walls Radius/sin(30°) short of the crease.
+	if want := 5 - 2*c.Radius; math.Abs(float64(c.Position[0]-want)) > 0.1 {
+		t.Errorf("stopped at %v, want in the corner at x %v", c.Position, want)
+	}
+	if math.Abs(float64(c.Position[2])) > 0.1 {
+		t.Errorf("stopped at %v, off the corner at z 0", c.Position)
+	}
+	before := c.Position
+	run(&c, world, glm.Vec3{1, 0, 0}, 30)
+	if moved := c.Position.Sub(&before); moved.Len() > 0.01 {
+		t.Errorf("still moving by %v in the corner", moved)
+	}
+}
+
+func TestCreaseSlide(t *testing.T) {
+	// A gully between two walls too steep to stand on, its bottom rising
+	// gently towards -z. Walking up it slides along the crease where the
+	// walls meet instead of bouncing between them.
+	var world collision.World
+	tilt := glm.QuatRotate(0.2, &glm.Vec3{1, 0, 0})
+	for _, side := range []float32{-1, 1} {
+		wall := glm.QuatRotate(side*math.Pi/3, &glm.Vec3{0, 0, 1})
+		rotation := tilt.Mul(&wall)
+		top, across := rotation.Rotate(&glm.Vec3{0, 1, 0}), rotation.Rotate(&glm.Vec3{1, 0, 0})
+		var center glm.Vec3
+		center.AddScaledVec(-1, &top)
+		center.AddScaledVec(side*10, &across)
+		world.Add(collision.OBB{Center: center, HalfExtents: glm.Vec3{10, 1, 30}, Rotation: rotation})
+	}
+	c := New(glm.Vec3{0, 3, 0})
+	for range 60 {
+		c.Move(&world, glm.Vec3{0, 0, -1}, false, frame, nil)
+		if d := depth(&c, &world); d > 2*skin {
+			t.Fatalf("%v deep in a wall at %v", d, c.Position)
+		}
+	}
+	if c.Position[2] > -9 || math.Abs(float64(c.Position[0])) > 0.01 {
+		t.Errorf("walked up the gully to %v, want about %v along the crease", c.Position, glm.Vec3{0, 2, -c.Speed})
+	}
+}
+
+func TestStepUp(t *testing.T) {
+	for _, test := range []struct {
+		height float32
+		climbs bool
+	}{
+		{0.3, true},
+		{0.6, false},
+	} {
+		world := floor()
+		world.Add(collision.AABB{Min: glm.Vec3{1, 0, -50}, Max: glm.Vec3{50, test.height, 50}})
+		c := New(glm.Vec3{0, 0, 0})
+		run(&c, world, glm.Vec3{1, 0, 0}, 60)
+		if d := depth(&c, world); d > 2*skin {
+			t.Errorf("ledge %v: %v deep in it at %v", test.height, d, c.Position)
+		}
+		onLedge := c.Position[0] > 3 && math.Abs(float64(c.Position[1]-test.height)) < 0.05
+		if test.climbs && !onLedge {
+			t.Errorf("at %v, want on the ledge %v high, under the step height %v", c.Position, test.height, c.StepHeight)
+		}
+		if !test.climbs && (c.Position[0] > 1-c.Radius || math.Abs(float64(c.Position[1])) > 0.05) {
+			t.Errorf("at %v, want stopped before the ledge %v high, over the step height %v", c.Position, test.height, c.StepHeight)
+		}
+		if !c.Grounded() {
+			t.Errorf("ledge %v: not grounded at %v", test.height, c.Position)
+		}
+	}
+}
+
+func TestJump(t *testing.T) {
+	world := floor()
+	c := New(glm.Vec3{0, 0, 0})
+	run(&c, world, glm.Vec3{}, 5)
+	c.Move(world, glm.Vec3{}, true, frame, nil)
+	if c.Grounded() || c.Velocity[1] <= 0 {
+		t.Fatalf("jumping left the controller grounded %v, rising at %v", c.Grounded(), c.Velocity[1])
+	}
+	var top float32
+	for i := range 120 {
+		// Jumping again in the air does nothing.
+		rising := c.Velocity[1]
+		c.Move(world, glm.Vec3{}, true, frame, nil)
+		if !c.Grounded() && c.Velocity[1] > rising {
+			t.Fatalf("frame %d: jumped again in the air", i)
+		}
+		top = max(top, c.Position[1])
+		if c.Grounded() {
+			break
+		}
+	}
+	// v²/2g for the default jump.
+	want := c.JumpSpeed * c.JumpSpeed / (2 * c.Gravity)
+	if math.Abs(float64(top-want)) > 0.1 {
+		t.Errorf("jumped %v high, want about %v", top, want)
+	}
+	if !c.Grounded() || math.Abs(float64(c.Position[1])) > 0.05 {
+		t.Errorf("at %v after the jump, grounded %v, want back on the floor", c.Position, c.Grounded())
+	}
+}
+
+func TestSlopes(t *testing.T) {
+	// A gentle slope is stood on without sliding down it.
+	c := New(glm.Vec3{0, 5, 0})
+	world := ramp(30)
+	run(&c, world, glm.Vec3{}, 120)
+	if !c.Grounded() {
+		t.Fatalf("not grounded at %v on a 30 degree slope", c.Position)
+	}
+	before := c.Position
+	run(&c, world, glm.Vec3{}, 60)
+	if moved := c.Position.Sub(&before); moved.Len() > 0.01 {
+		t.Errorf("slid %v down a 30 degree slope", moved)
+	}
+
+	// One steeper than MaxSlope is not ground: the controller slides down.
+	c = New(glm.Vec3{0, 5, 0})
+	world = ramp(60)
+	run(&c, world, glm.Vec3{}, 60)
+	before = c.Position
+	for range 60 {
+		c.Move(world, glm.Vec3{}, false, frame, nil)
+		if c.Grounded() {
+			t.Fatalf("grounded at %v on a 60 degree slope", c.Position)
+		}
+	}
+	if c.Position[1] > before[1]-0.5 || c.Position[0] > before[0] {
+		t.Errorf("moved from %v to %v, want sliding down the slope", before, c.Position)
+	}
+	// Nor can it be walked up.
+	c = New(glm.Vec3{-4, 0, 0})
+	world = ramp(60)
+	world.Add(collision.AABB{Min: glm.Vec3{-50, -1, -50}, Max: glm.Vec3{50, 0, 50}})
+	run(&c, world, glm.Vec3{1, 0, 0}, 120)
+	if c.Position[1] > c.StepHeight+0.05 {
+		t.Errorf("walked up a 60 degree slope to %v", c.Position)
+	}
+}
+
+func TestDepenetrate(t *testing.T) {
+	var world collision.World
+	wall := world.Add(collision.AABB{Min: glm.Vec3{0, 0, -5}, Max: glm.Vec3{1, 3, 5}})
+	c := New(glm.Vec3{-0.2, 0.5, 0})
+	if depth(&c, &world) < 0.1 {
+		t.Fatal("the test capsule does not overlap the wall")
+	}
+	skipped := c
+	skipped.depenetrate(&world, func(p collision.Proxy) bool { return p == wall })
+	if skipped.Position != c.Position {
+		t.Errorf("pushed out of a skipped shape to %v", skipped.Position)
+	}
+	c.depenetrate(&world, nil)
+	if d := depth(&c, &world); d > 0 {
+		t.Errorf("still %v deep at %v", d, c.Position)
+	}
+	if want := -c.Radius - skin; math.Abs(float64(c.Position[0]-want)) > 0.01 || c.Position[1] != 0.5 {
+		t.Errorf("pushed to %v, want straight out to x %v", c.Position, want)
+	}
+}
+
+func TestFlyThroughSolids(t *testing.T) {
+	world := floor()
+	world.Add(collision.AABB{Min: glm.Vec3{2, 0, -50}, Max: glm.Vec3{3, 5, 50}})
+	c := New(glm.Vec3{0, 1, 0})
+	c.Flying = true
+	run(&c, world, glm.Vec3{1, 0, 0}, 30)
+	if want := c.FlySpeed * 30 * frame; math.Abs(float64(c.Position[0]-want)) > 1e-3 || c.Position[1] != 1 {
+		t.Errorf("flew to %v, want through the wall to x %v at the same height", c.Position, want)
+	}
+	// And down through the floor, without gravity.
+	run(&c, world, glm.Vec3{0, -1, 0}, 6)
+	if c.Position[1] >= -1 || c.Velocity != (glm.Vec3{}) {
+		t.Errorf("flew down to %v at %v, want below the floor", c.Position, c.Velocity)
+	}
+}
@@ -0,0 +1,202 @@
+// Package chat relays text messages between players, to everyone, to the
+// players in a room, or to a single player.
+package chat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"wgpu_server/ws"
+)
+
+// Kind is who a chat line was sent to.
+type Kind byte
+
+const (
+	Global Kind = iota
+	Room
+	Whisper
+	System
+)
+
+// MaxLength is the most runes a chat line may contain after sanitizing.
+const MaxLength = 200
+
+const DefaultRoom = "lobby"
+
+// systemSender is the sender id of lines sent by the server itself.
+const systemSender = -1
+
+const help = "Commands: /r <text> to your room, /w <id> <text> to a player, /join <room>, /room, /help"
+
+// Chat tracks each player's room and chat rate limit. It is used from the
+// server's Poll goroutine only.
+type Chat struct {
+	Limit    ws.RateLimit
+	rooms    map[int]string
+	limiters map[int]*ws.Limiter
+}
+
+func New() *Chat {
+	return &Chat{
+		Limit:    ws.RateLimit{PerSecond: 1, Burst: 5},
+		rooms:    make(map[int]string),
+		limiters: make(map[int]*ws.Limiter),
+	}
+}
+
+// Handle sanitizes a line from client id, then runs it as a command or
+// relays it to everyone.
+func (c *Chat) Handle(server *ws.Server, id int, text []byte) error {
+	line := Sanitize(string(text))
+	if line == "" {
+		return nil
+	}
+	limiter, ok := c.limiters[id]
+	if !ok {
+		limiter = ws.NewLimiter(c.Limit)
+		c.limiters[id] = limiter
+	}
+	if ok, _ := limiter.Allow(time.Now()); !ok {
+		server.WriteMessage(id, Encode(System, systemSender, "You are sending messages too quickly."))
+		return nil
+	}
+
+	slog.Debug("chat", "client", id, "tick", server.Tick(), "room", c.Room(id), "line", line)
+	if !strings.HasPrefix(line, "/") {
+		server.WriteMessage(-1, Encode(Global, id, line))
+		return nil
+	}
+	command, args, _ := strings.Cut(line[1:], " ")
+	switch command {
+	case "r":
+		if args == "" {
+			server.WriteMessage(id, Encode(System, systemSender, "Usage: /r <text>"))
+			return nil
+		}
+		for _, member := range c.members(server, c.Room(id)) {
+			server.WriteMessage(member, Encode(Room, id, args))
+		}
+	case "w":
+		target, text, _ := strings.Cut(args, " ")
+		to, err := strconv.Atoi(target)
+		if err != nil || text == "" {
+			server.WriteMessage(id, Encode(System, systemSender, "Usage: /w <id> <text>"))
+			return nil
+		}
+		server.Lock.Lock()
+		_, online := ws.Players[to]
+		server.Lock.Unlock()
+		if !online {
+			server.WriteMessage(id, Encode(System, systemSender, fmt.Sprintf("Player %d is not online.", to)))
+			return nil
+		}
+		server.WriteMessage(to, Encode(Whisper, id, text))
+		if to != id {
+			server.WriteMessage(id, Encode(Whisper, id, text))
+		}
+	case "join":
+		if args == "" {
+			server.WriteMessage(id, Encode(System, systemSender, "Usage: /join <room>"))
+			return nil
+		}
+		c.rooms[id] = args
+		server.WriteMessage(id, Encode(System, systemSender, "Joined room "+args+"."))
+	case "room":
+		server.WriteMessage(id, Encode(System, systemSender, "You are in room "+c.Room(id)+"."))
+	case "help":
+		server.WriteMessage(id, Encode(System, systemSender, help))
+	default:
+		server.WriteMessage(id, Encode(System, systemSender, "Unknown command /"+command+". "+help))
+	}
+	return nil
+}
+
+// Room returns the room client id is in.
+func (c *Chat) Room(id int) string {
+	if room, ok := c.rooms[id]; ok {
+		return room
+	}
+	return DefaultRoom
+}
+
+// SetRoom moves client id into room.
+func (c *Chat) SetRoom(id int, room string) {
+	c.rooms[id] = room
+}
+
+// Leave forgets client id when it disconnects.
+func (c *Chat) Leave(id int) {
+	delete(c.rooms, id)
+	delete(c.limiters, id)
+}
+
+// members returns the ids of online players in room.
+func (c *Chat) members(server *ws.Server, room string) []int {
+	var ids []int
+	server.Lock.Lock()
+	for id := range ws.Players {
+		if c.Room(id) == room {
+			ids = append(ids, id)
+		}
+	}
+	server.Lock.Unlock()
+	sort.Ints(ids)
+	return ids
+}
+
+// Sanitize drops invalid UTF-8 and control characters, collapses runs of
+// whitespace and truncates the result to MaxLength runes.
+func Sanitize(text string) string {
+	text = strings.ToValidUTF8(text, "")
+	var b strings.Builder
+	n := 0
+	space := false
+	for _, r := range text {
+		if n == MaxLength {
+			break
+		}
+		if unicode.IsSpace(r) {
+			space = b.Len() > 0
+			continue
+		}
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			continue
+		}
+		if space {
+			b.WriteRune(' ')
+			n++
+			space = false
+			if n == MaxLength {
+				break
+			}
+		}
+		b.WriteRune(r)
+		n++
+	}
+	return b.String()
+}
+
+// Encode builds a chat line sent by the server to clients.
+func Encode(kind Kind, from int, text string) []byte {
+	b := []byte{ws.ServerChat, byte(kind)}
+	b = binary.LittleEndian.AppendUint32(b, uint32(int32(from)))
+	return append(b, text...)
+}
+
+// Decode reads a chat line built by Encode.
+func Decode(b []byte) (kind Kind, from int, text string, err error) {
+	if len(b) < 6 || b[0] != ws.ServerChat {
+		return 0, 0, "", ws.ErrLength
+	}
+	if Kind(b[1]) > System {
+		return 0, 0, "", ws.ErrInvalid
+	}
+	from = int(int32(binary.LittleEndian.Uint32(b[2:])))
+	return Kind(b[1]), from, string(b[6:]), nil
+}
@@ -0,0 +1,203 @@
+package chat
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+	"wgpu_server/ws"
+)
+
+func FuzzDecode(f *testing.F) {
+	f.Add(Encode(Room, 3, "hello"))
+	f.Add(Encode(Whisper, -1, ""))
+	f.Add(Encode(System, systemSender, help))
+	f.Add([]byte{ws.ServerChat, 200, 0, 0, 0, 0})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		kind, from, text, err := Decode(b)
+		if err != nil {
+			return
+		}
+		if again := Encode(kind, from, text); !bytes.Equal(again, b) {
+			t.Fatalf("%d from %d %q encodes as %x, decoded from %x", kind, from, text, again, b)
+		}
+	})
+}
+
+func TestSanitize(t *testing.T) {
+	for _, test := range []struct{ in, want string }{
+		{"hello", "hello"},
+		{"  hello \t\n world  ", "hello world"},
+		{"bell\a and\x00 nul", "bell and nul"},
+		{"esc\x1b[31mred", "esc[31mred"},
+		{"zero\u200bwidth", "zerowidth"},
+		{"bad \xff\xfe utf8", "bad utf8"},
+		{"caf\xc3", "caf"},
+		{"héllo wörld", "héllo wörld"},
+		{"\n\t ", ""},
+	} {
+		if got := Sanitize(test.in); got != test.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+
+	long := Sanitize(strings.Repeat("é", 2*MaxLength))
+	if n := utf8.RuneCountInString(long); n != MaxLength || !utf8.ValidString(long) {
+		t.Errorf("a long line sanitized to %d runes, valid %v, want %d", n, utf8.ValidString(long), MaxLength)
+	}
+	// A space falling on the limit is dropped rather than left trailing.
+	edge := Sanitize(strings.Repeat("a", MaxLength-1) + " b")
+	if utf8.RuneCountInString(edge) > MaxLength || strings.HasSuffix(edge, "b") {
+		t.Errorf("sanitized to %q, want cut at %d runes", edge, MaxLength)
+	}
+}
+
+// sent is a message written by the server.
+type sent struct {
+	to   int
+	kind Kind
+	from int
+	text string
+}
+
+// outbox is a ws.Recorder keeping the chat lines a server sends.
+type outbox struct {
+	t    *testing.T
+	sent []sent
+}
+
+func (o *outbox) RecordIn(uint64, int, []byte) {}
+
+func (o *outbox) RecordOut(_ uint64, client int, message []byte) {
+	kind, from, text, err := Decode(message)
+	if err != nil {
+		o.t.Errorf("sent %x: %v", message, err)
+		return
+	}
+	o.sent = append(o.sent, sent{client, kind, from, text})
+}
+
+// take returns the lines sent since the last call.
+func (o *outbox) take() []sent {
+	s := o.sent
+	o.sent = nil
+	return s
+}
+
+// online makes players with ids online for the test.
+func online(t *testing.T, ids ...int) {
+	saved := ws.Players
+	t.Cleanup(func() { ws.Players = saved })
+	ws.Players = make(map[int]ws.PlayerData)
+	for _, id := range ids {
+		ws.Players[id] = ws.PlayerData{}
+	}
+}
+
+func newChat(t *testing.T) (*Chat, *ws.Server, *outbox) {
+	server := ws.NewServer(nil)
+	out := &outbox{t: t}
+	server.Recorder = out
+	c := New()
+	c.Limit = ws.RateLimit{PerSecond: 1, Burst: 100}
+	return c, server, out
+}
+
+func say(t *testing.T, c *Chat, server *ws.Server, id int, line string) {
+	t.Helper()
+	if err := c.Handle(server, id, []byte(line)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRouting(t *testing.T) {
+	online(t, 1, 2, 3)
+	c, server, out := newChat(t)
+
+	say(t, c, server, 1, "  hi\x00 all ")
+	if got, want := out.take(), []sent{{-1, Global, 1, "hi all"}}; !slices.Equal(got, want) {
+		t.Errorf("global line sent %v, want %v", got, want)
+	}
+	say(t, c, server, 1, " \t")
+	if got := out.take(); len(got) != 0 {
+		t.Errorf("an empty line sent %v", got)
+	}
+
+	say(t, c, server, 1, "/join red")
+	say(t, c, server, 3, "/join red")
+	if got := out.take(); len(got) != 2 || got[0] != (sent{1, System, systemSender, "Joined room red."}) {
+		t.Errorf("joining sent %v", got)
+	}
+	if c.Room(1) != "red" || c.Room(2) != DefaultRoom {
+		t.Errorf("rooms %q and %q, want red and %q", c.Room(1), c.Room(2), DefaultRoom)
+	}
+	say(t, c, server, 3, "/r to the room")
+	if got, want := out.take(), []sent{{1, Room, 3, "to the room"}, {3, Room, 3, "to the room"}}; !slices.Equal(got, want) {
+		t.Errorf("room line sent %v, want %v", got, want)
+	}
+	say(t, c, server, 2, "/r lonely")
+	if got, want := out.take(), []sent{{2, Room, 2, "lonely"}}; !slices.Equal(got, want) {
+		t.Errorf("room line in the lobby sent %v, want %v", got, want)
+	}
+
+	say(t, c, server, 2, "/w 3 psst there")
+	if got, want := out.take(), []sent{{3, Whisper, 2, "psst there"}, {2, Whisper, 2, "psst there"}}; !slices.Equal(got, want) {
+		t.Errorf("whisper sent %v, want %v", got, want)
+	}
+	say(t, c, server, 2, "/w 2 note to self")
+	if got, want := out.take(), []sent{{2, Whisper, 2, "note to self"}}; !slices.Equal(got, want) {
+		t.Errorf("whisper to self sent %v, want %v", got, want)
+	}
+
+	// Leaving forgets the room.
+	c.Leave(1)
+	if c.Room(1) != DefaultRoom {
+		t.Errorf("after leaving, client 1 is in %q", c.Room(1))
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	online(t, 1, 2)
+	c, server, out := newChat(t)
+	for line, want := range map[string]string{
+		"/w 9 hello":   "Player 9 is not online.",
+		"/w two hello": "Usage: /w <id> <text>",
+		"/w 2":         "Usage: /w <id> <text>",
+		"/r":           "Usage: /r <text>",
+		"/join":        "Usage: /join <room>",
+		"/room":        "You are in room " + DefaultRoom + ".",
+		"/help":        help,
+		"/dance":       "Unknown command /dance. " + help,
+	} {
+		say(t, c, server, 1, line)
+		if got := out.take(); !slices.Equal(got, []sent{{1, System, systemSender, want}}) {
+			t.Errorf("%q sent %v, want %q to the sender", line, got, want)
+		}
+	}
+}
+
+func TestChatRateLimit(t *testing.T) {
+	online(t, 1, 2)
+	c, server, out := newChat(t)
+	c.Limit = ws.RateLimit{PerSecond: 0.001, Burst: 3}
+	for i := range 5 {
+		say(t, c, server, 1, fmt.Sprint("line ", i))
+	}
+	got := out.take()
+	if len(got) != 5 || got[2].kind != Global || got[3] != (sent{1, System, systemSender, "You are sending messages too quickly."}) {
+		t.Errorf("five quick lines sent %v, want three then a warning", got)
+	}
+	// The limit is per client.
+	say(t, c, server, 2, "still fine")
+	if got := out.take(); len(got) != 1 || got[0].kind != Global {
+		t.Errorf("another client's line sent %v", got)
+	}
+	// Leaving resets it.
+	c.Leave(1)
+	say(t, c, server, 1, "back")
+	if got := out.take(); len(got) != 1 || got[0].kind != Global {
+		t.Errorf("a returning client's line sent %v", got)
+	}
+}
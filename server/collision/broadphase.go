@@ -0,0 +1,113 @@
+package collision
+
+// Proxy identifies a box in a Broadphase or a shape in a World. Proxies of
+// removed entries are reused.
+type Proxy int32
+
+// Broadphase finds overlapping boxes by sweep and prune: boxes are kept
+// sorted by their lowest X, so only boxes whose X ranges overlap are
+// compared. Boxes move little between frames, so the order is restored
+// with an insertion sort that is close to linear.
+type Broadphase struct {
+	bounds []AABB
+	used   []bool
+	free   []Proxy
+	order  []Proxy // used proxies by bounds.Min[0], ties by proxy
+	sorted bool
+}
+
+func (b *Broadphase) Add(bounds AABB) Proxy {
+	var p Proxy
+	if n := len(b.free); n > 0 {
+		p = b.free[n-1]
+		b.free = b.free[:n-1]
+		b.bounds[p], b.used[p] = bounds, true
+	} else {
+		p = Proxy(len(b.bounds))
+		b.bounds = append(b.bounds, bounds)
+		b.used = append(b.used, true)
+	}
+	b.order = append(b.order, p)
+	b.sorted = false
+	return p
+}
+
+func (b *Broadphase) Update(p Proxy, bounds AABB) {
+	b.bounds[p] = bounds
+	b.sorted = false
+}
+
+func (b *Broadphase) Remove(p Proxy) {
+	if !b.used[p] {
+		return
+	}
+	b.used[p] = false
+	b.free = append(b.free, p)
+	for i, q := range b.order {
+		if q == p {
+			b.order = append(b.order[:i], b.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (b *Broadphase) Bounds(p Proxy) AABB {
+	return b.bounds[p]
+}
+
+func (b *Broadphase) Len() int {
+	return len(b.order)
+}
+
+func (b *Broadphase) less(p, q Proxy) bool {
+	x, y := b.bounds[p].Min[0], b.bounds[q].Min[0]
+	return x < y || x == y && p < q
+}
+
+func (b *Broadphase) sort() {
+	if b.sorted {
+		return
+	}
+	for i := 1; i < len(b.order); i++ {
+		p := b.order[i]
+		j := i
+		for ; j > 0 && b.less(p, b.order[j-1]); j-- {
+			b.order[j] = b.order[j-1]
+		}
+		b.order[j] = p
+	}
+	b.sorted = true
+}
+
+// Pairs calls fn for every pair of overlapping boxes, the lower proxy
+// first. The order of the calls depends only on the boxes and on the order
+// they were added and removed in.
+func (b *Broadphase) Pairs(fn func(a, b Proxy)) {
+	b.sort()
+	for i, p := range b.order {
+		box := b.bounds[p]
+		for _, q := range b.order[i+1:] {
+			other := b.bounds[q]
+			if other.Min[0] > box.Max[0] {
+				break
+			}
+			if box.Overlaps(other) {
+				fn(min(p, q), max(p, q))
+			}
+		}
+	}
+}
+
+// Query calls fn for every box overlapping bounds, in X order.
+func (b *Broadphase) Query(bounds AABB, fn func(p Proxy)) {
+	b.sort()
+	for _, p := range b.order {
+		box := b.bounds[p]
+		if box.Min[0] > bounds.Max[0] {
+			break
+		}
+		if box.Overlaps(bounds) {
+			fn(p)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package collision
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/EngoEngine/glm"
+)
+
+func randomBox(r *rand.Rand) AABB {
+	var b AABB
+	for i := range 3 {
+		b.Min[i] = r.Float32()*40 - 20
+		b.Max[i] = b.Min[i] + r.Float32()*4
+	}
+	return b
+}
+
+// brutePairs returns every overlapping pair of live proxies, the lower
+// first, compared against each other directly.
+func brutePairs(bounds map[Proxy]AABB) [][2]Proxy {
+	var pairs [][2]Proxy
+	for p, a := range bounds {
+		for q, b := range bounds {
+			if p < q && a.Overlaps(b) {
+				pairs = append(pairs, [2]Proxy{p, q})
+			}
+		}
+	}
+	return pairs
+}
+
+func comparePairs(a, b [2]Proxy) int {
+	if a[0] != b[0] {
+		return int(a[0] - b[0])
+	}
+	return int(a[1] - b[1])
+}
+
+func TestPairsMatchBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var b Broadphase
+	live := make(map[Proxy]AABB)
+	for round := range 50 {
+		for range 20 {
+			box := randomBox(r)
+			live[b.Add(box)] = box
+		}
+		for p := range live {
+			switch r.Intn(4) {
+			case 0:
+				b.Remove(p)
+				delete(live, p)
+			case 1:
+				box := randomBox(r)
+				b.Update(p, box)
+				live[p] = box
+			case 2:
+				// A small move, as most frames make.
+				box := live[p].Moved(glm.Vec3{r.Float32() - 0.5, 0, r.Float32() - 0.5}).(AABB)
+				b.Update(p, box)
+				live[p] = box
+			}
+		}
+		if b.Len() != len(live) {
+			t.Fatalf("round %d: Len %d, want %d", round, b.Len(), len(live))
+		}
+
+		var got [][2]Proxy
+		b.Pairs(func(p, q Proxy) {
+			if p >= q {
+				t.Fatalf("round %d: pair %d, %d is not lower first", round, p, q)
+			}
+			got = append(got, [2]Proxy{p, q})
+		})
+		want := brutePairs(live)
+		slices.SortFunc(got, comparePairs)
+		slices.SortFunc(want, comparePairs)
+		if !slices.Equal(got, want) {
+			t.Fatalf("round %d: %d pairs, brute force finds %d", round, len(got), len(want))
+		}
+
+		query := randomBox(r)
+		var found []Proxy
+		b.Query(query, func(p Proxy) { found = append(found, p) })
+		var wantFound []Proxy
+		for p, box := range live {
+			if box.Overlaps(query) {
+				wantFound = append(wantFound, p)
+			}
+		}
+		slices.Sort(found)
+		slices.Sort(wantFound)
+		if !slices.Equal(found, wantFound) {
+			t.Fatalf("round %d: Query found %v, want %v", round, found, wantFound)
+		}
+	}
+}
+
+func TestPairsOrder(t *testing.T) {
+	// The same boxes added in the same order give the same calls, however
+	// they moved to get there.
+	r := rand.New(rand.NewSource(2))
+	boxes := make([]AABB, 100)
+	for i := range boxes {
+		boxes[i] = randomBox(r)
+	}
+	var a, b Broadphase
+	for _, box := range boxes {
+		a.Add(box)
+		b.Add(randomBox(r))
+	}
+	b.Pairs(func(p, q Proxy) {})
+	for i, box := range boxes {
+		b.Update(Proxy(i), box)
+	}
+	var fromA, fromB [][2]Proxy
+	a.Pairs(func(p, q Proxy) { fromA = append(fromA, [2]Proxy{p, q}) })
+	b.Pairs(func(p, q Proxy) { fromB = append(fromB, [2]Proxy{p, q}) })
+	if !slices.Equal(fromA, fromB) {
+		t.Error("pairs of the same boxes came in a different order")
+	}
+}
@@ -0,0 +1,415 @@
+package collision
+
+import (
+	"math"
+
+	"github.com/EngoEngine/glm"
+)
+
+// MaxContacts is the most contact points a Manifold holds.
+const MaxContacts = 4
+
+// Contact is a point where two shapes overlap. Point is halfway between the
+// two surfaces, which are Depth apart along the manifold's normal.
+type Contact struct {
+	Point glm.Vec3
+	Depth float32
+}
+
+// Manifold describes how two overlapping shapes touch. Moving the second
+// shape by Normal times the deepest Depth separates them.
+type Manifold struct {
+	Normal   glm.Vec3 // unit length, from the first shape towards the second
+	Contacts [MaxContacts]Contact
+	Count    int
+}
+
+// Points returns the manifold's contacts.
+func (m *Manifold) Points() []Contact {
+	return m.Contacts[:m.Count]
+}
+
+// Depth returns the deepest contact's depth.
+func (m *Manifold) Depth() float32 {
+	var depth float32
+	for _, c := range m.Points() {
+		depth = max(depth, c.Depth)
+	}
+	return depth
+}
+
+func (m *Manifold) add(point glm.Vec3, depth float32) {
+	if m.Count < MaxContacts {
+		m.Contacts[m.Count] = Contact{point, depth}
+		m.Count++
+	}
+}
+
+// Flip swaps the roles of the two shapes.
+func (m *Manifold) Flip() {
+	m.Normal = scale(m.Normal, -1)
+}
+
+// Collide reports whether a and b overlap, and if so how.
+func Collide(a, b Shape) (Manifold, bool) {
+	if box, ok := a.(AABB); ok {
+		a = box.OBB()
+	}
+	if box, ok := b.(AABB); ok {
+		b = box.OBB()
+	}
+	switch a := a.(type) {
+	case Sphere:
+		switch b := b.(type) {
+		case Sphere:
+			return spheres(a.Center, a.Radius, b.Center, b.Radius)
+		case OBB:
+			return sphereBox(a.Center, a.Radius, b)
+		case Capsule:
+			return sphereCapsule(a, b)
+		}
+	case Capsule:
+		switch b := b.(type) {
+		case Sphere:
+			return flipped(sphereCapsule(b, a))
+		case OBB:
+			return capsuleBox(a, b)
+		case Capsule:
+			return capsules(a, b)
+		}
+	case OBB:
+		switch b := b.(type) {
+		case Sphere:
+			return flipped(sphereBox(b.Center, b.Radius, a))
+		case OBB:
+			return boxes(a, b)
+		case Capsule:
+			return flipped(capsuleBox(b, a))
+		}
+	}
+	return Manifold{}, false
+}
+
+func flipped(m Manifold, ok bool) (Manifold, bool) {
+	m.Flip()
+	return m, ok
+}
+
+func spheres(ca glm.Vec3, ra float32, cb glm.Vec3, rb float32) (Manifold, bool) {
+	d := sub(cb, ca)
+	distance := length(d)
+	if distance > ra+rb {
+		return Manifold{}, false
+	}
+	m := Manifold{Normal: glm.Vec3{0, 1, 0}}
+	if distance > 0 {
+		m.Normal = scale(d, 1/distance)
+	}
+	depth := ra + rb - distance
+	m.add(add(ca, scale(m.Normal, ra-depth/2)), depth)
+	return m, true
+}
+
+func sphereCapsule(a Sphere, b Capsule) (Manifold, bool) {
+	closest := lerp(b.A, b.B, closestOnSegment(b.A, b.B, a.Center))
+	return spheres(a.Center, a.Radius, closest, b.Radius)
+}
+
+func capsules(a, b Capsule) (Manifold, bool) {
+	s, t := closestSegments(a.A, a.B, b.A, b.B)
+	return spheres(lerp(a.A, a.B, s), a.Radius, lerp(b.A, b.B, t), b.Radius)
+}
+
+// sphereBox collides a sphere with a box, pushing the sphere out through the
+// nearest face if its center is inside.
+func sphereBox(center glm.Vec3, radius float32, b OBB) (Manifold, bool) {
+	axes := b.axes()
+	c := b.local(&axes, center)
+	q := glm.Vec3{
+		clamp(c[0], -b.HalfExtents[0], b.HalfExtents[0]),
+		clamp(c[1], -b.HalfExtents[1], b.HalfExtents[1]),
+		clamp(c[2], -b.HalfExtents[2], b.HalfExtents[2]),
+	}
+	var m Manifold
+	var surface glm.Vec3 // closest point on the box's surface, local
+	var depth float32
+	if c == q {
+		axis := 0
+		for k := 1; k < 3; k++ {
+			if b.HalfExtents[k]-abs(c[k]) < b.HalfExtents[axis]-abs(c[axis]) {
+				axis = k
+			}
+		}
+		side := float32(1)
+		if c[axis] < 0 {
+			side = -1
+		}
+		surface = c
+		surface[axis] = side * b.HalfExtents[axis]
+		m.Normal = scale(axes[axis], -side)
+		depth = radius + b.HalfExtents[axis] - abs(c[axis])
+	} else {
+		d := sub(q, c)
+		distance := length(d)
+		if distance > radius {
+			return Manifold{}, false
+		}
+		surface = q
+		m.Normal = sub(b.world(&axes, scale(d, 1/distance)), b.Center)
+		depth = radius - distance
+	}
+	onBox := b.world(&axes, surface)
+	m.add(add(onBox, scale(m.Normal, depth/2)), depth)
+	return m, true
+}
+
+// signedDistance returns how far p is outside the box, negative inside.
+func (b OBB) signedDistance(axes *[3]glm.Vec3, p glm.Vec3) float32 {
+	c := b.local(axes, p)
+	var outside glm.Vec3
+	inside := float32(math.Inf(-1))
+	for k := range 3 {
+		q := abs(c[k]) - b.HalfExtents[k]
+		outside[k] = max(q, 0)
+		inside = max(inside, q)
+	}
+	return length(outside) + min(inside, 0)
+}
+
+// capsuleBox finds the point of the capsule's segment deepest in or nearest
+// to the box, and collides a sphere there. The segment's ends add contacts
+// if they touch the box the same way, so a capsule lying on a box rests on
+// two points.
+func capsuleBox(a Capsule, b OBB) (Manifold, bool) {
+	axes := b.axes()
+	// The signed distance to a convex shape is convex along a segment.
+	lo, hi := float32(0), float32(1)
+	for range 32 {
+		t1, t2 := lo+(hi-lo)/3, hi-(hi-lo)/3
+		if b.signedDistance(&axes, lerp(a.A, a.B, t1)) <= b.signedDistance(&axes, lerp(a.A, a.B, t2)) {
+			hi = t2
+		} else {
+			lo = t1
+		}
+	}
+	deepest := lerp(a.A, a.B, (lo+hi)/2)
+	m, ok := sphereBox(deepest, a.Radius, b)
+	if !ok {
+		return m, false
+	}
+	for _, end := range [2]glm.Vec3{a.A, a.B} {
+		if length(sub(end, deepest)) < a.Radius*0.1 {
+			continue
+		}
+		if e, ok := sphereBox(end, a.Radius, b); ok && dot(e.Normal, m.Normal) > 0.95 {
+			m.add(e.Contacts[0].Point, e.Contacts[0].Depth)
+		}
+	}
+	return m, true
+}
+
+// boxes collides two boxes with the separating axis test, then clips the
+// face of one against the other, or for an edge against an edge takes the
+// closest points of the two.
+func boxes(a, b OBB) (Manifold, bool) {
+	axesA, axesB := a.axes(), b.axes()
+	d := sub(b.Center, a.Center)
+	overlap := func(axis glm.Vec3) (float32, glm.Vec3) {
+		var ra, rb float32
+		for k := range 3 {
+			ra += a.HalfExtents[k] * abs(dot(axesA[k], axis))
+			rb += b.HalfExtents[k] * abs(dot(axesB[k], axis))
+		}
+		s := dot(d, axis)
+		if s < 0 {
+			axis = scale(axis, -1)
+		}
+		return ra + rb - abs(s), axis
+	}
+
+	bestA, bestB, bestEdge := float32(math.MaxFloat32), float32(math.MaxFloat32), float32(math.MaxFloat32)
+	var faceA, faceB, edgeA, edgeB int
+	var normalA, normalB, normalEdge glm.Vec3
+	for k := range 3 {
+		o, n := overlap(axesA[k])
+		if o < 0 {
+			return Manifold{}, false
+		}
+		if o < bestA {
+			bestA, faceA, normalA = o, k, n
+		}
+		o, n = overlap(axesB[k])
+		if o < 0 {
+			return Manifold{}, false
+		}
+		if o < bestB {
+			bestB, faceB, normalB = o, k, n
+		}
+	}
+	for i := range 3 {
+		for j := range 3 {
+			axis := cross(axesA[i], axesB[j])
+			l := length(axis)
+			if l < 1e-5 {
+				continue // parallel edges; a face axis separates them
+			}
+			o, n := overlap(scale(axis, 1/l))
+			if o < 0 {
+				return Manifold{}, false
+			}
+			if o < bestEdge {
+				bestEdge, edgeA, edgeB, normalEdge = o, i, j, n
+			}
+		}
+	}
+
+	// Prefer faces, and A's faces, unless another axis is clearly better, so
+	// resting contacts do not flicker between axes.
+	const relative, absolute = 0.95, 0.01
+	var m Manifold
+	switch best := min(bestA, bestB); {
+	case bestEdge < best*relative-absolute:
+		m.Normal = normalEdge
+		edgeContact(&m, a, b, &axesA, &axesB, edgeA, edgeB, bestEdge)
+	case bestB < bestA*relative-absolute:
+		m.Normal = normalB
+		faceContacts(&m, b, a, &axesB, &axesA, faceB, scale(normalB, -1))
+	default:
+		m.Normal = normalA
+		faceContacts(&m, a, b, &axesA, &axesB, faceA, normalA)
+	}
+	if m.Count == 0 {
+		// clipping lost every point to rounding
+		m.add(scale(add(a.Center, b.Center), 0.5), min(bestA, bestB, bestEdge))
+	}
+	return m, true
+}
+
+// polygon is a face being clipped. Clipping a quad by four planes leaves at
+// most eight points.
+type polygon struct {
+	points [8]glm.Vec3
+	n      int
+}
+
+// clip keeps the part of the polygon where dot(normal, p) <= offset.
+func (p *polygon) clip(normal glm.Vec3, offset float32) {
+	var out polygon
+	for i := range p.n {
+		current, next := p.points[i], p.points[(i+1)%p.n]
+		dc, dn := dot(normal, current)-offset, dot(normal, next)-offset
+		if dc <= 0 && out.n < len(out.points) {
+			out.points[out.n] = current
+			out.n++
+		}
+		if (dc < 0) != (dn < 0) && out.n < len(out.points) {
+			out.points[out.n] = lerp(current, next, dc/(dc-dn))
+			out.n++
+		}
+	}
+	*p = out
+}
+
+// faceContacts clips the face of inc that faces ref against ref's face
+// with outward normal n, and adds the points below that face.
+func faceContacts(m *Manifold, ref, inc OBB, refAxes, incAxes *[3]glm.Vec3, axis int, n glm.Vec3) {
+	k := 0
+	for i := 1; i < 3; i++ {
+		if abs(dot(incAxes[i], n)) > abs(dot(incAxes[k], n)) {
+			k = i
+		}
+	}
+	faceNormal := incAxes[k]
+	if dot(faceNormal, n) > 0 {
+		faceNormal = scale(faceNormal, -1)
+	}
+	center := add(inc.Center, scale(faceNormal, inc.HalfExtents[k]))
+	u := scale(incAxes[(k+1)%3], inc.HalfExtents[(k+1)%3])
+	v := scale(incAxes[(k+2)%3], inc.HalfExtents[(k+2)%3])
+	face := polygon{n: 4}
+	face.points[0] = add(add(center, u), v)
+	face.points[1] = add(sub(center, u), v)
+	face.points[2] = sub(sub(center, u), v)
+	face.points[3] = sub(add(center, u), v)
+
+	for _, side := range [2]int{(axis + 1) % 3, (axis + 2) % 3} {
+		offset := dot(refAxes[side], ref.Center)
+		face.clip(refAxes[side], offset+ref.HalfExtents[side])
+		face.clip(scale(refAxes[side], -1), -offset+ref.HalfExtents[side])
+	}
+
+	plane := dot(n, ref.Center) + ref.HalfExtents[axis]
+	var points [8]Contact
+	count := 0
+	for _, p := range face.points[:face.n] {
+		if depth := plane - dot(n, p); depth >= 0 {
+			points[count] = Contact{add(p, scale(n, depth/2)), depth}
+			count++
+		}
+	}
+	reduce(m, points[:count])
+}
+
+// reduce adds at most MaxContacts of points to m: the deepest, then each
+// time the one farthest from those already chosen.
+func reduce(m *Manifold, points []Contact) {
+	if len(points) <= MaxContacts {
+		for _, p := range points {
+			m.add(p.Point, p.Depth)
+		}
+		return
+	}
+	chosen := [8]bool{}
+	deepest := 0
+	for i, p := range points {
+		if p.Depth > points[deepest].Depth {
+			deepest = i
+		}
+	}
+	chosen[deepest] = true
+	m.add(points[deepest].Point, points[deepest].Depth)
+	for m.Count < MaxContacts {
+		best, bestDistance := -1, float32(-1)
+		for i, p := range points {
+			if chosen[i] {
+				continue
+			}
+			var distance float32
+			for _, c := range m.Points() {
+				distance += length(sub(p.Point, c.Point))
+			}
+			if distance > bestDistance {
+				best, bestDistance = i, distance
+			}
+		}
+		chosen[best] = true
+		m.add(points[best].Point, points[best].Depth)
+	}
+}
+
+// edgeContact adds the point between the closest points of A's edge along
+// axis i and B's edge along axis j that lie furthest towards each other.
+func edgeContact(m *Manifold, a, b OBB, axesA, axesB *[3]glm.Vec3, i, j int, depth float32) {
+	pa, pb := a.Center, b.Center
+	for k := range 3 {
+		if k != i {
+			side := a.HalfExtents[k]
+			if dot(axesA[k], m.Normal) < 0 {
+				side = -side
+			}
+			pa = add(pa, scale(axesA[k], side))
+		}
+		if k != j {
+			side := b.HalfExtents[k]
+			if dot(axesB[k], m.Normal) > 0 {
+				side = -side
+			}
+			pb = add(pb, scale(axesB[k], side))
+		}
+	}
+	ea, eb := scale(axesA[i], a.HalfExtents[i]), scale(axesB[j], b.HalfExtents[j])
+	s, t := closestSegments(sub(pa, ea), add(pa, ea), sub(pb, eb), add(pb, eb))
+	closestA := lerp(sub(pa, ea), add(pa, ea), s)
+	closestB := lerp(sub(pb, eb), add(pb, eb), t)
+	m.add(scale(add(closestA, closestB), 0.5), depth)
+}
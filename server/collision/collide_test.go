@@ -0,0 +1,134 @@
+package collision
+
+import (
+	"math"
+	"testing"
+
+	"github.com/EngoEngine/glm"
+)
+
+func near(a, b glm.Vec3, tolerance float32) bool {
+	return length(sub(a, b)) <= tolerance
+}
+
+func rotationY(degrees float64) glm.Quat {
+	return glm.QuatRotate(float32(degrees*math.Pi/180), &glm.Vec3{0, 1, 0})
+}
+
+// Every pair overlaps by 0.1 along X, the first shape at the origin.
+var touching = []struct {
+	name string
+	a, b Shape
+}{
+	{"sphere sphere", Sphere{Radius: 1}, Sphere{glm.Vec3{1.9, 0, 0}, 1}},
+	{"sphere box", Sphere{Radius: 1}, OBB{glm.Vec3{1.4, 0, 0}, glm.Vec3{0.5, 0.5, 0.5}, glm.QuatIdent()}},
+	{"sphere aabb", Sphere{Radius: 1}, AABB{glm.Vec3{0.9, -0.5, -0.5}, glm.Vec3{1.9, 0.5, 0.5}}},
+	{"sphere capsule", Sphere{Radius: 1}, Capsule{glm.Vec3{1.9, -1, 0}, glm.Vec3{1.9, 1, 0}, 1}},
+	{"capsule capsule", Capsule{glm.Vec3{0, -1, 0}, glm.Vec3{0, 1, 0}, 1}, Capsule{glm.Vec3{1.9, -1, 0}, glm.Vec3{1.9, 1, 0}, 1}},
+	{"capsule box", Capsule{glm.Vec3{0, -1, 0}, glm.Vec3{0, 1, 0}, 1}, OBB{glm.Vec3{1.4, 0, 0}, glm.Vec3{0.5, 2, 0.5}, glm.QuatIdent()}},
+	{"box box", OBB{HalfExtents: glm.Vec3{0.5, 0.5, 0.5}, Rotation: glm.QuatIdent()}, OBB{glm.Vec3{0.9, 0, 0}, glm.Vec3{0.5, 0.5, 0.5}, glm.QuatIdent()}},
+	{"rotated box box", OBB{HalfExtents: glm.Vec3{0.5, 0.5, 0.5}, Rotation: rotationY(90)}, OBB{glm.Vec3{0.9, 0.1, 0}, glm.Vec3{0.5, 0.5, 0.5}, rotationY(-90)}},
+	{"aabb box", AABB{glm.Vec3{-0.5, -0.5, -0.5}, glm.Vec3{0.5, 0.5, 0.5}}, OBB{glm.Vec3{0.9, 0, 0.2}, glm.Vec3{0.5, 0.5, 0.5}, glm.QuatIdent()}},
+}
+
+func TestCollideNormals(t *testing.T) {
+	x := glm.Vec3{1, 0, 0}
+	for _, pair := range touching {
+		m, ok := Collide(pair.a, pair.b)
+		if !ok {
+			t.Errorf("%s: no contact", pair.name)
+			continue
+		}
+		if !near(m.Normal, x, 1e-4) {
+			t.Errorf("%s: normal %v, want %v", pair.name, m.Normal, x)
+		}
+		if d := m.Depth(); abs(d-0.1) > 1e-4 {
+			t.Errorf("%s: depth %v, want 0.1", pair.name, d)
+		}
+
+		// The same pair the other way round has the opposite normal.
+		flipped, ok := Collide(pair.b, pair.a)
+		if !ok {
+			t.Errorf("%s: no contact the other way round", pair.name)
+			continue
+		}
+		if abs(flipped.Depth()-m.Depth()) > 1e-4 {
+			t.Errorf("%s: depth %v the other way round", pair.name, flipped.Depth())
+		}
+		m.Flip()
+		if !near(m.Normal, flipped.Normal, 1e-4) {
+			t.Errorf("%s: Flip gave %v, the other way round gives %v", pair.name, m.Normal, flipped.Normal)
+		}
+		m.Flip()
+
+		// Moving the second shape by the normal times the depth separates
+		// them, and moving it slightly less does not.
+		if _, ok := Collide(pair.a, pair.b.Moved(scale(m.Normal, m.Depth()+1e-3))); ok {
+			t.Errorf("%s: still touching after moving apart by the depth", pair.name)
+		}
+		if _, ok := Collide(pair.a, pair.b.Moved(scale(m.Normal, m.Depth()-1e-2))); !ok {
+			t.Errorf("%s: apart before moving by the whole depth", pair.name)
+		}
+	}
+}
+
+func TestCollideApart(t *testing.T) {
+	for _, pair := range touching {
+		apart := pair.b.Moved(glm.Vec3{0.2, 0, 0})
+		if m, ok := Collide(pair.a, apart); ok {
+			t.Errorf("%s: contact %+v between shapes 0.1 apart", pair.name, m)
+		}
+		if m, ok := Collide(apart, pair.a); ok {
+			t.Errorf("%s: contact %+v the other way round", pair.name, m)
+		}
+	}
+}
+
+func TestFlip(t *testing.T) {
+	m, _ := Collide(touching[0].a, touching[0].b)
+	normal := m.Normal
+	m.Flip()
+	if m.Normal != scale(normal, -1) {
+		t.Errorf("Flip turned %v into %v", normal, m.Normal)
+	}
+	m.Flip()
+	if m.Normal != normal {
+		t.Errorf("Flip twice turned %v into %v", normal, m.Normal)
+	}
+}
+
+func TestBoxRestingOnBox(t *testing.T) {
+	ground := OBB{HalfExtents: glm.Vec3{5, 0.5, 5}, Rotation: glm.QuatIdent()}
+	for _, degrees := range []float64{0, 30, 45, 90} {
+		box := OBB{glm.Vec3{1, 0.99, -2}, glm.Vec3{0.5, 0.5, 0.5}, rotationY(degrees)}
+		m, ok := Collide(ground, box)
+		if !ok {
+			t.Fatalf("%v degrees: no contact", degrees)
+		}
+		if !near(m.Normal, glm.Vec3{0, 1, 0}, 1e-5) {
+			t.Errorf("%v degrees: normal %v", degrees, m.Normal)
+		}
+		if m.Count != 4 {
+			t.Fatalf("%v degrees: %d contacts, want 4", degrees, m.Count)
+		}
+		axes := box.axes()
+		for _, c := range m.Points() {
+			if abs(c.Depth-0.01) > 1e-4 {
+				t.Errorf("%v degrees: contact %v has depth %v, want 0.01", degrees, c.Point, c.Depth)
+			}
+			// Every contact is under a corner of the box, halfway between
+			// the two faces.
+			local := box.local(&axes, c.Point)
+			if abs(abs(local[0])-0.5) > 1e-4 || abs(abs(local[2])-0.5) > 1e-4 || abs(c.Point[1]-0.495) > 1e-4 {
+				t.Errorf("%v degrees: contact %v is not under a corner", degrees, c.Point)
+			}
+		}
+
+		// The other way round gives the same contacts with the normal
+		// turned over.
+		other, _ := Collide(box, ground)
+		if other.Count != 4 || !near(other.Normal, glm.Vec3{0, -1, 0}, 1e-5) {
+			t.Errorf("%v degrees: box on ground has %d contacts with normal %v", degrees, other.Count, other.Normal)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package collision
+
+import (
+	"math"
+
+	"github.com/EngoEngine/glm"
+)
+
+// Ray is a half-line starting at Origin. Dir need not be normalized; hit
+// distances are in multiples of its length.
+type Ray struct {
+	Origin glm.Vec3
+	Dir    glm.Vec3
+}
+
+func (r Ray) At(distance float32) glm.Vec3 {
+	return add(r.Origin, scale(r.Dir, distance))
+}
+
+// Hit is where a ray or a moving shape first touches a shape.
+type Hit struct {
+	// Distance is how far along the ray, or the fraction of the movement of
+	// a cast shape, the hit is.
+	Distance float32
+	Point    glm.Vec3
+	Normal   glm.Vec3 // of the surface hit, facing back along the ray
+}
+
+// RayCast returns where ray first enters s, no further than maxDistance. A
+// ray starting inside s hits it at distance 0, with the normal facing back
+// along the ray.
+func RayCast(s Shape, ray Ray, maxDistance float32) (Hit, bool) {
+	l := length(ray.Dir)
+	if l == 0 {
+		return Hit{}, false
+	}
+	o, u := ray.Origin, scale(ray.Dir, 1/l)
+	var t float32
+	var normal glm.Vec3
+	var ok bool
+	switch s := s.(type) {
+	case Sphere:
+		t, normal, ok = raySphere(o, u, s.Center, s.Radius)
+	case AABB:
+		t, normal, ok = rayBox(o, u, s.OBB())
+	case OBB:
+		t, normal, ok = rayBox(o, u, s)
+	case Capsule:
+		t, normal, ok = rayCapsule(o, u, s)
+	}
+	if !ok || t > maxDistance*l {
+		return Hit{}, false
+	}
+	if t == 0 {
+		normal = scale(u, -1)
+	}
+	return Hit{Distance: t / l, Point: add(o, scale(u, t)), Normal: normal}, true
+}
+
+// raySphere intersects a ray with unit direction u with a sphere.
+func raySphere(o, u, center glm.Vec3, radius float32) (float32, glm.Vec3, bool) {
+	m := sub(o, center)
+	b := dot(m, u)
+	c := dot(m, m) - radius*radius
+	if c <= 0 {
+		return 0, glm.Vec3{}, true
+	}
+	if b > 0 {
+		return 0, glm.Vec3{}, false
+	}
+	discriminant := b*b - c
+	if discriminant < 0 {
+		return 0, glm.Vec3{}, false
+	}
+	t := -b - float32(math.Sqrt(float64(discriminant)))
+	t = max(t, 0)
+	normal := sub(add(o, scale(u, t)), center)
+	return t, scale(normal, 1/length(normal)), true
+}
+
+// rayBox intersects a ray with unit direction u with a box by clipping it
+// against the box's three slabs.
+func rayBox(o, u glm.Vec3, b OBB) (float32, glm.Vec3, bool) {
+	axes := b.axes()
+	lo := b.local(&axes, o)
+	ld := glm.Vec3{dot(u, axes[0]), dot(u, axes[1]), dot(u, axes[2])}
+	enter, exit := float32(math.Inf(-1)), float32(math.Inf(1))
+	var normal glm.Vec3
+	for k := range 3 {
+		h := b.HalfExtents[k]
+		if abs(ld[k]) < 1e-9 {
+			if lo[k] < -h || lo[k] > h {
+				return 0, glm.Vec3{}, false
+			}
+			continue
+		}
+		t1, t2 := (-h-lo[k])/ld[k], (h-lo[k])/ld[k]
+		side := float32(-1)
+		if t1 > t2 {
+			t1, t2 = t2, t1
+			side = 1
+		}
+		if t1 > enter {
+			enter = t1
+			normal = scale(axes[k], side)
+		}
+		exit = min(exit, t2)
+		if enter > exit || exit < 0 {
+			return 0, glm.Vec3{}, false
+		}
+	}
+	if enter < 0 {
+		return 0, glm.Vec3{}, true
+	}
+	return enter, normal, true
+}
+
+// rayCapsule intersects a ray with unit direction u with a capsule: its
+// cylindrical body, then its two end spheres.
+func rayCapsule(o, u glm.Vec3, c Capsule) (float32, glm.Vec3, bool) {
+	if length(sub(o, lerp(c.A, c.B, closestOnSegment(c.A, c.B, o)))) <= c.Radius {
+		return 0, glm.Vec3{}, true
+	}
+	best, bestNormal, hit := float32(math.Inf(1)), glm.Vec3{}, false
+
+	d, m := sub(c.B, c.A), sub(o, c.A)
+	dd, nd, md := dot(d, d), dot(u, d), dot(m, d)
+	a := dd - nd*nd
+	if dd > 0 && abs(a) > 1e-9 {
+		b := dd*dot(m, u) - nd*md
+		k := dd*(dot(m, m)-c.Radius*c.Radius) - md*md
+		if discriminant := b*b - a*k; discriminant >= 0 {
+			t := (-b - float32(math.Sqrt(float64(discriminant)))) / a
+			if s := md + t*nd; t >= 0 && s >= 0 && s <= dd {
+				p := add(o, scale(u, t))
+				normal := sub(p, add(c.A, scale(d, s/dd)))
+				best, bestNormal, hit = t, scale(normal, 1/length(normal)), true
+			}
+		}
+	}
+	for _, end := range [2]glm.Vec3{c.A, c.B} {
+		if t, normal, ok := raySphere(o, u, end, c.Radius); ok && t < best {
+			best, bestNormal, hit = t, normal, true
+		}
+	}
+	return best, bestNormal, hit
+}
+
+// maxCastSteps bounds how many times Cast tests a moving shape for overlap
+// before refining the first one found.
+const maxCastSteps = 256
+
+// Cast moves s along delta and returns where it first touches target. The
+// hit's Distance is the fraction of delta s can move without overlapping,
+// its Point the contact and its Normal target's surface normal there. A
+// shape that already overlaps target hits it at 0.
+//
+// The movement is tested in steps no longer than the thickness of s, so s
+// cannot pass through target between steps, then refined by bisection.
+func Cast(s Shape, delta glm.Vec3, target Shape) (Hit, bool) {
+	if m, ok := Collide(s, target); ok {
+		return Hit{Point: m.Contacts[0].Point, Normal: scale(m.Normal, -1)}, true
+	}
+	distance := length(delta)
+	if distance == 0 {
+		return Hit{}, false
+	}
+	if !s.Bounds().Union(s.Moved(delta).Bounds()).Overlaps(target.Bounds()) {
+		return Hit{}, false
+	}
+	step := s.thickness()
+	steps := maxCastSteps
+	if step > 0 {
+		steps = min(int(math.Ceil(float64(distance/step))), maxCastSteps)
+	}
+	steps = max(steps, 1)
+
+	lo, hi := float32(0), float32(-1)
+	var m Manifold
+	for i := 1; i <= steps; i++ {
+		t := float32(i) / float32(steps)
+		if contact, ok := Collide(s.Moved(scale(delta, t)), target); ok {
+			hi, m = t, contact
+			break
+		}
+		lo = t
+	}
+	if hi < 0 {
+		return Hit{}, false
+	}
+	for range 20 {
+		mid := (lo + hi) / 2
+		if contact, ok := Collide(s.Moved(scale(delta, mid)), target); ok {
+			hi, m = mid, contact
+		} else {
+			lo = mid
+		}
+	}
+	return Hit{Distance: lo, Point: m.Contacts[0].Point, Normal: scale(m.Normal, -1)}, true
+}
@@ -0,0 +1,98 @@
+package collision
+
+import (
+	"math"
+	"testing"
+
+	"github.com/EngoEngine/glm"
+)
+
+func TestRayCast(t *testing.T) {
+	// The ray comes from -X towards shapes whose near side is at x = 4.
+	ray := Ray{glm.Vec3{0, 0.2, 0}, glm.Vec3{2, 0, 0}}
+	for _, test := range []struct {
+		name  string
+		shape Shape
+	}{
+		{"sphere", Sphere{glm.Vec3{5, 0.2, 0}, 1}},
+		{"box", OBB{glm.Vec3{5, 0, 0}, glm.Vec3{1, 1, 1}, rotationY(90)}},
+		{"aabb", AABB{glm.Vec3{4, -1, -1}, glm.Vec3{6, 1, 1}}},
+		{"capsule", Capsule{glm.Vec3{5, -1, 0}, glm.Vec3{5, 1, 0}, 1}},
+	} {
+		hit, ok := RayCast(test.shape, ray, 10)
+		if !ok {
+			t.Errorf("%s: missed", test.name)
+			continue
+		}
+		// Distances are in multiples of the direction's length.
+		if abs(hit.Distance-2) > 1e-4 || !near(hit.Point, glm.Vec3{4, 0.2, 0}, 1e-4) || !near(hit.Normal, glm.Vec3{-1, 0, 0}, 1e-4) {
+			t.Errorf("%s: hit %+v", test.name, hit)
+		}
+		if _, ok := RayCast(test.shape, ray, 1.9); ok {
+			t.Errorf("%s: hit beyond maxDistance", test.name)
+		}
+		if _, ok := RayCast(test.shape, Ray{ray.Origin, scale(ray.Dir, -1)}, 10); ok {
+			t.Errorf("%s: hit behind the ray", test.name)
+		}
+		inside, ok := RayCast(test.shape, Ray{glm.Vec3{5, 0.2, 0}, ray.Dir}, 10)
+		if !ok || inside.Distance != 0 || !near(inside.Normal, glm.Vec3{-1, 0, 0}, 1e-6) {
+			t.Errorf("%s: ray from inside hit %+v, %v", test.name, inside, ok)
+		}
+	}
+}
+
+func TestWorldRayCastInfinite(t *testing.T) {
+	var w World
+	w.Add(Sphere{glm.Vec3{0, 0, -50}, 1})
+	far := w.Add(AABB{glm.Vec3{-1, -1, -1000}, glm.Vec3{1, 1, -999}})
+	w.Add(Sphere{glm.Vec3{0, 5, -20}, 1})
+
+	// A direction with zero components used to give NaN bounds.
+	inf := float32(math.Inf(1))
+	p, hit, ok := w.RayCast(Ray{glm.Vec3{}, glm.Vec3{0, 0, -1}}, inf, nil)
+	if !ok || p != 0 || abs(hit.Distance-49) > 1e-4 {
+		t.Errorf("hit %d at %v, %v, want 0 at 49", p, hit.Distance, ok)
+	}
+	p, hit, ok = w.RayCast(Ray{glm.Vec3{}, glm.Vec3{0, 0, -1}}, inf, func(p Proxy) bool { return p == 0 })
+	if !ok || p != far || abs(hit.Distance-999) > 1e-3 {
+		t.Errorf("skipping the sphere hit %d at %v, %v, want %d at 999", p, hit.Distance, ok, far)
+	}
+	if _, _, ok := w.RayCast(Ray{glm.Vec3{}, glm.Vec3{0, 1, 0}}, inf, nil); ok {
+		t.Error("hit a shape nowhere near the ray")
+	}
+	if _, _, ok := w.RayCast(Ray{glm.Vec3{}, glm.Vec3{0, 0, -1}}, 40, nil); ok {
+		t.Error("hit beyond maxDistance")
+	}
+}
+
+func TestCastThinTarget(t *testing.T) {
+	// A small fast sphere must not pass through a thin plate between the
+	// steps of the cast.
+	plate := OBB{HalfExtents: glm.Vec3{2, 0.01, 2}, Rotation: glm.QuatIdent()}
+	sphere := Sphere{glm.Vec3{0.3, 10, 0}, 0.1}
+	delta := glm.Vec3{0, -20, 0}
+	hit, ok := Cast(sphere, delta, plate)
+	if !ok {
+		t.Fatal("passed through the plate")
+	}
+	// The sphere touches the plate after moving 10 - 0.1 - 0.01.
+	if want := float32(9.89 / 20); abs(hit.Distance-want) > 1e-4 {
+		t.Errorf("distance %v, want %v", hit.Distance, want)
+	}
+	if !near(hit.Normal, glm.Vec3{0, 1, 0}, 1e-4) || !near(hit.Point, glm.Vec3{0.3, 0.01, 0}, 1e-3) {
+		t.Errorf("hit %+v", hit)
+	}
+	if _, ok := Collide(sphere.Moved(scale(delta, hit.Distance)), plate); ok {
+		t.Error("the sphere overlaps the plate where the cast stopped it")
+	}
+
+	// A thin box cast edge first through a thin plate.
+	blade := OBB{glm.Vec3{0, 5, 0}, glm.Vec3{0.5, 0.005, 0.5}, glm.QuatRotate(math.Pi/2, &glm.Vec3{1, 0, 0})}
+	if hit, ok := Cast(blade, glm.Vec3{0, -10, 0}, plate); !ok || abs(hit.Distance-(5-0.5-0.01)/10) > 1e-3 {
+		t.Errorf("blade hit %+v, %v", hit, ok)
+	}
+
+	if _, ok := Cast(sphere, glm.Vec3{0, 5, 0}, plate); ok {
+		t.Error("hit moving away from the plate")
+	}
+}
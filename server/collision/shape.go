@@ -0,0 +1,241 @@
+// Package collision finds where shapes touch: a sweep and prune broadphase
+// pairs up shapes whose bounds overlap, narrowphase tests turn those pairs
+// into contact manifolds, and rays and moving shapes can be cast against
+// them.
+package collision
+
+import (
+	"math"
+
+	"github.com/EngoEngine/glm"
+)
+
+// Shape is one of Sphere, AABB, OBB or Capsule.
+type Shape interface {
+	// Bounds returns the smallest axis aligned box containing the shape.
+	Bounds() AABB
+	// Moved returns the shape translated by delta.
+	Moved(delta glm.Vec3) Shape
+	// thickness is the radius of a sphere that fits inside the shape.
+	thickness() float32
+}
+
+type Sphere struct {
+	Center glm.Vec3
+	Radius float32
+}
+
+// AABB is an axis aligned box.
+type AABB struct {
+	Min, Max glm.Vec3
+}
+
+// OBB is a box rotated about its center, like the cubes the client draws.
+type OBB struct {
+	Center      glm.Vec3
+	HalfExtents glm.Vec3
+	Rotation    glm.Quat
+}
+
+// Capsule is every point within Radius of the segment from A to B.
+type Capsule struct {
+	A, B   glm.Vec3
+	Radius float32
+}
+
+func (s Sphere) Bounds() AABB {
+	r := glm.Vec3{s.Radius, s.Radius, s.Radius}
+	return AABB{sub(s.Center, r), add(s.Center, r)}
+}
+
+func (s Sphere) Moved(delta glm.Vec3) Shape {
+	s.Center = add(s.Center, delta)
+	return s
+}
+
+func (s Sphere) thickness() float32 {
+	return s.Radius
+}
+
+func (b AABB) Bounds() AABB {
+	return b
+}
+
+func (b AABB) Moved(delta glm.Vec3) Shape {
+	return AABB{add(b.Min, delta), add(b.Max, delta)}
+}
+
+func (b AABB) thickness() float32 {
+	h := b.halfExtents()
+	return min(h[0], h[1], h[2])
+}
+
+func (b AABB) Center() glm.Vec3 {
+	return scale(add(b.Min, b.Max), 0.5)
+}
+
+func (b AABB) halfExtents() glm.Vec3 {
+	return scale(sub(b.Max, b.Min), 0.5)
+}
+
+// OBB returns the box as an unrotated OBB.
+func (b AABB) OBB() OBB {
+	return OBB{Center: b.Center(), HalfExtents: b.halfExtents(), Rotation: glm.QuatIdent()}
+}
+
+// Overlaps reports whether the boxes share any point.
+func (b AABB) Overlaps(o AABB) bool {
+	return b.Min[0] <= o.Max[0] && o.Min[0] <= b.Max[0] &&
+		b.Min[1] <= o.Max[1] && o.Min[1] <= b.Max[1] &&
+		b.Min[2] <= o.Max[2] && o.Min[2] <= b.Max[2]
+}
+
+// Union returns the smallest box containing both.
+func (b AABB) Union(o AABB) AABB {
+	return AABB{
+		glm.Vec3{min(b.Min[0], o.Min[0]), min(b.Min[1], o.Min[1]), min(b.Min[2], o.Min[2])},
+		glm.Vec3{max(b.Max[0], o.Max[0]), max(b.Max[1], o.Max[1]), max(b.Max[2], o.Max[2])},
+	}
+}
+
+func (b OBB) Bounds() AABB {
+	axes := b.axes()
+	var extent glm.Vec3
+	for i := range 3 {
+		for k := range 3 {
+			extent[i] += abs(axes[k][i]) * b.HalfExtents[k]
+		}
+	}
+	return AABB{sub(b.Center, extent), add(b.Center, extent)}
+}
+
+func (b OBB) Moved(delta glm.Vec3) Shape {
+	b.Center = add(b.Center, delta)
+	return b
+}
+
+func (b OBB) thickness() float32 {
+	return min(b.HalfExtents[0], b.HalfExtents[1], b.HalfExtents[2])
+}
+
+// axes returns the box's local X, Y and Z axes in world space.
+func (b OBB) axes() [3]glm.Vec3 {
+	m := b.Rotation.Mat4()
+	return [3]glm.Vec3{
+		{m[0], m[1], m[2]},
+		{m[4], m[5], m[6]},
+		{m[8], m[9], m[10]},
+	}
+}
+
+// local returns p relative to the box's center along its axes.
+func (b OBB) local(axes *[3]glm.Vec3, p glm.Vec3) glm.Vec3 {
+	d := sub(p, b.Center)
+	return glm.Vec3{dot(d, axes[0]), dot(d, axes[1]), dot(d, axes[2])}
+}
+
+// world is the inverse of local.
+func (b OBB) world(axes *[3]glm.Vec3, p glm.Vec3) glm.Vec3 {
+	w := b.Center
+	for k := range 3 {
+		w = add(w, scale(axes[k], p[k]))
+	}
+	return w
+}
+
+func (c Capsule) Bounds() AABB {
+	r := glm.Vec3{c.Radius, c.Radius, c.Radius}
+	return AABB{sub(c.A, r), add(c.A, r)}.Union(AABB{sub(c.B, r), add(c.B, r)})
+}
+
+func (c Capsule) Moved(delta glm.Vec3) Shape {
+	c.A = add(c.A, delta)
+	c.B = add(c.B, delta)
+	return c
+}
+
+func (c Capsule) thickness() float32 {
+	return c.Radius
+}
+
+func add(a, b glm.Vec3) glm.Vec3 {
+	return glm.Vec3{a[0] + b[0], a[1] + b[1], a[2] + b[2]}
+}
+
+func sub(a, b glm.Vec3) glm.Vec3 {
+	return glm.Vec3{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func scale(a glm.Vec3, s float32) glm.Vec3 {
+	return glm.Vec3{a[0] * s, a[1] * s, a[2] * s}
+}
+
+func dot(a, b glm.Vec3) float32 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func cross(a, b glm.Vec3) glm.Vec3 {
+	return glm.Vec3{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
+
+func length(a glm.Vec3) float32 {
+	return float32(math.Sqrt(float64(dot(a, a))))
+}
+
+func abs(x float32) float32 {
+	return float32(math.Abs(float64(x)))
+}
+
+func clamp(x, lo, hi float32) float32 {
+	return max(lo, min(x, hi))
+}
+
+// closestOnSegment returns the parameter of the point of segment a-b
+// closest to p.
+func closestOnSegment(a, b, p glm.Vec3) float32 {
+	ab := sub(b, a)
+	denominator := dot(ab, ab)
+	if denominator == 0 {
+		return 0
+	}
+	return clamp(dot(sub(p, a), ab)/denominator, 0, 1)
+}
+
+func lerp(a, b glm.Vec3, t float32) glm.Vec3 {
+	return add(a, scale(sub(b, a), t))
+}
+
+// closestSegments returns the parameters of the closest points of segments
+// p1-q1 and p2-q2.
+func closestSegments(p1, q1, p2, q2 glm.Vec3) (s, t float32) {
+	d1, d2 := sub(q1, p1), sub(q2, p2)
+	r := sub(p1, p2)
+	a, e, f := dot(d1, d1), dot(d2, d2), dot(d2, r)
+	const epsilon = 1e-12
+	if a <= epsilon && e <= epsilon {
+		return 0, 0
+	}
+	if a <= epsilon {
+		return 0, clamp(f/e, 0, 1)
+	}
+	c := dot(d1, r)
+	if e <= epsilon {
+		return clamp(-c/a, 0, 1), 0
+	}
+	b := dot(d1, d2)
+	denominator := a*e - b*b
+	if denominator != 0 {
+		s = clamp((b*f-c*e)/denominator, 0, 1)
+	}
+	t = (b*s + f) / e
+	if t < 0 {
+		t, s = 0, clamp(-c/a, 0, 1)
+	} else if t > 1 {
+		t, s = 1, clamp((b-c)/a, 0, 1)
+	}
+	return s, t
+}
@@ -0,0 +1,110 @@
+package collision
+
+import (
+	"math"
+
+	"github.com/EngoEngine/glm"
+)
+
+// World holds shapes for collision queries, with a broadphase to skip the
+// pairs that cannot touch.
+type World struct {
+	broadphase Broadphase
+	shapes     []Shape // by proxy
+}
+
+func (w *World) Add(s Shape) Proxy {
+	p := w.broadphase.Add(s.Bounds())
+	if int(p) == len(w.shapes) {
+		w.shapes = append(w.shapes, s)
+	} else {
+		w.shapes[p] = s
+	}
+	return p
+}
+
+// Set replaces or moves the shape of p.
+func (w *World) Set(p Proxy, s Shape) {
+	w.shapes[p] = s
+	w.broadphase.Update(p, s.Bounds())
+}
+
+func (w *World) Remove(p Proxy) {
+	w.shapes[p] = nil
+	w.broadphase.Remove(p)
+}
+
+func (w *World) Shape(p Proxy) Shape {
+	return w.shapes[p]
+}
+
+func (w *World) Len() int {
+	return w.broadphase.Len()
+}
+
+// Contacts calls fn for every pair of shapes that overlap, in the order of
+// Broadphase.Pairs.
+func (w *World) Contacts(fn func(a, b Proxy, m *Manifold)) {
+	w.broadphase.Pairs(func(a, b Proxy) {
+		if m, ok := Collide(w.shapes[a], w.shapes[b]); ok {
+			fn(a, b, &m)
+		}
+	})
+}
+
+// Overlaps calls fn for every shape s overlaps, with the manifold from s to
+// it. Shapes for which skip returns true are left out; skip may be nil.
+func (w *World) Overlaps(s Shape, skip func(p Proxy) bool, fn func(p Proxy, m *Manifold)) {
+	w.broadphase.Query(s.Bounds(), func(p Proxy) {
+		if skip != nil && skip(p) {
+			return
+		}
+		if m, ok := Collide(s, w.shapes[p]); ok {
+			fn(p, &m)
+		}
+	})
+}
+
+// RayCast returns the first shape ray hits within maxDistance, which may be
+// infinite.
+func (w *World) RayCast(ray Ray, maxDistance float32, skip func(p Proxy) bool) (Proxy, Hit, bool) {
+	// The ray's bounds, axis by axis: ray.At would multiply a zero
+	// component of the direction by an infinite distance, giving NaN.
+	bounds := AABB{ray.Origin, ray.Origin}
+	for i, d := range ray.Dir {
+		if d == 0 {
+			continue
+		}
+		end := ray.Origin[i] + d*maxDistance
+		bounds.Min[i] = min(bounds.Min[i], end)
+		bounds.Max[i] = max(bounds.Max[i], end)
+	}
+	return w.first(bounds, skip, func(s Shape) (Hit, bool) {
+		return RayCast(s, ray, maxDistance)
+	})
+}
+
+// Cast moves s along delta and returns the first shape it touches, as Cast
+// does for a single target.
+func (w *World) Cast(s Shape, delta glm.Vec3, skip func(p Proxy) bool) (Proxy, Hit, bool) {
+	bounds := s.Bounds().Union(s.Moved(delta).Bounds())
+	return w.first(bounds, skip, func(target Shape) (Hit, bool) {
+		return Cast(s, delta, target)
+	})
+}
+
+// first returns the closest hit among the shapes overlapping bounds, the
+// lowest proxy on ties.
+func (w *World) first(bounds AABB, skip func(p Proxy) bool, test func(s Shape) (Hit, bool)) (Proxy, Hit, bool) {
+	best, bestHit, found := Proxy(-1), Hit{Distance: float32(math.Inf(1))}, false
+	w.broadphase.Query(bounds, func(p Proxy) {
+		if skip != nil && skip(p) {
+			return
+		}
+		hit, ok := test(w.shapes[p])
+		if ok && (hit.Distance < bestHit.Distance || hit.Distance == bestHit.Distance && p < best) {
+			best, bestHit, found = p, hit, true
+		}
+	})
+	return best, bestHit, found
+}
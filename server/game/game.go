@@ -0,0 +1,115 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"wgpu_server/chat"
+	"wgpu_server/lagcomp"
+	"wgpu_server/ws"
+)
+
+var ErrUnknownType = errors.New("game: unknown message type")
+
+// TickRate is how often Tick broadcasts the world to clients.
+const TickRate = time.Second / 30.0
+
+// MaxRewind is how far back lag compensated queries can look by default.
+const MaxRewind = time.Second / 4
+
+// History of player states for lag compensated queries, recorded each tick.
+var History = lagcomp.NewHistory(MaxRewind)
+
+// Chat relays chat lines between players.
+var Chat = chat.New()
+
+// InterpolationDelay is how far behind the latest snapshot clients render
+// other players.
+var InterpolationDelay time.Duration
+
+// NewServer creates a server that runs the game's message handlers.
+func NewServer() *ws.Server {
+	server := ws.NewServer(HandleMessage)
+	server.OnDisconnect = func(id int) {
+		leave(server, id)
+		Chat.Leave(id)
+	}
+	return server
+}
+
+// Tick sends every player's state to all connected clients.
+func Tick(server *ws.Server) {
+	tick := server.Tick()
+	server.Lock.Lock()
+	History.Record(tick, time.Now(), ws.Players)
+	numPlayers := len(ws.Players)
+	if numPlayers == 0 {
+		server.Lock.Unlock()
+		return
+	}
+	mPlayers := make([]ws.Message, numPlayers)
+	i := 0
+	for id, player := range ws.Players {
+		mPlayers[i] = ws.Message{Client: id, Data: player}
+		i++
+	}
+	server.Lock.Unlock()
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		for _, player := range mPlayers {
+			slog.Debug("player", "client", player.Client, "tick", tick, "room", Chat.Room(player.Client), "position", player.Data.Position, "rotation", player.Data.Rotation)
+		}
+	}
+	server.WriteMessage(-1, ws.EncodeSnapshot(tick, mPlayers))
+}
+
+// Rewind tests ray against the other players as client id saw them when it
+// sent its latest message.
+func Rewind(server *ws.Server, id int, ray lagcomp.Ray) []lagcomp.Hit {
+	tick := lagcomp.PerceivedTick(server.Tick(), server.RTT(id), InterpolationDelay, server.TickRate())
+	hits := History.RewindQuery(tick, ray)
+	for i, hit := range hits {
+		if hit.Client == id {
+			return append(hits[:i], hits[i+1:]...)
+		}
+	}
+	return hits
+}
+
+// HandleMessage applies a message from client id, rejecting messages that
+// are malformed or of an unknown type.
+func HandleMessage(server *ws.Server, id int, message []byte) error {
+	if len(message) == 0 {
+		return ws.ErrLength
+	}
+	messageType := message[0]
+	switch messageType {
+	case ws.MessagePlayerData:
+		{
+			d, err := ws.DecodePlayerData(message[1:])
+			if err != nil {
+				return err
+			}
+			server.Lock.Lock()
+			ws.Players[id] = d
+			server.Lock.Unlock()
+		}
+	case ws.MessageAck:
+		tick, err := ws.DecodeAck(message[1:])
+		if err != nil {
+			return err
+		}
+		server.Ack(id, tick)
+	case ws.MessageChat:
+		return Chat.Handle(server, id, message[1:])
+	case ws.MessageHello:
+		identity, err := ws.DecodeHello(message[1:])
+		if err != nil {
+			return err
+		}
+		return hello(server, id, identity)
+	default:
+		return ErrUnknownType
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package game
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+	"wgpu_server/chat"
+	"wgpu_server/persist"
+	"wgpu_server/ws"
+)
+
+// world is the saved state of every player seen, online or not. It and
+// identities are only used on the Poll goroutine.
+var world = persist.NewWorld()
+
+// identities maps connection ids to the identity each client logged in with.
+var identities = make(map[int]string)
+
+// ErrLoggedIn is returned for a hello from a client that has already logged
+// in, or naming an identity another client is logged in as.
+var ErrLoggedIn = errors.New("game: already logged in")
+
+// Restore replaces the saved world and carries on counting ticks from where
+// it was saved. Call it before the server starts polling.
+func Restore(server *ws.Server, w *persist.World) {
+	world = w
+	server.SetTick(w.Tick)
+}
+
+// Snapshot returns a copy of the world including the current state of every
+// online player. It must be called on the Poll goroutine, e.g. with
+// server.Do.
+func Snapshot(server *ws.Server) *persist.World {
+	w := persist.NewWorld()
+	for identity, player := range world.Players {
+		w.Players[identity] = player
+	}
+	for identity, room := range world.Rooms {
+		w.Rooms[identity] = room
+	}
+	server.Lock.Lock()
+	for id, identity := range identities {
+		if player, ok := ws.Players[id]; ok {
+			w.Players[identity] = player
+		}
+	}
+	server.Lock.Unlock()
+	for id, identity := range identities {
+		setRoom(w, identity, Chat.Room(id))
+	}
+	w.Tick = server.Tick()
+	w.Saved = time.Now()
+	return w
+}
+
+// hello logs client id in as identity, restoring its saved position and room.
+// Identities are not authenticated, but only one client at a time may use
+// each, and a client cannot change its identity once logged in.
+func hello(server *ws.Server, id int, identity string) error {
+	if _, ok := identities[id]; ok {
+		return ErrLoggedIn
+	}
+	for _, other := range identities {
+		if other == identity {
+			return ErrLoggedIn
+		}
+	}
+	identities[id] = identity
+	slog.Info("player logged in", "client", id, "identity", identity, "tick", server.Tick())
+
+	if room, ok := world.Rooms[identity]; ok {
+		Chat.SetRoom(id, room)
+	}
+	player, ok := world.Players[identity]
+	if !ok {
+		return nil
+	}
+	server.Lock.Lock()
+	ws.Players[id] = player
+	server.Lock.Unlock()
+	server.WriteMessage(id, ws.EncodeTeleport(player.Position))
+	return nil
+}
+
+// leave saves the state of client id before it is removed.
+func leave(server *ws.Server, id int) {
+	identity, ok := identities[id]
+	if !ok {
+		return
+	}
+	delete(identities, id)
+	server.Lock.Lock()
+	player, online := ws.Players[id]
+	server.Lock.Unlock()
+	if online {
+		world.Players[identity] = player
+	}
+	setRoom(world, identity, Chat.Room(id))
+}
+
+func setRoom(w *persist.World, identity, room string) {
+	if room == chat.DefaultRoom {
+		delete(w.Rooms, identity)
+		return
+	}
+	w.Rooms[identity] = room
+}
@@ -0,0 +1,48 @@
+package game
+
+import (
+	"testing"
+	"wgpu_server/persist"
+	"wgpu_server/ws"
+)
+
+func TestHelloRejectsOnlineIdentity(t *testing.T) {
+	server := NewServer()
+	identities = make(map[int]string)
+	defer func() { identities = make(map[int]string) }()
+
+	hello := func(id int, identity string) error {
+		return HandleMessage(server, id, ws.EncodeHello(identity))
+	}
+	if err := hello(1, "alice"); err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if err := hello(2, "alice"); err != ErrLoggedIn {
+		t.Errorf("second client logging in as alice: %v, want %v", err, ErrLoggedIn)
+	}
+	if err := hello(1, "bob"); err != ErrLoggedIn {
+		t.Errorf("alice logging in again as bob: %v, want %v", err, ErrLoggedIn)
+	}
+	if identities[1] != "alice" || identities[2] != "" {
+		t.Errorf("identities %v after rejected logins", identities)
+	}
+
+	leave(server, 1)
+	if err := hello(2, "alice"); err != nil {
+		t.Errorf("login as alice once she left: %v", err)
+	}
+}
+
+func TestRestoreTick(t *testing.T) {
+	server := NewServer()
+	saved := persist.NewWorld()
+	saved.Tick = 1234
+	defer Restore(server, persist.NewWorld())
+	Restore(server, saved)
+	if tick := server.Tick(); tick != 1234 {
+		t.Errorf("tick %d after restoring a world saved at 1234", tick)
+	}
+	if tick := Snapshot(server).Tick; tick != 1234 {
+		t.Errorf("snapshot of restored world at tick %d", tick)
+	}
+}
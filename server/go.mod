@@ -2,10 +2,12 @@ module wgpu_server
 
 go 1.23.0
 
-require github.com/EngoEngine/glm v0.0.0-20170725114841-9c08f4d1f668
+require (
+	github.com/EngoEngine/glm v0.0.0-20170725114841-9c08f4d1f668
+	github.com/gorilla/websocket v1.5.3
+)
 
 require (
 	github.com/EngoEngine/math v1.0.4 // indirect
 	github.com/gorilla/mux v1.8.1 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
 )
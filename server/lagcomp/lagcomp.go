@@ -0,0 +1,157 @@
+// Package lagcomp keeps a short history of player states so hit-scan
+// queries can be evaluated against what a client saw when it fired.
+package lagcomp
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+	"wgpu_server/ws"
+
+	"github.com/EngoEngine/glm"
+)
+
+// Ray is a half-line starting at Origin. Dir need not be normalized; hit
+// distances are in multiples of its length.
+type Ray struct {
+	Origin glm.Vec3
+	Dir    glm.Vec3
+}
+
+type Hit struct {
+	Client   int
+	Distance float32
+}
+
+type frame struct {
+	tick    uint64
+	at      time.Time
+	players map[int]ws.PlayerData
+}
+
+// History stores player states for the most recent MaxRewind of time. It
+// holds enough frames for ticks as fast as ws.MinTickRate, so the tick rate
+// can change while it is recording.
+type History struct {
+	MaxRewind time.Duration // how far behind the latest frame a query can look
+	Bounds    glm.Vec3      // half extents of a player's bounding box
+
+	lock   sync.Mutex
+	frames []frame
+	next   int
+}
+
+func NewHistory(maxRewind time.Duration) *History {
+	return &History{
+		MaxRewind: maxRewind,
+		Bounds:    glm.Vec3{1, 1, 1},
+		frames:    make([]frame, maxRewind/ws.MinTickRate+1),
+	}
+}
+
+// Record stores a copy of the players' state at tick, which started at at.
+func (h *History) Record(tick uint64, at time.Time, players map[int]ws.PlayerData) {
+	copied := make(map[int]ws.PlayerData, len(players))
+	for id, player := range players {
+		copied[id] = player
+	}
+	h.lock.Lock()
+	h.frames[h.next] = frame{tick, at, copied}
+	h.next = (h.next + 1) % len(h.frames)
+	h.lock.Unlock()
+}
+
+// RewindQuery tests ray against every player's bounding box as it was at
+// tick, clamped to the recorded history, and returns the hits nearest first,
+// ties by client.
+func (h *History) RewindQuery(tick uint64, ray Ray) []Hit {
+	h.lock.Lock()
+	f, ok := h.at(tick)
+	h.lock.Unlock()
+	if !ok {
+		return nil
+	}
+
+	var hits []Hit
+	for id, player := range f.players {
+		min := player.Position.Sub(&h.Bounds)
+		max := player.Position.Add(&h.Bounds)
+		if d, ok := intersect(ray, min, max); ok {
+			hits = append(hits, Hit{Client: id, Distance: d})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		return a.Distance < b.Distance || a.Distance == b.Distance && a.Client < b.Client
+	})
+	return hits
+}
+
+// at returns the frame recorded at tick, or the closest one if tick is
+// outside the history. Frames more than MaxRewind older than the latest are
+// left out.
+func (h *History) at(tick uint64) (frame, bool) {
+	latest := h.frames[(h.next+len(h.frames)-1)%len(h.frames)]
+	var best frame
+	found := false
+	for _, f := range h.frames {
+		if f.players == nil || latest.at.Sub(f.at) > h.MaxRewind {
+			continue
+		}
+		if !found || distance(f.tick, tick) < distance(best.tick, tick) {
+			best, found = f, true
+		}
+	}
+	return best, found
+}
+
+func distance(a, b uint64) uint64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// PerceivedTick estimates which tick a client was looking at when it acted
+// at the current tick: half its round trip ago, plus the delay it renders
+// other players behind the latest snapshot.
+func PerceivedTick(current uint64, rtt, interpolation, tickRate time.Duration) uint64 {
+	if tickRate <= 0 {
+		return current
+	}
+	behind := uint64((rtt/2 + interpolation + tickRate/2) / tickRate)
+	if behind > current {
+		return 0
+	}
+	return current - behind
+}
+
+// intersect returns the distance along ray to the box [min, max] using the
+// slab method.
+func intersect(ray Ray, min, max glm.Vec3) (float32, bool) {
+	near, far := float32(0), float32(math.Inf(1))
+	for i := 0; i < 3; i++ {
+		if ray.Dir[i] == 0 {
+			if ray.Origin[i] < min[i] || ray.Origin[i] > max[i] {
+				return 0, false
+			}
+			continue
+		}
+		t1 := (min[i] - ray.Origin[i]) / ray.Dir[i]
+		t2 := (max[i] - ray.Origin[i]) / ray.Dir[i]
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		if t1 > near {
+			near = t1
+		}
+		if t2 < far {
+			far = t2
+		}
+		if near > far {
+			return 0, false
+		}
+	}
+	return near, true
+}
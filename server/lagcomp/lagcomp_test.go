@@ -0,0 +1,120 @@
+package lagcomp
+
+import (
+	"slices"
+	"testing"
+	"time"
+	"wgpu_server/ws"
+
+	"github.com/EngoEngine/glm"
+)
+
+func player(x float32) ws.PlayerData {
+	return ws.PlayerData{Position: glm.Vec3{x, 0, 0}, Rotation: glm.Quat{W: 1}}
+}
+
+const tickRate = time.Second / 30
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// history records client 1 moving one unit along x each tick, from x = tick,
+// with client 2 standing at x = 20, at 30 ticks a second.
+func history(maxRewind time.Duration, ticks uint64) *History {
+	h := NewHistory(maxRewind)
+	for tick := uint64(1); tick <= ticks; tick++ {
+		h.Record(tick, start.Add(time.Duration(tick)*tickRate), map[int]ws.PlayerData{1: player(float32(tick)), 2: player(20)})
+	}
+	return h
+}
+
+// shoot fires a ray down at x and returns the clients it hits.
+func shoot(h *History, tick uint64, x float32) []int {
+	var clients []int
+	for _, hit := range h.RewindQuery(tick, Ray{Origin: glm.Vec3{x, 10, 0}, Dir: glm.Vec3{0, -1, 0}}) {
+		clients = append(clients, hit.Client)
+	}
+	return clients
+}
+
+func TestRewindQuery(t *testing.T) {
+	h := history(4*tickRate, 10)
+	for _, test := range []struct {
+		tick uint64
+		x    float32
+		want int // client hit, 0 for none
+	}{
+		{tick: 10, x: 10, want: 1},
+		{tick: 8, x: 8, want: 1},
+		{tick: 8, x: 10},
+		{tick: 6, x: 6, want: 1},
+		// Ticks before the history are clamped to its oldest tick, 6.
+		{tick: 2, x: 2},
+		{tick: 2, x: 6, want: 1},
+		// As are ticks after it to the latest.
+		{tick: 50, x: 10, want: 1},
+		{tick: 7, x: 20, want: 2},
+	} {
+		got := shoot(h, test.tick, test.x)
+		if test.want == 0 && len(got) != 0 || test.want != 0 && (len(got) != 1 || got[0] != test.want) {
+			t.Errorf("ray at x %g, tick %d hit %v, want %d", test.x, test.tick, got, test.want)
+		}
+	}
+}
+
+func TestRewindQueryTickRateChange(t *testing.T) {
+	// Ten ticks at 30 a second, then a hundred at 500 a second: the history
+	// still reaches back MaxRewind, across both rates.
+	h := history(250*time.Millisecond, 10)
+	last := start.Add(10 * tickRate)
+	for tick := uint64(11); tick <= 110; tick++ {
+		h.Record(tick, last.Add(time.Duration(tick-10)*2*time.Millisecond), map[int]ws.PlayerData{1: player(float32(tick))})
+	}
+	// The latest frame is 200ms after tick 10, so tick 9 is 233ms before
+	// it, within MaxRewind, and tick 8 266ms, beyond it.
+	if got := shoot(h, 9, 9); len(got) != 1 || got[0] != 1 {
+		t.Errorf("tick 9 hit %v, want [1]", got)
+	}
+	if got := shoot(h, 2, 9); len(got) != 1 || got[0] != 1 {
+		t.Errorf("tick 2 was not clamped to tick 9, hit %v", got)
+	}
+	if got := shoot(h, 60, 60); len(got) != 1 || got[0] != 1 {
+		t.Errorf("tick 60 hit %v, want [1]", got)
+	}
+}
+
+func TestRewindQueryOrder(t *testing.T) {
+	h := NewHistory(0)
+	h.Record(1, start, map[int]ws.PlayerData{1: player(10), 2: player(3), 3: player(6), 4: player(3), 5: player(3)})
+	var got []int
+	for _, hit := range h.RewindQuery(1, Ray{Origin: glm.Vec3{0, 0, 0}, Dir: glm.Vec3{1, 0, 0}}) {
+		got = append(got, hit.Client)
+	}
+	// Ties are broken by client.
+	if want := []int{2, 4, 5, 3, 1}; !slices.Equal(got, want) {
+		t.Errorf("hits %v, want nearest first %v", got, want)
+	}
+	if hits := NewHistory(2*tickRate).RewindQuery(1, Ray{Dir: glm.Vec3{1, 0, 0}}); hits != nil {
+		t.Errorf("empty history hit %v", hits)
+	}
+}
+
+func TestPerceivedTick(t *testing.T) {
+	tick := tickRate
+	for _, test := range []struct {
+		current               uint64
+		rtt, interpolation, r time.Duration
+		want                  uint64
+	}{
+		{current: 100, r: tick, want: 100},
+		// Half the round trip rounded to the nearest tick.
+		{current: 100, rtt: 4 * tick, r: tick, want: 98},
+		{current: 100, rtt: 2 * tick, r: tick, want: 99},
+		{current: 100, rtt: 2 * tick, interpolation: 3 * tick, r: tick, want: 96},
+		{current: 2, rtt: 20 * tick, r: tick, want: 0},
+		{current: 100, rtt: time.Second, r: 0, want: 100},
+	} {
+		if got := PerceivedTick(test.current, test.rtt, test.interpolation, test.r); got != test.want {
+			t.Errorf("PerceivedTick(%d, %v, %v, %v) = %d, want %d", test.current, test.rtt, test.interpolation, test.r, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Package logging configures log/slog for the client and server, and rate
+// limits logging on hot paths.
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options selects the level and format of log output.
+type Options struct {
+	Level  string // debug, info, warn or error
+	Format string // text or json
+}
+
+// RegisterFlags adds -log-level and -log-format to fs, defaulting to the
+// LOG_LEVEL and LOG_FORMAT environment variables.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Level, "log-level", envOr("LOG_LEVEL", "info"), "log level: debug, info, warn or error")
+	fs.StringVar(&o.Format, "log-format", envOr("LOG_FORMAT", "text"), "log format: text or json")
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// Setup installs a default slog logger writing to w.
+func (o *Options) Setup(w io.Writer) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(o.Level)); err != nil {
+		return fmt.Errorf("logging: invalid level %q", o.Level)
+	}
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(o.Format) {
+	case "text", "":
+		handler = slog.NewTextHandler(w, handlerOptions)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOptions)
+	default:
+		return fmt.Errorf("logging: invalid format %q", o.Format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// Limiter allows one log line per interval and counts the lines it
+// suppressed in between.
+type Limiter struct {
+	Interval time.Duration
+
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int
+}
+
+func Every(interval time.Duration) *Limiter {
+	return &Limiter{Interval: interval}
+}
+
+// Allow reports whether a line may be logged now, and how many were
+// suppressed since the last allowed line.
+func (l *Limiter) Allow() (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.last) < l.Interval {
+		l.suppressed++
+		return false, 0
+	}
+	suppressed := l.suppressed
+	l.last, l.suppressed = now, 0
+	return true, suppressed
+}
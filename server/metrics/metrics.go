@@ -0,0 +1,147 @@
+// Package metrics provides lock-free histograms and a writer for the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Histogram counts observations into cumulative buckets with fixed upper
+// bounds.
+type Histogram struct {
+	bounds []float64
+	counts []atomic.Uint64 // one per bound, plus +Inf
+	sum    atomic.Uint64   // float64 bits
+	count  atomic.Uint64
+}
+
+// NewHistogram creates a histogram with the given ascending bucket bounds.
+func NewHistogram(bounds ...float64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]atomic.Uint64, len(bounds)+1),
+	}
+}
+
+// ExponentialBuckets returns n bounds starting at start, each factor times
+// the previous.
+func ExponentialBuckets(start, factor float64, n int) []float64 {
+	bounds := make([]float64, n)
+	for i := range bounds {
+		bounds[i] = start
+		start *= factor
+	}
+	return bounds
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// Writer writes metrics in the Prometheus text format. The first error is
+// kept and returned by Err.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (w *Writer) Err() error {
+	return w.err
+}
+
+func (w *Writer) printf(format string, args ...any) {
+	if w.err == nil {
+		_, w.err = fmt.Fprintf(w.w, format, args...)
+	}
+}
+
+// Header writes the HELP and TYPE lines of a metric.
+func (w *Writer) Header(name, kind, help string) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, helpEscaper.Replace(help), name, kind)
+}
+
+// Sample writes one sample. labels alternate between names and values.
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.printf("%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+// Gauge writes a single unlabelled gauge.
+func (w *Writer) Gauge(name, help string, value float64) {
+	w.Header(name, "gauge", help)
+	w.Sample(name, value)
+}
+
+// Counter writes a single unlabelled counter.
+func (w *Writer) Counter(name, help string, value float64) {
+	w.Header(name, "counter", help)
+	w.Sample(name, value)
+}
+
+// Histogram writes h with its buckets, sum and count.
+func (w *Writer) Histogram(name, help string, h *Histogram) {
+	w.Header(name, "histogram", help)
+	cumulative := uint64(0)
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i].Load()
+		w.Sample(name+"_bucket", float64(cumulative), "le", formatValue(bound))
+	}
+	cumulative += h.counts[len(h.bounds)].Load()
+	w.Sample(name+"_bucket", float64(cumulative), "le", "+Inf")
+	w.Sample(name+"_sum", math.Float64frombits(h.sum.Load()))
+	w.Sample(name+"_count", float64(h.count.Load()))
+}
+
+// The text format escapes only backslashes and newlines in help text, and
+// double quotes as well in label values. Anything else, including invalid
+// UTF-8, is written as it is.
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString("=\"")
+		b.WriteString(labelEscaper.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
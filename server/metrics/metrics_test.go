@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	h := NewHistogram(ExponentialBuckets(0.5, 2, 3)...)
+	for _, v := range []float64{0.1, 0.5, 0.7, 3, 100} {
+		h.Observe(v)
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Gauge("up", "Whether the server is up.", 1)
+	w.Counter("bytes_total", "Bytes sent,\nin total.", 1.5e9)
+	w.Histogram("latency_seconds", `Latency, in seconds \ requests.`, h)
+	w.Header("labelled", "gauge", "Labels of every kind.")
+	w.Sample("labelled", 2, "plain", "a b", "quoted", `say "hi"`)
+	w.Sample("labelled", 3, "path", `C:\temp`, "lines", "one\ntwo")
+	w.Sample("labelled", 4, "unicode", "héllo ✓", "invalid", "\xff\x01")
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := "# HELP up Whether the server is up.\n" +
+		"# TYPE up gauge\n" +
+		"up 1\n" +
+		"# HELP bytes_total Bytes sent,\\nin total.\n" +
+		"# TYPE bytes_total counter\n" +
+		"bytes_total 1.5e+09\n" +
+		"# HELP latency_seconds Latency, in seconds \\\\ requests.\n" +
+		"# TYPE latency_seconds histogram\n" +
+		"latency_seconds_bucket{le=\"0.5\"} 2\n" +
+		"latency_seconds_bucket{le=\"1\"} 3\n" +
+		"latency_seconds_bucket{le=\"2\"} 3\n" +
+		"latency_seconds_bucket{le=\"+Inf\"} 5\n" +
+		"latency_seconds_sum 104.3\n" +
+		"latency_seconds_count 5\n" +
+		"# HELP labelled Labels of every kind.\n" +
+		"# TYPE labelled gauge\n" +
+		"labelled{plain=\"a b\",quoted=\"say \\\"hi\\\"\"} 2\n" +
+		"labelled{path=\"C:\\\\temp\",lines=\"one\\ntwo\"} 3\n" +
+		"labelled{unicode=\"héllo ✓\",invalid=\"\xff\x01\"} 4\n"
+	if got := buf.String(); got != want {
+		t.Errorf("wrote\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+// Package persist saves and restores the server's world state so sessions
+// survive restarts.
+package persist
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"wgpu_server/ws"
+)
+
+// Version is written to every save file. Files from newer versions are
+// refused.
+const Version = 1
+
+const magic = "go_engine world"
+
+// World is the persistent state of the server. Players and rooms are keyed
+// by the identity players log in with rather than their connection id.
+type World struct {
+	Tick    uint64
+	Saved   time.Time
+	Players map[string]ws.PlayerData
+	Rooms   map[string]string
+}
+
+func NewWorld() *World {
+	return &World{
+		Players: make(map[string]ws.PlayerData),
+		Rooms:   make(map[string]string),
+	}
+}
+
+type header struct {
+	Magic   string
+	Version int
+}
+
+// Save writes w to path, replacing the previous file only once the new one
+// is completely written.
+func Save(path string, w *World) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := gob.NewEncoder(tmp)
+	if err := enc.Encode(header{magic, Version}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := enc.Encode(w); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads a world written by Save. A missing file yields an empty world.
+func Load(path string) (*World, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewWorld(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(f)
+	var h header
+	if err := dec.Decode(&h); err != nil || h.Magic != magic {
+		return nil, fmt.Errorf("persist: %s is not a world file", path)
+	}
+	if h.Version > Version {
+		return nil, fmt.Errorf("persist: %s has version %d, newer than %d", path, h.Version, Version)
+	}
+	w := NewWorld()
+	if err := dec.Decode(w); err != nil {
+		return nil, fmt.Errorf("persist: reading %s: %w", path, err)
+	}
+	for identity, player := range w.Players {
+		if player.Validate() != nil {
+			delete(w.Players, identity)
+		}
+	}
+	return w, nil
+}
@@ -0,0 +1,153 @@
+package persist
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	"wgpu_server/ws"
+
+	"github.com/EngoEngine/glm"
+)
+
+// files returns the names in dir.
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "world")
+	w := NewWorld()
+	w.Tick = 1234
+	w.Saved = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	w.Players["alice"] = ws.PlayerData{Position: glm.Vec3{1, 2, 3}, Rotation: glm.QuatIdent()}
+	w.Players["bob"] = ws.PlayerData{Position: glm.Vec3{-4, 0, 9}, Rotation: glm.Quat{W: 0, V: glm.Vec3{0, 1, 0}}}
+	w.Rooms["alice"] = "red"
+	if err := Save(path, w); err != nil {
+		t.Fatal(err)
+	}
+	// Saving again replaces the file.
+	w.Tick = 1300
+	if err := Save(path, w); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, w) {
+		t.Errorf("loaded %+v, want %+v", loaded, w)
+	}
+	if names := files(t, dir); len(names) != 1 {
+		t.Errorf("saving left %v", names)
+	}
+}
+
+func TestLoadDropsInvalidPlayers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world")
+	w := NewWorld()
+	w.Players["good"] = ws.PlayerData{Rotation: glm.QuatIdent()}
+	w.Players["far"] = ws.PlayerData{Position: glm.Vec3{2 * ws.WorldBound, 0, 0}, Rotation: glm.QuatIdent()}
+	w.Players["twisted"] = ws.PlayerData{Rotation: glm.Quat{W: 3}}
+	if err := Save(path, w); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.Players["good"]; !ok || len(loaded.Players) != 1 {
+		t.Errorf("loaded players %v, want only the valid one", loaded.Players)
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	w, err := Load(filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(w, NewWorld()) {
+		t.Errorf("loaded %+v from a missing file, want an empty world", w)
+	}
+}
+
+func TestLoadRefused(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, values ...any) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		enc := gob.NewEncoder(f)
+		for _, v := range values {
+			if err := enc.Encode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return path
+	}
+	valid := filepath.Join(dir, "valid")
+	if err := Save(valid, NewWorld()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(dir, "truncated")
+	if err := os.WriteFile(truncated, data[:len(data)-5], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	garbage := filepath.Join(dir, "garbage")
+	if err := os.WriteFile(garbage, []byte("not a gob at all"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for name, path := range map[string]string{
+		"garbage":       garbage,
+		"truncated":     truncated,
+		"wrong magic":   write("magic", header{"something else", Version}, NewWorld()),
+		"newer version": write("newer", header{magic, Version + 1}, NewWorld()),
+		"wrong body":    write("body", header{magic, Version}, "a string, not a world"),
+		"no body":       write("empty", header{magic, Version}),
+	} {
+		if w, err := Load(path); err == nil {
+			t.Errorf("%s: loaded %+v", name, w)
+		}
+	}
+}
+
+func TestSaveFailureCleansUp(t *testing.T) {
+	dir := t.TempDir()
+	// Renaming onto a directory fails once the temporary file is written.
+	path := filepath.Join(dir, "world")
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "keep"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(path, NewWorld()); err == nil {
+		t.Fatal("saving over a directory succeeded")
+	}
+	if names := files(t, dir); !reflect.DeepEqual(names, []string{"world"}) {
+		t.Errorf("a failed save left %v", names)
+	}
+
+	if err := Save(filepath.Join(dir, "missing", "world"), NewWorld()); err == nil {
+		t.Error("saving into a missing directory succeeded")
+	}
+}
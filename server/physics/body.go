@@ -0,0 +1,235 @@
+// Package physics moves rigid bodies under forces, impulses and gravity.
+//
+// Bodies are integrated with semi-implicit Euler on a fixed timestep:
+// velocities are updated from the forces first and positions from the new
+// velocities. Everything is float32 arithmetic in a fixed order with no
+// randomness or map iteration, so the same inputs give the same results on
+// the server and on every client. Go may fuse a multiply and an add into one
+// instruction on some architectures, such as arm64, which rounds differently
+// from amd64; every product here is converted to float32 explicitly, which
+// the language guarantees is rounded and not fused.
+package physics
+
+import (
+	"math"
+
+	"github.com/EngoEngine/glm"
+)
+
+// Body is a rigid body. A body with zero mass is static: forces, impulses
+// and gravity do not move it, though a velocity set directly still does.
+type Body struct {
+	Position        glm.Vec3 `json:"-"`
+	Rotation        glm.Quat `json:"-"`
+	Velocity        glm.Vec3 `json:"velocity"`         // units per second
+	AngularVelocity glm.Vec3 `json:"angular_velocity"` // world space axis times radians per second
+
+	Mass float32 `json:"mass"`
+	// Inertia holds the moments of inertia about the body's own axes. A zero
+	// component keeps torques from turning the body about that axis.
+	Inertia glm.Vec3 `json:"inertia"`
+
+	// LinearDamping and AngularDamping slow the body down by roughly this
+	// fraction of its velocity per second.
+	LinearDamping  float32 `json:"linear_damping"`
+	AngularDamping float32 `json:"angular_damping"`
+	GravityScale   float32 `json:"gravity_scale"`
+
+	force  glm.Vec3 // accumulated until the next step
+	torque glm.Vec3
+}
+
+// NewBody returns a body of mass at position, with no rotation, the inertia
+// of a solid sphere of radius 1 and full gravity.
+func NewBody(position glm.Vec3, mass float32) Body {
+	return Body{
+		Position:     position,
+		Rotation:     glm.QuatIdent(),
+		Mass:         mass,
+		Inertia:      SphereInertia(mass, 1),
+		GravityScale: 1,
+	}
+}
+
+// SphereInertia returns the moments of inertia of a solid sphere.
+func SphereInertia(mass, radius float32) glm.Vec3 {
+	i := float32(float32(0.4*mass) * float32(radius*radius))
+	return glm.Vec3{i, i, i}
+}
+
+// BoxInertia returns the moments of inertia of a solid box.
+func BoxInertia(mass float32, halfExtents glm.Vec3) glm.Vec3 {
+	x, y, z := 2*halfExtents[0], 2*halfExtents[1], 2*halfExtents[2]
+	m := mass / 12
+	return glm.Vec3{
+		float32(m * (float32(y*y) + float32(z*z))),
+		float32(m * (float32(x*x) + float32(z*z))),
+		float32(m * (float32(x*x) + float32(y*y))),
+	}
+}
+
+// CapsuleInertia approximates the moments of inertia of an upright capsule
+// by those of a cylinder of the same total height.
+func CapsuleInertia(mass, radius, height float32) glm.Vec3 {
+	r2 := float32(radius * radius)
+	side := float32(mass / 12 * (float32(3*r2) + float32(height*height)))
+	return glm.Vec3{side, float32(float32(0.5*mass) * r2), side}
+}
+
+func (b *Body) Static() bool {
+	return b.Mass <= 0
+}
+
+// InverseMass returns 1/Mass, or 0 for static bodies.
+func (b *Body) InverseMass() float32 {
+	if b.Static() {
+		return 0
+	}
+	return 1 / b.Mass
+}
+
+// InverseInertia returns the world space inverse inertia tensor.
+func (b *Body) InverseInertia() glm.Mat3 {
+	var m glm.Mat3
+	for i := range 3 {
+		var axis glm.Vec3
+		axis[i] = 1
+		column := b.applyInverseInertia(axis)
+		copy(m[i*3:i*3+3], column[:])
+	}
+	return m
+}
+
+// applyInverseInertia returns the world space inverse inertia tensor times
+// v, by turning v into the body's frame, scaling it there and turning it
+// back.
+func (b *Body) applyInverseInertia(v glm.Vec3) glm.Vec3 {
+	if b.Static() {
+		return glm.Vec3{}
+	}
+	inverse := glm.Quat{W: b.Rotation.W, V: scale(b.Rotation.V, -1)}
+	local := rotate(inverse, v)
+	for i := range 3 {
+		if b.Inertia[i] > 0 {
+			local[i] /= b.Inertia[i]
+		} else {
+			local[i] = 0
+		}
+	}
+	return rotate(b.Rotation, local)
+}
+
+// ApplyForce pushes the body through its center of mass until the next
+// step.
+func (b *Body) ApplyForce(force glm.Vec3) {
+	b.force = add(b.force, force)
+}
+
+// ApplyForceAt pushes the body at a world space point until the next step,
+// turning it as well unless the force points through its center.
+func (b *Body) ApplyForceAt(force, point glm.Vec3) {
+	b.ApplyForce(force)
+	b.ApplyTorque(cross(sub(point, b.Position), force))
+}
+
+func (b *Body) ApplyTorque(torque glm.Vec3) {
+	b.torque = add(b.torque, torque)
+}
+
+// ApplyImpulse changes the body's velocity at once, by impulse/Mass.
+func (b *Body) ApplyImpulse(impulse glm.Vec3) {
+	b.Velocity = add(b.Velocity, scale(impulse, b.InverseMass()))
+}
+
+// ApplyImpulseAt applies impulse at a world space point, changing the
+// angular velocity too.
+func (b *Body) ApplyImpulseAt(impulse, point glm.Vec3) {
+	b.ApplyImpulse(impulse)
+	b.ApplyAngularImpulse(cross(sub(point, b.Position), impulse))
+}
+
+func (b *Body) ApplyAngularImpulse(impulse glm.Vec3) {
+	b.AngularVelocity = add(b.AngularVelocity, b.applyInverseInertia(impulse))
+}
+
+// VelocityAt returns the velocity of the body's material at a world space
+// point.
+func (b *Body) VelocityAt(point glm.Vec3) glm.Vec3 {
+	return add(b.Velocity, cross(b.AngularVelocity, sub(point, b.Position)))
+}
+
+// ClearForces drops the forces and torques applied since the last step.
+func (b *Body) ClearForces() {
+	b.force = glm.Vec3{}
+	b.torque = glm.Vec3{}
+}
+
+// Integrate advances the body by dt seconds under gravity and the forces
+// applied since the last step, then clears them.
+func (b *Body) Integrate(gravity glm.Vec3, dt float32) {
+	if !b.Static() {
+		acceleration := add(scale(b.force, 1/b.Mass), scale(gravity, b.GravityScale))
+		b.Velocity = add(b.Velocity, scale(acceleration, dt))
+		b.AngularVelocity = add(b.AngularVelocity, scale(b.applyInverseInertia(b.torque), dt))
+	}
+	b.Velocity = scale(b.Velocity, 1/(1+float32(dt*b.LinearDamping)))
+	b.AngularVelocity = scale(b.AngularVelocity, 1/(1+float32(dt*b.AngularDamping)))
+
+	b.Position = add(b.Position, scale(b.Velocity, dt))
+	if b.AngularVelocity != (glm.Vec3{}) {
+		// dq/dt = 1/2 ω q
+		spin := glm.Quat{V: scale(b.AngularVelocity, float32(0.5*dt))}
+		change := mulQuat(spin, b.Rotation)
+		b.Rotation = normalize(glm.Quat{W: b.Rotation.W + change.W, V: add(b.Rotation.V, change.V)})
+	}
+	b.ClearForces()
+}
+
+// The vector and quaternion arithmetic of a step, with every product
+// rounded to float32 so it cannot be fused with an add.
+
+func add(a, b glm.Vec3) glm.Vec3 {
+	return glm.Vec3{a[0] + b[0], a[1] + b[1], a[2] + b[2]}
+}
+
+func sub(a, b glm.Vec3) glm.Vec3 {
+	return glm.Vec3{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func scale(a glm.Vec3, s float32) glm.Vec3 {
+	return glm.Vec3{float32(a[0] * s), float32(a[1] * s), float32(a[2] * s)}
+}
+
+func dot(a, b glm.Vec3) float32 {
+	return float32(a[0]*b[0]) + float32(a[1]*b[1]) + float32(a[2]*b[2])
+}
+
+func cross(a, b glm.Vec3) glm.Vec3 {
+	return glm.Vec3{
+		float32(a[1]*b[2]) - float32(a[2]*b[1]),
+		float32(a[2]*b[0]) - float32(a[0]*b[2]),
+		float32(a[0]*b[1]) - float32(a[1]*b[0]),
+	}
+}
+
+func mulQuat(p, q glm.Quat) glm.Quat {
+	return glm.Quat{
+		W: float32(p.W*q.W) - dot(p.V, q.V),
+		V: add(add(scale(q.V, p.W), scale(p.V, q.W)), cross(p.V, q.V)),
+	}
+}
+
+// rotate turns v by the unit quaternion q.
+func rotate(q glm.Quat, v glm.Vec3) glm.Vec3 {
+	// v + 2w(u×v) + 2u×(u×v)
+	t := scale(cross(q.V, v), 2)
+	return add(add(v, scale(t, q.W)), cross(q.V, t))
+}
+
+func normalize(q glm.Quat) glm.Quat {
+	l := float32(math.Sqrt(float64(float32(q.W*q.W) + dot(q.V, q.V))))
+	if l == 0 {
+		return glm.QuatIdent()
+	}
+	return glm.Quat{W: q.W / l, V: glm.Vec3{q.V[0] / l, q.V[1] / l, q.V[2] / l}}
+}
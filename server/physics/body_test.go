@@ -0,0 +1,55 @@
+package physics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/EngoEngine/glm"
+)
+
+// scenario steps a tumbling box pushed off center and a damped sphere
+// through two seconds of fixed steps.
+func scenario() []*Body {
+	box := NewBody(glm.Vec3{0, 10, 0}, 3)
+	box.Inertia = BoxInertia(3, glm.Vec3{0.5, 0.25, 1})
+	box.AngularVelocity = glm.Vec3{0.3, -1.1, 0.7}
+	box.ApplyImpulseAt(glm.Vec3{1.5, 0, -0.25}, glm.Vec3{0.4, 10.2, 0.9})
+
+	sphere := NewBody(glm.Vec3{-2, 1, 3}, 0.7)
+	sphere.Velocity = glm.Vec3{4, 6, -1}
+	sphere.LinearDamping = 0.3
+	sphere.AngularDamping = 0.1
+	sphere.GravityScale = 0.5
+
+	w := NewWorld()
+	w.Add(&box)
+	w.Add(&sphere)
+	for i := range 120 {
+		box.ApplyForceAt(glm.Vec3{0, 0, float32(i%7) * 0.1}, glm.Vec3{0.5, box.Position[1], 0})
+		sphere.ApplyTorque(glm.Vec3{0.01, 0, -0.02})
+		w.Step(1.0 / 60)
+	}
+	return w.Bodies
+}
+
+// bits returns the bit patterns of a body's position and rotation.
+func bits(b *Body) [7]uint32 {
+	var out [7]uint32
+	for i, f := range []float32{b.Position[0], b.Position[1], b.Position[2], b.Rotation.W, b.Rotation.V[0], b.Rotation.V[1], b.Rotation.V[2]} {
+		out[i] = math.Float32bits(f)
+	}
+	return out
+}
+
+func TestDeterministic(t *testing.T) {
+	// Captured on amd64. Every architecture must reproduce them bit for bit.
+	golden := [][7]uint32{
+		{0x3f7ffff6, 0xc11c892e, 0x3cfa6319, 0x3f6f4cb9, 0x3e7d84c6, 0x3cb7da56, 0xbe81f2d8},
+		{0x40802814, 0x3fed1a2c, 0x3fbfd7ed, 0x3f7f461e, 0x3d09de6b, 0x0, 0xbd89de6b},
+	}
+	for i, b := range scenario() {
+		if got := bits(b); got != golden[i] {
+			t.Errorf("body %d ended at %#v, want %#v", i, got, golden[i])
+		}
+	}
+}
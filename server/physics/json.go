@@ -0,0 +1,31 @@
+package physics
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/EngoEngine/glm"
+)
+
+// UnmarshalJSON reads a body's mass and motion; its pose is not stored.
+// Missing fields default to those of NewBody, with the inertia of a sphere
+// of radius 1 and the given mass.
+func (b *Body) UnmarshalJSON(data []byte) error {
+	type fields Body // without this method
+	v := struct {
+		*fields
+		Inertia *glm.Vec3 `json:"inertia"`
+	}{fields: (*fields)(b)}
+	*b = NewBody(glm.Vec3{}, 1)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&v); err != nil {
+		return err
+	}
+	if v.Inertia != nil {
+		b.Inertia = *v.Inertia
+	} else {
+		b.Inertia = SphereInertia(b.Mass, 1)
+	}
+	return nil
+}
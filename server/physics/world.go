@@ -0,0 +1,87 @@
+package physics
+
+import (
+	"fmt"
+
+	"github.com/EngoEngine/glm"
+)
+
+// Gravity is the default acceleration of falling bodies, in units per
+// second squared.
+var Gravity = glm.Vec3{0, -9.81, 0}
+
+// World integrates a set of bodies together, in the order they were added.
+type World struct {
+	Gravity glm.Vec3
+	Bodies  []*Body
+}
+
+func NewWorld() *World {
+	return &World{Gravity: Gravity}
+}
+
+func (w *World) Add(b *Body) {
+	w.Bodies = append(w.Bodies, b)
+}
+
+// Remove removes b, keeping the order of the others.
+func (w *World) Remove(b *Body) {
+	for i, body := range w.Bodies {
+		if body == b {
+			w.Bodies = append(w.Bodies[:i], w.Bodies[i+1:]...)
+			return
+		}
+	}
+}
+
+// Step advances every body by dt seconds.
+func (w *World) Step(dt float32) {
+	for _, b := range w.Bodies {
+		b.Integrate(w.Gravity, dt)
+	}
+}
+
+// Clock turns variable frame times into a whole number of fixed steps, so
+// a simulation runs the same however fast frames are.
+type Clock struct {
+	Step     float64 // seconds per step
+	MaxSteps int     // most steps one Advance returns, 0 for no limit
+
+	pending float64
+}
+
+// NewClock returns a clock of step seconds per step. It panics if step is
+// not positive.
+func NewClock(step float64) Clock {
+	if !(step > 0) {
+		panic(fmt.Sprintf("physics: clock step %v is not positive", step))
+	}
+	return Clock{Step: step, MaxSteps: 8}
+}
+
+// Advance adds elapsed seconds and returns how many steps are due. Time
+// beyond MaxSteps steps is dropped, so a long stall does not make the next
+// frames slower still. A clock whose Step is not positive never steps.
+func (c *Clock) Advance(elapsed float64) int {
+	if !(c.Step > 0) {
+		return 0
+	}
+	c.pending += elapsed
+	steps := int(c.pending / c.Step)
+	if c.MaxSteps > 0 && steps > c.MaxSteps {
+		steps = c.MaxSteps
+		c.pending = 0
+		return steps
+	}
+	c.pending -= float64(float64(steps) * c.Step)
+	return steps
+}
+
+// Alpha returns how far into the next step the clock is, from 0 to 1, for
+// interpolating between the last two steps.
+func (c *Clock) Alpha() float64 {
+	if !(c.Step > 0) {
+		return 0
+	}
+	return c.pending / c.Step
+}
@@ -0,0 +1,30 @@
+package physics
+
+import "testing"
+
+func TestClock(t *testing.T) {
+	c := NewClock(0.25)
+	for _, step := range []struct {
+		elapsed float64
+		want    int
+	}{{0.1, 0}, {0.2, 1}, {0.5, 2}, {100, 8}, {0.3, 1}} {
+		if got := c.Advance(step.elapsed); got != step.want {
+			t.Errorf("Advance(%v) = %d, want %d", step.elapsed, got, step.want)
+		}
+	}
+
+	for _, step := range []float64{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewClock(%v) did not panic", step)
+				}
+			}()
+			NewClock(step)
+		}()
+	}
+	var zero Clock
+	if steps, alpha := zero.Advance(1), zero.Alpha(); steps != 0 || alpha != 0 {
+		t.Errorf("zero clock stepped %d times, alpha %v", steps, alpha)
+	}
+}
@@ -0,0 +1,182 @@
+package replay
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"wgpu_server/ws"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrClosed is returned by a Player once it is closed.
+var ErrClosed = errors.New("replay: player closed")
+
+// Player plays back the messages a replay sent to one client. It implements
+// ws.Conn, so a client can read from it in place of a live connection.
+// Messages written to it are discarded.
+type Player struct {
+	replay *Replay
+	client int
+
+	mu       sync.Mutex
+	next     int
+	position time.Duration // playback time when resumed was taken
+	resumed  time.Time
+	speed    float64
+	paused   bool
+	wake     chan struct{}
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// NewPlayer plays the broadcasts in replay and the messages sent to client,
+// or only broadcasts if client is -1. It starts playing at normal speed.
+func NewPlayer(replay *Replay, client int) *Player {
+	return &Player{
+		replay:  replay,
+		client:  client,
+		resumed: time.Now(),
+		speed:   1,
+		wake:    make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+}
+
+// Duration returns the length of the replay.
+func (p *Player) Duration() time.Duration {
+	return p.replay.Duration()
+}
+
+// Position returns the current playback time.
+func (p *Player) Position() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.now()
+}
+
+func (p *Player) now() time.Duration {
+	if p.paused {
+		return p.position
+	}
+	return p.position + time.Duration(float64(time.Since(p.resumed))*p.speed)
+}
+
+// Speed returns the playback speed, 1 being real time.
+func (p *Player) Speed() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.speed
+}
+
+func (p *Player) SetSpeed(speed float64) {
+	if speed <= 0 {
+		return
+	}
+	p.mu.Lock()
+	p.position, p.resumed = p.now(), time.Now()
+	p.speed = speed
+	p.mu.Unlock()
+	p.signal()
+}
+
+func (p *Player) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+func (p *Player) SetPaused(paused bool) {
+	p.mu.Lock()
+	p.position, p.resumed = p.now(), time.Now()
+	p.paused = paused
+	p.mu.Unlock()
+	p.signal()
+}
+
+// Seek moves playback to t. The latest snapshot at or before t is delivered
+// straight away so the view catches up even while paused.
+func (p *Player) Seek(t time.Duration) {
+	t = max(0, min(t, p.Duration()))
+	p.mu.Lock()
+	p.position, p.resumed = t, time.Now()
+	records := p.replay.Records
+	p.next = len(records)
+	for i, record := range records {
+		if record.Time >= t {
+			p.next = i
+			break
+		}
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Time <= t && p.plays(records[i]) && records[i].Message[0] == ws.ServerSnapshot {
+			p.next = min(p.next, i)
+			break
+		}
+	}
+	p.mu.Unlock()
+	p.signal()
+}
+
+// plays reports whether record is played back to the client.
+func (p *Player) plays(record Record) bool {
+	return !record.In && len(record.Message) > 0 && (record.Client == -1 || record.Client == p.client)
+}
+
+func (p *Player) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ReadMessage blocks until the next message is due. At the end of the replay
+// it waits for a Seek or Close.
+func (p *Player) ReadMessage() (int, []byte, error) {
+	for {
+		p.mu.Lock()
+		records := p.replay.Records
+		for p.next < len(records) && !p.plays(records[p.next]) {
+			p.next++
+		}
+		var wait time.Duration = -1
+		if p.next < len(records) {
+			record := records[p.next]
+			due := record.Time - p.now()
+			if due <= 0 {
+				p.next++
+				p.mu.Unlock()
+				return websocket.BinaryMessage, record.Message, nil
+			}
+			if !p.paused {
+				wait = time.Duration(float64(due) / p.speed)
+			}
+		}
+		p.mu.Unlock()
+
+		var timer <-chan time.Time
+		if wait >= 0 {
+			timer = time.After(wait)
+		}
+		select {
+		case <-timer:
+		case <-p.wake:
+		case <-p.closed:
+			return -1, nil, ErrClosed
+		}
+	}
+}
+
+func (p *Player) WriteMessage(messageType int, data []byte) error {
+	select {
+	case <-p.closed:
+		return ErrClosed
+	default:
+		return nil
+	}
+}
+
+func (p *Player) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
@@ -0,0 +1,144 @@
+package replay
+
+import (
+	"testing"
+	"time"
+	"wgpu_server/ws"
+)
+
+// snapshots is a replay with a broadcast snapshot every 100ms for a second,
+// a chat message to client 2 at 150ms and an inbound message between them.
+func snapshots() *Replay {
+	r := &Replay{TickRate: 100 * time.Millisecond}
+	for i := range 10 {
+		r.Records = append(r.Records, Record{Time: time.Duration(i) * 100 * time.Millisecond, Tick: uint64(i), Client: -1, Message: []byte{ws.ServerSnapshot, byte(i)}})
+		if i == 1 {
+			r.Records = append(r.Records,
+				Record{Time: 120 * time.Millisecond, Tick: 1, Client: 1, In: true, Message: []byte{0}},
+				Record{Time: 150 * time.Millisecond, Tick: 1, Client: 2, Message: []byte{ws.ServerChat, 'h', 'i'}})
+		}
+	}
+	return r
+}
+
+// next reads a message from p, failing if none arrives within timeout.
+func next(t *testing.T, p *Player, timeout time.Duration) []byte {
+	t.Helper()
+	messages := make(chan []byte, 1)
+	go func() {
+		_, m, err := p.ReadMessage()
+		if err == nil {
+			messages <- m
+		}
+	}()
+	select {
+	case m := <-messages:
+		return m
+	case <-time.After(timeout):
+		t.Fatalf("no message within %v", timeout)
+		return nil
+	}
+}
+
+func TestPlayerSeekPaused(t *testing.T) {
+	p := NewPlayer(snapshots(), 1)
+	defer p.Close()
+	p.SetPaused(true)
+	p.Seek(450 * time.Millisecond)
+	// The snapshot before the seek is delivered while paused.
+	if m := next(t, p, time.Second); m[1] != 4 {
+		t.Fatalf("got snapshot %d after seeking, want 4", m[1])
+	}
+	if pos := p.Position(); pos != 450*time.Millisecond {
+		t.Errorf("paused at %v, want 450ms", pos)
+	}
+
+	messages := make(chan []byte, 1)
+	go func() {
+		_, m, err := p.ReadMessage()
+		if err == nil {
+			messages <- m
+		}
+	}()
+	select {
+	case m := <-messages:
+		t.Fatalf("got %v while paused", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if pos := p.Position(); pos != 450*time.Millisecond {
+		t.Errorf("paused playback moved to %v", pos)
+	}
+	p.SetPaused(false)
+	select {
+	case m := <-messages:
+		if m[1] != 5 {
+			t.Errorf("got snapshot %d after resuming, want 5", m[1])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("resuming did not play the next snapshot")
+	}
+
+	// Seeking back replays from the earlier snapshot, past the end clamps.
+	p.Seek(-time.Second)
+	if m := next(t, p, time.Second); m[1] != 0 {
+		t.Errorf("got snapshot %d after seeking to the start, want 0", m[1])
+	}
+	p.SetPaused(true)
+	p.Seek(time.Hour)
+	if pos := p.Position(); pos != p.Duration() {
+		t.Errorf("seeking past the end went to %v, want %v", pos, p.Duration())
+	}
+	if m := next(t, p, time.Second); m[1] != 9 {
+		t.Errorf("got snapshot %d at the end, want 9", m[1])
+	}
+}
+
+func TestPlayerSpeed(t *testing.T) {
+	p := NewPlayer(snapshots(), 2)
+	defer p.Close()
+	p.SetSpeed(0)
+	if p.Speed() != 1 {
+		t.Errorf("SetSpeed(0) changed the speed to %v", p.Speed())
+	}
+	p.SetSpeed(20)
+	start := time.Now()
+	var got []byte
+	for range 11 {
+		m := next(t, p, time.Second)
+		got = append(got, m[0])
+	}
+	// A second of replay at 20 times speed takes 50ms.
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("playing at 20x took %v", elapsed)
+	}
+	// Client 2 gets its chat message between the snapshots, but not the
+	// inbound message.
+	want := []byte{ws.ServerSnapshot, ws.ServerSnapshot, ws.ServerChat}
+	if string(got[:3]) != string(want) {
+		t.Errorf("played message types %v, want %v first", got, want)
+	}
+}
+
+func TestPlayerClose(t *testing.T) {
+	p := NewPlayer(snapshots(), 1)
+	p.SetPaused(true)
+	p.Seek(p.Duration())
+	next(t, p, time.Second)
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := p.ReadMessage()
+		errs <- err
+	}()
+	p.Close()
+	select {
+	case err := <-errs:
+		if err != ErrClosed {
+			t.Errorf("ReadMessage after Close: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not stop ReadMessage")
+	}
+	if err := p.WriteMessage(0, nil); err != ErrClosed {
+		t.Errorf("WriteMessage after Close: %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+// Package replay records the traffic of a server to a file and plays it back
+// as if it came from a live connection.
+package replay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Version is written to every replay file. Files of other versions are
+// refused: version 1 recorded snapshots with a one byte player count.
+const Version = 2
+
+const magic = "go_engine replay"
+
+const (
+	kindIn  = 0
+	kindOut = 1
+)
+
+// FlushInterval is how often a Recorder writes its buffered records to the
+// file, bounding what a crashed server loses.
+const FlushInterval = time.Second
+
+// maxRecord bounds the size of a recorded message read back from a file.
+const maxRecord = 1 << 24
+
+// Record is one message handled or sent by the server.
+type Record struct {
+	Time    time.Duration // since recording started
+	Tick    uint64
+	Client  int  // sender of inbound messages, recipient or -1 of outbound ones
+	In      bool // received from Client rather than sent to it
+	Message []byte
+}
+
+// Recorder writes records to a replay file. It implements ws.Recorder.
+type Recorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	w     *bufio.Writer
+	start time.Time
+	err   error
+	buf   []byte
+	done  chan struct{}
+}
+
+// Create starts a replay file at path for a server ticking every tickRate.
+func Create(path string, tickRate time.Duration) (*Recorder, error) {
+	return create(path, tickRate, FlushInterval)
+}
+
+func create(path string, tickRate, flushInterval time.Duration) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{file: f, w: bufio.NewWriter(f), start: time.Now(), done: make(chan struct{})}
+	r.buf = append(r.buf, magic...)
+	r.buf = binary.AppendUvarint(r.buf, Version)
+	r.buf = binary.AppendUvarint(r.buf, uint64(tickRate))
+	if _, err := r.w.Write(r.buf); err != nil {
+		f.Close()
+		return nil, err
+	}
+	go r.flushEvery(flushInterval)
+	return r, nil
+}
+
+// flushEvery flushes the recorder every interval until it is closed.
+func (r *Recorder) flushEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Flush(); err != nil && err != os.ErrClosed {
+				slog.Error("recording stopped", "path", r.file.Name(), "err", err)
+				return
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *Recorder) RecordIn(tick uint64, id int, message []byte) {
+	r.record(kindIn, tick, id, message)
+}
+
+func (r *Recorder) RecordOut(tick uint64, client int, message []byte) {
+	r.record(kindOut, tick, client, message)
+}
+
+func (r *Recorder) record(kind byte, tick uint64, client int, message []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	r.buf = append(r.buf[:0], kind)
+	r.buf = binary.AppendUvarint(r.buf, uint64(time.Since(r.start)))
+	r.buf = binary.AppendUvarint(r.buf, tick)
+	r.buf = binary.AppendVarint(r.buf, int64(client))
+	r.buf = binary.AppendUvarint(r.buf, uint64(len(message)))
+	r.buf = append(r.buf, message...)
+	if _, err := r.w.Write(r.buf); err != nil {
+		r.err = err
+		slog.Error("recording stopped", "path", r.file.Name(), "err", err)
+	}
+}
+
+// Flush writes buffered records to the file.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.err = r.w.Flush()
+	return r.err
+}
+
+// Close flushes and closes the file. Later records are dropped.
+func (r *Recorder) Close() error {
+	err := r.Flush()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.done:
+	default:
+		close(r.done)
+	}
+	if r.err == nil {
+		r.err = os.ErrClosed
+	}
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Replay is the content of a replay file.
+type Replay struct {
+	TickRate time.Duration
+	Records  []Record
+}
+
+// Duration returns the time of the last record.
+func (r *Replay) Duration() time.Duration {
+	if len(r.Records) == 0 {
+		return 0
+	}
+	return r.Records[len(r.Records)-1].Time
+}
+
+// Load reads a replay file. A file cut off mid-record, as left by a server
+// that did not shut down cleanly, yields the records before the cut.
+func Load(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, header); err != nil || string(header) != magic {
+		return nil, fmt.Errorf("replay: %s is not a replay file", path)
+	}
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("replay: reading %s: %w", path, err)
+	}
+	if version != Version {
+		return nil, fmt.Errorf("replay: %s has version %d, only %d can be played", path, version, Version)
+	}
+	tickRate, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("replay: reading %s: %w", path, err)
+	}
+
+	replay := &Replay{TickRate: time.Duration(tickRate)}
+	for {
+		record, err := readRecord(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return replay, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("replay: reading %s: %w", path, err)
+		}
+		replay.Records = append(replay.Records, record)
+	}
+}
+
+func readRecord(r *bufio.Reader) (Record, error) {
+	var record Record
+	kind, err := r.ReadByte()
+	if err != nil {
+		return record, err
+	}
+	if kind != kindIn && kind != kindOut {
+		return record, fmt.Errorf("unknown record kind %d", kind)
+	}
+	record.In = kind == kindIn
+	t, err := binary.ReadUvarint(r)
+	if err != nil {
+		return record, unexpected(err)
+	}
+	record.Time = time.Duration(t)
+	if record.Tick, err = binary.ReadUvarint(r); err != nil {
+		return record, unexpected(err)
+	}
+	client, err := binary.ReadVarint(r)
+	if err != nil {
+		return record, unexpected(err)
+	}
+	record.Client = int(client)
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return record, unexpected(err)
+	}
+	if n > maxRecord {
+		return record, errors.New("record too large")
+	}
+	record.Message = make([]byte, n)
+	if _, err := io.ReadFull(r, record.Message); err != nil {
+		return record, unexpected(err)
+	}
+	return record, nil
+}
+
+// unexpected reports an end of file inside a record as truncation.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
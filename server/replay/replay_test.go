@@ -0,0 +1,134 @@
+package replay
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func record(t *testing.T, path string) []Record {
+	t.Helper()
+	r, err := Create(path, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Tick: 1, Client: 3, In: true, Message: []byte{1, 2, 3}},
+		{Tick: 1, Client: -1, Message: []byte{0, 9}},
+		{Tick: 2, Client: 3, Message: []byte{1}},
+		{Tick: 2, Client: 4, In: true, Message: []byte{}},
+	}
+	for _, record := range want {
+		if record.In {
+			r.RecordIn(record.Tick, record.Client, record.Message)
+		} else {
+			r.RecordOut(record.Tick, record.Client, record.Message)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r.RecordOut(3, -1, []byte{0})
+	return want
+}
+
+// same reports whether records match, ignoring their times.
+func same(got, want []Record) bool {
+	return slices.EqualFunc(got, want, func(a, b Record) bool {
+		return a.Tick == b.Tick && a.Client == b.Client && a.In == b.In && slices.Equal(a.Message, b.Message)
+	})
+}
+
+func TestRecordLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay")
+	want := record(t, path)
+	replay, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.TickRate != 50*time.Millisecond {
+		t.Errorf("tick rate %v, want 50ms", replay.TickRate)
+	}
+	if !same(replay.Records, want) {
+		t.Errorf("loaded %v, want %v", replay.Records, want)
+	}
+	if !slices.IsSortedFunc(replay.Records, func(a, b Record) int { return int(a.Time - b.Time) }) {
+		t.Error("record times go backwards")
+	}
+}
+
+func TestLoadTruncated(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "replay")
+	want := record(t, path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := len(binary.AppendUvarint(binary.AppendUvarint([]byte(magic), Version), uint64(50*time.Millisecond)))
+	cut := filepath.Join(dir, "cut")
+	for n := range len(data) {
+		if err := os.WriteFile(cut, data[:n], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		replay, err := Load(cut)
+		if n < header {
+			if err == nil {
+				t.Errorf("a file cut to %d bytes inside the header loaded", n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("cut to %d bytes: %v", n, err)
+		}
+		if len(replay.Records) == len(want) || !same(replay.Records, want[:len(replay.Records)]) {
+			t.Errorf("cut to %d bytes, loaded %v", n, replay.Records)
+		}
+	}
+}
+
+func TestLoadRefused(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"not a replay": []byte("{\"version\": 1}"),
+		"old version":  binary.AppendUvarint(binary.AppendUvarint([]byte(magic), 1), uint64(time.Second)),
+		"bad kind":     append(binary.AppendUvarint(binary.AppendUvarint([]byte(magic), Version), uint64(time.Second)), 7, 0, 0, 0, 0),
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: loaded", name)
+		}
+	}
+	if _, err := Load(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("loading a missing file: %v", err)
+	}
+}
+
+func TestRecorderFlushes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay")
+	r, err := create(path, time.Second, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.RecordOut(1, -1, []byte{0, 1})
+	// The record reaches the file without Close, as it must for a server
+	// that crashes.
+	deadline := time.Now().Add(time.Second)
+	for {
+		replay, err := Load(path)
+		if err == nil && len(replay.Records) == 1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("record not flushed: %v, %v", replay, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
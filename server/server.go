@@ -1,68 +1,125 @@
 package main
 
 import (
-	"fmt"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
-	"unsafe"
+	"wgpu_server/admin"
+	"wgpu_server/game"
+	"wgpu_server/lagcomp"
+	"wgpu_server/logging"
+	"wgpu_server/persist"
+	"wgpu_server/replay"
 	"wgpu_server/ws"
 )
 
-func Encode[T any](v []T, len int) []byte {
-	return unsafe.Slice((*byte)(unsafe.Pointer(&v[0])), len*int(unsafe.Sizeof(v[0])))
-}
+var addr = flag.String("addr", ":8080", "http service address")
+var compress = flag.Bool("compress", false, "deflate large snapshots sent to clients")
+var rateLimit = flag.Float64("rate-limit", 240, "messages per second accepted from each client, 0 for no limit")
+var rateKick = flag.Int("rate-kick", 1000, "disconnect clients dropping more than this many messages in a second, 0 to never disconnect")
+var maxRewind = flag.Duration("max-rewind", game.MaxRewind, "how far back lag compensated queries can look")
+var adminToken = flag.String("admin-token", os.Getenv("ADMIN_TOKEN"), "bearer token for the /admin endpoint, empty to disable it")
+var console = flag.Bool("console", true, "read admin commands from stdin")
+var maxErrors = flag.Int("max-errors", 10, "disconnect clients after this many invalid messages, 0 to never disconnect")
+var worldPath = flag.String("world", "world.gob", "file the world is saved to and restored from, empty to disable")
+var saveInterval = flag.Duration("save-interval", time.Minute, "how often the world is saved")
+var record = flag.String("record", "", "record all traffic to this replay file")
+var logOptions logging.Options
+
 func main() {
-	server := ws.StartServer(messageHandler)
-	server.Poll(time.Second/30.0, func() {
-		server.Lock.Lock()
-		numPlayers := len(ws.Players)
-		if numPlayers == 0 {
-			server.Lock.Unlock()
-			return
-		}
-		mPlayers := make([]ws.Message, numPlayers)
-		i := 0
-		for id, player := range ws.Players {
-			mPlayers[i] = ws.Message{Client: id, Data: player}
-			i++
+	server := game.NewServer()
+	server.Conditions.RegisterFlags(flag.CommandLine)
+	logOptions.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := logOptions.Setup(os.Stderr); err != nil {
+		slog.Error("invalid logging options", "err", err)
+		os.Exit(2)
+	}
+	if *maxRewind < 0 {
+		slog.Error("invalid -max-rewind, it must not be negative", "max-rewind", *maxRewind)
+		os.Exit(2)
+	}
+	server.Codec.Compress = *compress
+	server.RateLimit = ws.RateLimit{PerSecond: *rateLimit, Burst: *rateLimit, Disconnect: *rateKick}
+	server.MaxErrors = *maxErrors
+	game.History = lagcomp.NewHistory(*maxRewind)
+
+	if *worldPath != "" {
+		world, err := persist.Load(*worldPath)
+		if err != nil {
+			slog.Error("could not restore world", "path", *worldPath, "err", err)
+			os.Exit(1)
 		}
-		server.Lock.Unlock()
-		for i := range mPlayers {
-			player := mPlayers[i]
-			fmt.Printf("Player %d: %v, %v\n", player.Client, player.Data.Position, player.Data.Rotation)
+		slog.Info("restored world", "path", *worldPath, "players", len(world.Players), "saved", world.Saved, "tick", world.Tick)
+		game.Restore(server, world)
+		go func() {
+			for range time.Tick(*saveInterval) {
+				save(server)
+			}
+		}()
+	}
+
+	var recorder *replay.Recorder
+	if *record != "" {
+		var err error
+		recorder, err = replay.Create(*record, game.TickRate)
+		if err != nil {
+			slog.Error("could not start recording", "path", *record, "err", err)
+			os.Exit(1)
 		}
-		println()
-		// println(mPlayers)
-		// println(unsafe.Sizeof(Players))
-		// PlayersBytes := (*[unsafe.Sizeof(mPlayers)]byte)(unsafe.Pointer(&mPlayers[0]))[:]
-		// playersBytes := unsafe.Slice((*byte)(unsafe.Pointer(&mPlayers[0])), len(mPlayers)*int(unsafe.Sizeof(mPlayers[0])))
-		playersBytes := Encode(mPlayers, len(mPlayers))
-		message := append([]byte{byte(numPlayers)}, playersBytes...)
-		server.WriteMessage(-1, message)
+		slog.Info("recording", "path", *record)
+		server.Recorder = recorder
+	}
 
-		// for id, player := range players {
-		// 	// m := ws.Message{Client: id, Data: player}
-		// 	server.WriteMessage(id, (*[unsafe.Sizeof(m)]byte)(unsafe.Pointer(&m))[:])
-		// }
+	server.Mux.Handle("/admin", admin.Handler(server, *adminToken))
+	if *console {
+		go admin.Console(server, os.Stdin, os.Stdout)
+	}
+
+	go func() {
+		slog.Info("listening", "addr", *addr)
+		if err := server.ListenAndServe(*addr); err != nil {
+			slog.Error("listen failed", "addr", *addr, "err", err)
+			os.Exit(1)
+		}
+	}()
+	go server.Poll(game.TickRate, func() {
+		game.Tick(server)
 	})
-	// server.WriteMessage([]byte("Hello"))
-	// for {
-	// 	server.WriteMessage([]byte("Hello"))
-	// }
-}
 
-func messageHandler(server *ws.Server, id int, message []byte) {
-	// fmt.Println(string(message))
-	messageType := message[0]
-	switch messageType {
-	case 0:
-		{
-			d := (*ws.PlayerData)(unsafe.Pointer(&message[1]))
-			// fmt.Printf("Received player data: %v, %v, %v\n", d.Position, d.Rotation.W, d.Rotation.V)
-			server.Lock.Lock()
-			ws.Players[id] = *d
-			server.Lock.Unlock()
-			// m := ws.Message{Client: id, Data: *d}
-			// server.WriteMessage(id, (*[unsafe.Sizeof(m)]byte)(unsafe.Pointer(&m))[:])
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	slog.Info("shutting down")
+	if *worldPath != "" {
+		save(server)
+	}
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			slog.Error("could not finish recording", "path", *record, "err", err)
 		}
 	}
 }
+
+// save writes the world as of the next tick to the world file.
+func save(server *ws.Server) {
+	done := make(chan *persist.World, 1)
+	server.Do(func() {
+		done <- game.Snapshot(server)
+	})
+	var world *persist.World
+	select {
+	case world = <-done:
+	case <-time.After(5 * time.Second):
+		slog.Error("could not save world, the simulation is not ticking")
+		return
+	}
+	if err := persist.Save(*worldPath, world); err != nil {
+		slog.Error("could not save world", "path", *worldPath, "err", err)
+		return
+	}
+	slog.Debug("saved world", "path", *worldPath, "players", len(world.Players))
+}
@@ -0,0 +1,209 @@
+package ws
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// Frame header flags written in front of every message sent through a codec.
+const (
+	frameDeflate = 1 << iota // body is deflate compressed
+	frameBatch               // body is a sequence of uvarint length prefixed messages
+)
+
+// maxFrameSize bounds the size of an inflated frame unless the codec's
+// MaxInflated is set.
+const maxFrameSize = 1 << 24
+
+var ErrFrame = errors.New("ws: malformed frame")
+
+// CodecOptions configures how a codec frames outgoing messages. Incoming
+// frames are always decoded regardless of the options, up to MaxInflated.
+type CodecOptions struct {
+	Compress          bool // deflate messages of at least CompressThreshold bytes
+	CompressThreshold int
+	Batch             bool // hold written messages until Flush
+	MaxInflated       int  // largest incoming frame body once inflated, 0 for 16 MiB
+}
+
+// CodecStats counts bytes passing through one or more codecs.
+type CodecStats struct {
+	RawOut  atomic.Int64 // bytes written by callers
+	WireOut atomic.Int64 // bytes written to the connection
+	RawIn   atomic.Int64 // bytes returned to callers
+	WireIn  atomic.Int64 // bytes read from the connection
+}
+
+// Saved returns how many outgoing bytes compression and batching saved.
+func (s *CodecStats) Saved() int64 {
+	return s.RawOut.Load() - s.WireOut.Load()
+}
+
+// Codec wraps a connection to batch and compress messages. Both ends of a
+// connection must use a codec.
+type Codec struct {
+	conn     Conn
+	opts     CodecOptions
+	stats    *CodecStats
+	mu       sync.Mutex
+	batch    []byte
+	batchRaw int
+	pending  [][]byte
+}
+
+func NewCodec(conn Conn, opts CodecOptions, stats *CodecStats) *Codec {
+	if stats == nil {
+		stats = &CodecStats{}
+	}
+	return &Codec{conn: conn, opts: opts, stats: stats}
+}
+
+func (c *Codec) Stats() *CodecStats {
+	return c.stats
+}
+
+// WriteMessage sends data immediately, or queues it until Flush when
+// batching. The message type is not preserved; frames are always binary.
+func (c *Codec) WriteMessage(messageType int, data []byte) error {
+	if !c.opts.Batch {
+		return c.writeFrame(c.opts.encode(0, data), len(data))
+	}
+	c.mu.Lock()
+	c.batch = binary.AppendUvarint(c.batch, uint64(len(data)))
+	c.batch = append(c.batch, data...)
+	c.batchRaw += len(data)
+	c.mu.Unlock()
+	return nil
+}
+
+// Flush sends all batched messages as a single frame.
+func (c *Codec) Flush() error {
+	c.mu.Lock()
+	batch, raw := c.batch, c.batchRaw
+	c.batch, c.batchRaw = nil, 0
+	c.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	return c.writeFrame(c.opts.encode(frameBatch, batch), raw)
+}
+
+// writeFrame sends an encoded frame, counting raw bytes as the size of the
+// message before encoding.
+func (c *Codec) writeFrame(frame []byte, raw int) error {
+	c.stats.RawOut.Add(int64(raw))
+	c.stats.WireOut.Add(int64(len(frame)))
+	return c.conn.WriteMessage(websocket.BinaryMessage, frame)
+}
+
+func (o CodecOptions) encode(flags byte, data []byte) []byte {
+	if o.Compress && len(data) >= o.CompressThreshold {
+		if compressed, ok := deflate(flags|frameDeflate, data); ok {
+			return compressed
+		}
+	}
+	return append([]byte{flags}, data...)
+}
+
+func (c *Codec) ReadMessage() (int, []byte, error) {
+	for {
+		c.mu.Lock()
+		if len(c.pending) > 0 {
+			m := c.pending[0]
+			c.pending = c.pending[1:]
+			c.mu.Unlock()
+			c.stats.RawIn.Add(int64(len(m)))
+			return websocket.BinaryMessage, m, nil
+		}
+		c.mu.Unlock()
+
+		mt, frame, err := c.conn.ReadMessage()
+		if err != nil {
+			return mt, nil, err
+		}
+		c.stats.WireIn.Add(int64(len(frame)))
+		messages, err := decode(frame, c.opts.maxInflated())
+		if err != nil {
+			return mt, nil, err
+		}
+		c.mu.Lock()
+		c.pending = append(c.pending, messages...)
+		c.mu.Unlock()
+	}
+}
+
+func (o CodecOptions) maxInflated() int {
+	if o.MaxInflated > 0 {
+		return o.MaxInflated
+	}
+	return maxFrameSize
+}
+
+func (c *Codec) Close() error {
+	return c.conn.Close()
+}
+
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// deflate compresses data behind a header byte, reporting false if that
+// would not make it smaller.
+func deflate(header byte, data []byte) ([]byte, bool) {
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)/2+1))
+	buf.WriteByte(header)
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(buf)
+	w.Write(data)
+	w.Close()
+	if buf.Len() >= len(data)+1 {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// decode splits a frame into its messages, refusing frames whose body is
+// over limit bytes once inflated.
+func decode(frame []byte, limit int) ([][]byte, error) {
+	if len(frame) == 0 {
+		return nil, ErrFrame
+	}
+	flags, body := frame[0], frame[1:]
+	if flags&frameDeflate != 0 {
+		r := flate.NewReader(bytes.NewReader(body))
+		inflated, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+		r.Close()
+		if err != nil {
+			return nil, ErrFrame
+		}
+		body = inflated
+	}
+	if len(body) > limit {
+		return nil, ErrFrame
+	}
+	if flags&frameBatch == 0 {
+		return [][]byte{body}, nil
+	}
+	var messages [][]byte
+	for len(body) > 0 {
+		n, size := binary.Uvarint(body)
+		if size <= 0 || n > uint64(len(body)-size) {
+			return nil, ErrFrame
+		}
+		body = body[size:]
+		messages = append(messages, body[:n:n])
+		body = body[n:]
+	}
+	return messages, nil
+}
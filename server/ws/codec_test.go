@@ -0,0 +1,67 @@
+package ws
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte{0, 1, 2, 3})
+	f.Add(CodecOptions{Compress: true}.encode(frameBatch, []byte{3, 'a', 'b', 'c', 0}))
+	f.Add([]byte{frameBatch, 200})
+	f.Add([]byte{frameDeflate, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		messages, err := decode(frame, maxFrameSize)
+		if err != nil {
+			return
+		}
+		total := 0
+		for _, m := range messages {
+			total += len(m)
+		}
+		if total > maxFrameSize {
+			t.Fatalf("decoded %d bytes from a %d byte frame", total, len(frame))
+		}
+	})
+}
+
+// FuzzCodec sends messages split from data through a pair of codecs and
+// checks they arrive unchanged and in order.
+func FuzzCodec(f *testing.F) {
+	f.Add([]byte("hello"), byte(0), false, false)
+	f.Add(bytes.Repeat([]byte("snapshot"), 100), byte('s'), true, false)
+	f.Add(bytes.Repeat([]byte{1, 2, 3, 0}, 200), byte(0), true, true)
+	f.Add([]byte{}, byte(0), false, true)
+	f.Fuzz(func(t *testing.T, data []byte, separator byte, compress, batch bool) {
+		messages := bytes.Split(data, []byte{separator})
+		if len(messages) > loopbackBuffer {
+			messages = messages[:loopbackBuffer]
+		}
+		a, b := Pipe()
+		opts := CodecOptions{Compress: compress, CompressThreshold: 16, Batch: batch}
+		sender, receiver := NewCodec(a, opts, nil), NewCodec(b, CodecOptions{}, nil)
+		for _, m := range messages {
+			if err := sender.WriteMessage(websocket.BinaryMessage, m); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := sender.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		sender.Close()
+		for i, want := range messages {
+			_, got, err := receiver.ReadMessage()
+			if err != nil {
+				t.Fatalf("message %d of %d: %v", i, len(messages), err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("message %d is %x, want %x", i, got, want)
+			}
+		}
+		if _, got, err := receiver.ReadMessage(); err == nil {
+			t.Fatalf("extra message %x", got)
+		}
+	})
+}
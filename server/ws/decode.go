@@ -0,0 +1,184 @@
+package ws
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"unsafe"
+
+	"github.com/EngoEngine/glm"
+)
+
+var (
+	ErrLength  = errors.New("ws: message has the wrong length")
+	ErrInvalid = errors.New("ws: message contains invalid values")
+)
+
+// Types of message sent by clients, stored in their first byte.
+const (
+	MessagePlayerData = iota
+	MessageAck
+	MessageChat
+	MessageHello
+)
+
+// Types of message sent by the server, stored in their first byte.
+const (
+	ServerSnapshot = iota
+	ServerChat
+	ServerTeleport
+)
+
+// WorldBound is the largest absolute coordinate a position may have.
+const WorldBound = 1e6
+
+// quatTolerance is how far a rotation's length may be from one.
+const quatTolerance = 1e-2
+
+const (
+	playerDataSize = int(unsafe.Sizeof(PlayerData{}))
+	messageSize    = int(unsafe.Sizeof(Message{}))
+	snapshotHeader = 9 // message type and tick, followed by the uvarint player count
+)
+
+// Validate checks that the position is finite and within WorldBound and the
+// rotation is a finite unit quaternion.
+func (d *PlayerData) Validate() error {
+	for _, v := range d.Position {
+		if !finite(v) || math.Abs(float64(v)) > WorldBound {
+			return ErrInvalid
+		}
+	}
+	q := [4]float32{d.Rotation.W, d.Rotation.V[0], d.Rotation.V[1], d.Rotation.V[2]}
+	length := 0.0
+	for _, v := range q {
+		if !finite(v) {
+			return ErrInvalid
+		}
+		length += float64(v) * float64(v)
+	}
+	if math.Abs(math.Sqrt(length)-1) > quatTolerance {
+		return ErrInvalid
+	}
+	return nil
+}
+
+func finite(v float32) bool {
+	return !math.IsNaN(float64(v)) && !math.IsInf(float64(v), 0)
+}
+
+// DecodePlayerData decodes and validates a player update.
+func DecodePlayerData(b []byte) (PlayerData, error) {
+	var d PlayerData
+	if len(b) != playerDataSize {
+		return d, ErrLength
+	}
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&d)), playerDataSize), b)
+	return d, d.Validate()
+}
+
+// EncodePlayerData builds a player update message.
+func EncodePlayerData(d PlayerData) []byte {
+	b := []byte{MessagePlayerData}
+	return append(b, unsafe.Slice((*byte)(unsafe.Pointer(&d)), playerDataSize)...)
+}
+
+// EncodeSnapshot encodes the state of every player at tick.
+func EncodeSnapshot(tick uint64, messages []Message) []byte {
+	b := make([]byte, snapshotHeader, snapshotHeader+binary.MaxVarintLen64+len(messages)*messageSize)
+	b[0] = ServerSnapshot
+	binary.LittleEndian.PutUint64(b[1:], tick)
+	b = binary.AppendUvarint(b, uint64(len(messages)))
+	if len(messages) > 0 {
+		b = append(b, unsafe.Slice((*byte)(unsafe.Pointer(&messages[0])), len(messages)*messageSize)...)
+	}
+	return b
+}
+
+// DecodeSnapshot decodes and validates a snapshot of every player, as sent
+// by the server each tick.
+func DecodeSnapshot(b []byte) (uint64, []Message, error) {
+	if len(b) < snapshotHeader || b[0] != ServerSnapshot {
+		return 0, nil, ErrLength
+	}
+	tick := binary.LittleEndian.Uint64(b[1:])
+	count, size := binary.Uvarint(b[snapshotHeader:])
+	if size <= 0 {
+		return 0, nil, ErrLength
+	}
+	b = b[snapshotHeader+size:]
+	if count != uint64(len(b)/messageSize) || len(b)%messageSize != 0 {
+		return 0, nil, ErrLength
+	}
+	n := int(count)
+	messages := make([]Message, n)
+	if n > 0 {
+		copy(unsafe.Slice((*byte)(unsafe.Pointer(&messages[0])), n*messageSize), b)
+	}
+	for i := range messages {
+		if err := messages[i].Data.Validate(); err != nil {
+			return 0, nil, err
+		}
+	}
+	return tick, messages, nil
+}
+
+// EncodeAck builds a message acknowledging the snapshot of tick.
+func EncodeAck(tick uint64) []byte {
+	return binary.LittleEndian.AppendUint64([]byte{MessageAck}, tick)
+}
+
+// DecodeAck decodes the tick acknowledged by a client.
+func DecodeAck(b []byte) (uint64, error) {
+	if len(b) != 8 {
+		return 0, ErrLength
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+// MaxIdentityLength is the longest identity a client may log in with.
+const MaxIdentityLength = 32
+
+// EncodeHello builds the message a client logs in with.
+func EncodeHello(identity string) []byte {
+	return append([]byte{MessageHello}, identity...)
+}
+
+// DecodeHello decodes the identity a client logs in with. Identities are
+// made of ASCII letters, digits, '-', '_' and '.'.
+func DecodeHello(b []byte) (string, error) {
+	if len(b) == 0 || len(b) > MaxIdentityLength {
+		return "", ErrLength
+	}
+	for _, c := range b {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return "", ErrInvalid
+		}
+	}
+	return string(b), nil
+}
+
+// EncodeTeleport builds a message moving a client's player to position.
+func EncodeTeleport(position glm.Vec3) []byte {
+	b := []byte{ServerTeleport}
+	for _, v := range position {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+	return b
+}
+
+// DecodeTeleport decodes and validates a message built by EncodeTeleport.
+func DecodeTeleport(b []byte) (glm.Vec3, error) {
+	var position glm.Vec3
+	if len(b) != 13 || b[0] != ServerTeleport {
+		return position, ErrLength
+	}
+	for i := range position {
+		v := math.Float32frombits(binary.LittleEndian.Uint32(b[1+4*i:]))
+		if !finite(v) || math.Abs(float64(v)) > WorldBound {
+			return position, ErrInvalid
+		}
+		position[i] = v
+	}
+	return position, nil
+}
@@ -0,0 +1,127 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/EngoEngine/glm"
+)
+
+var (
+	identity = glm.Quat{W: 1}
+	players  = []Message{
+		{Client: 0, Data: PlayerData{Position: glm.Vec3{1, 2, 3}, Rotation: identity}},
+		{Client: 7, Data: PlayerData{Position: glm.Vec3{-WorldBound, 0, WorldBound}, Rotation: glm.Quat{W: 0, V: glm.Vec3{0, 0, 1}}}},
+	}
+)
+
+func FuzzDecodePlayerData(f *testing.F) {
+	for _, m := range players {
+		f.Add(EncodePlayerData(m.Data)[1:])
+	}
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		d, err := DecodePlayerData(b)
+		if err != nil {
+			return
+		}
+		again, err := DecodePlayerData(EncodePlayerData(d)[1:])
+		if err != nil {
+			t.Fatalf("re-encoded %v does not decode: %v", d, err)
+		}
+		if again != d {
+			t.Fatalf("round trip changed %v to %v", d, again)
+		}
+	})
+}
+
+func FuzzDecodeSnapshot(f *testing.F) {
+	f.Add(EncodeSnapshot(0, nil))
+	f.Add(EncodeSnapshot(42, players))
+	f.Add([]byte{ServerSnapshot, 255})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		tick, messages, err := DecodeSnapshot(b)
+		if err != nil {
+			return
+		}
+		againTick, again, err := DecodeSnapshot(EncodeSnapshot(tick, messages))
+		if err != nil {
+			t.Fatalf("re-encoded snapshot does not decode: %v", err)
+		}
+		if againTick != tick || len(again) != len(messages) {
+			t.Fatalf("round trip changed tick %d with %d players to %d with %d", tick, len(messages), againTick, len(again))
+		}
+		for i := range messages {
+			if again[i] != messages[i] {
+				t.Fatalf("round trip changed player %d from %v to %v", i, messages[i], again[i])
+			}
+		}
+	})
+}
+
+func FuzzDecodeAck(f *testing.F) {
+	f.Add(EncodeAck(0)[1:])
+	f.Add(EncodeAck(math.MaxUint64)[1:])
+	f.Fuzz(func(t *testing.T, b []byte) {
+		tick, err := DecodeAck(b)
+		if err != nil {
+			return
+		}
+		if again := EncodeAck(tick); !bytes.Equal(again[1:], b) {
+			t.Fatalf("tick %d encodes as %x, decoded from %x", tick, again[1:], b)
+		}
+	})
+}
+
+func FuzzDecodeHello(f *testing.F) {
+	f.Add(EncodeHello("player-1.alt_2")[1:])
+	f.Add([]byte("no spaces"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		identity, err := DecodeHello(b)
+		if err != nil {
+			return
+		}
+		if again, err := DecodeHello(EncodeHello(identity)[1:]); err != nil || again != identity {
+			t.Fatalf("round trip changed %q to %q, %v", identity, again, err)
+		}
+	})
+}
+
+func FuzzDecodeTeleport(f *testing.F) {
+	f.Add(EncodeTeleport(glm.Vec3{1, -2, 3}))
+	f.Add(EncodeTeleport(glm.Vec3{WorldBound, 0, -WorldBound}))
+	f.Add(binary.LittleEndian.AppendUint32([]byte{ServerTeleport}, math.Float32bits(float32(math.NaN()))))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		position, err := DecodeTeleport(b)
+		if err != nil {
+			return
+		}
+		again, err := DecodeTeleport(EncodeTeleport(position))
+		if err != nil || again != position {
+			t.Fatalf("round trip changed %v to %v, %v", position, again, err)
+		}
+	})
+}
+
+func TestSnapshotManyPlayers(t *testing.T) {
+	for _, n := range []int{0, 1, 255, 256, 300, 70000} {
+		messages := make([]Message, n)
+		for i := range messages {
+			messages[i] = Message{Client: i, Data: PlayerData{Position: glm.Vec3{float32(i), 0, 0}, Rotation: identity}}
+		}
+		tick, got, err := DecodeSnapshot(EncodeSnapshot(9, messages))
+		if err != nil {
+			t.Fatalf("%d players: %v", n, err)
+		}
+		if tick != 9 || len(got) != n {
+			t.Fatalf("%d players decoded as %d at tick %d", n, len(got), tick)
+		}
+		for i := range got {
+			if got[i] != messages[i] {
+				t.Fatalf("%d players: player %d decoded as %v", n, i, got[i])
+			}
+		}
+	}
+}
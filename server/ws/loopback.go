@@ -0,0 +1,70 @@
+package ws
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned by a loopback connection once either end is closed.
+var ErrClosed = errors.New("ws: loopback connection closed")
+
+const loopbackBuffer = 256
+
+type loopbackMessage struct {
+	messageType int
+	data        []byte
+}
+
+type loopbackConn struct {
+	in     <-chan loopbackMessage
+	out    chan<- loopbackMessage
+	closed chan struct{}
+	once   *sync.Once
+}
+
+// Pipe returns the two ends of an in-memory connection. Messages written to
+// one end are read from the other in order. Closing either end closes both.
+func Pipe() (Conn, Conn) {
+	a := make(chan loopbackMessage, loopbackBuffer)
+	b := make(chan loopbackMessage, loopbackBuffer)
+	closed := make(chan struct{})
+	once := &sync.Once{}
+	return &loopbackConn{in: a, out: b, closed: closed, once: once},
+		&loopbackConn{in: b, out: a, closed: closed, once: once}
+}
+
+func (c *loopbackConn) ReadMessage() (int, []byte, error) {
+	select {
+	case m := <-c.in:
+		return m.messageType, m.data, nil
+	case <-c.closed:
+		// Deliver messages sent before the close first.
+		select {
+		case m := <-c.in:
+			return m.messageType, m.data, nil
+		default:
+			return -1, nil, ErrClosed
+		}
+	}
+}
+
+func (c *loopbackConn) WriteMessage(messageType int, data []byte) error {
+	// Callers are free to reuse data once the write returns, as with a socket.
+	m := loopbackMessage{messageType, append([]byte(nil), data...)}
+	select {
+	case <-c.closed:
+		return ErrClosed
+	default:
+	}
+	select {
+	case c.out <- m:
+		return nil
+	case <-c.closed:
+		return ErrClosed
+	}
+}
+
+func (c *loopbackConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
@@ -0,0 +1,186 @@
+package ws
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EngoEngine/glm"
+	"github.com/gorilla/websocket"
+)
+
+// readWithin reads the next message from conn, failing the test if none
+// arrives within a second.
+func readWithin(t *testing.T, conn Conn) []byte {
+	t.Helper()
+	type result struct {
+		message []byte
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		_, message, err := conn.ReadMessage()
+		done <- result{message, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatalf("read: %v", r.err)
+		}
+		return r.message
+	case <-time.After(time.Second):
+		t.Fatal("read timed out")
+		return nil
+	}
+}
+
+// isolatePlayers gives the test its own Players, restoring the shared map
+// when it ends.
+func isolatePlayers(t *testing.T) {
+	saved := Players
+	Players = make(map[int]PlayerData)
+	t.Cleanup(func() { Players = saved })
+}
+
+// poll runs server.Poll until the test ends, and waits for it to return.
+func poll(t *testing.T, server *Server, dur time.Duration, f func()) {
+	done := make(chan struct{})
+	go func() {
+		server.Poll(dur, f)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		server.Stop()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("Poll did not return after Stop")
+		}
+	})
+}
+
+func TestLoopbackProtocol(t *testing.T) {
+	isolatePlayers(t)
+	handled := make(chan int, 16)
+	server := NewServer(func(server *Server, id int, message []byte) error {
+		if len(message) == 0 || message[0] != MessagePlayerData {
+			return ErrLength
+		}
+		d, err := DecodePlayerData(message[1:])
+		if err != nil {
+			return err
+		}
+		server.Lock.Lock()
+		Players[id] = d
+		server.Lock.Unlock()
+		handled <- id
+		return nil
+	})
+
+	conn, remote := Pipe()
+	go server.Serve(remote)
+
+	// The server's first message is the client's id, unframed.
+	var id int
+	if _, err := fmt.Sscanf(string(readWithin(t, conn)), "%d", &id); err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	codec := NewCodec(conn, CodecOptions{}, nil)
+
+	want := PlayerData{Position: glm.Vec3{1, 2, 3}, Rotation: glm.Quat{W: 1}}
+	if err := codec.WriteMessage(websocket.BinaryMessage, EncodePlayerData(want)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	poll(t, server, 10*time.Millisecond, func() {
+		server.Lock.Lock()
+		var messages []Message
+		for client, d := range Players {
+			messages = append(messages, Message{Client: client, Data: d})
+		}
+		server.Lock.Unlock()
+		server.WriteMessage(-1, EncodeSnapshot(server.Tick(), messages))
+	})
+
+	select {
+	case got := <-handled:
+		if got != id {
+			t.Fatalf("update handled for client %d, want %d", got, id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("player update was not handled")
+	}
+
+	// Snapshots sent before the update was handled hold the initial state.
+	deadline := time.Now().Add(time.Second)
+	for {
+		tick, messages, err := DecodeSnapshot(readWithin(t, codec))
+		if err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+		if tick == 0 || tick > server.Tick() {
+			t.Fatalf("snapshot of tick %d, server is at %d", tick, server.Tick())
+		}
+		found := false
+		for _, m := range messages {
+			if m.Client == id && m.Data == want {
+				found = true
+			}
+		}
+		if found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no snapshot holds the update, last was %v", messages)
+		}
+	}
+
+	codec.Close()
+	for len(server.Clients()) != 0 {
+		if time.Now().After(deadline.Add(time.Second)) {
+			t.Fatal("closed client was not removed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStop(t *testing.T) {
+	isolatePlayers(t)
+	server := NewServer(func(*Server, int, []byte) error { return nil })
+	var ticks atomic.Int64
+	poll(t, server, time.Millisecond, func() { ticks.Add(1) })
+
+	listening := make(chan error, 1)
+	go func() { listening <- server.ListenAndServe("127.0.0.1:0") }()
+	conn, remote := Pipe()
+	go server.Serve(remote)
+	readWithin(t, conn)
+	for ticks.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	server.Stop()
+	select {
+	case err := <-listening:
+		if err != http.ErrServerClosed {
+			t.Errorf("ListenAndServe returned %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("ListenAndServe did not return after Stop")
+	}
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Error("a client is still connected after Stop")
+	}
+	time.Sleep(10 * time.Millisecond)
+	stopped := ticks.Load()
+	time.Sleep(20 * time.Millisecond)
+	if ticks.Load() != stopped {
+		t.Error("Poll kept ticking after Stop")
+	}
+	if err := server.ListenAndServe("127.0.0.1:0"); err != http.ErrServerClosed {
+		t.Errorf("ListenAndServe after Stop returned %v", err)
+	}
+	server.Stop()
+}
@@ -0,0 +1,105 @@
+package ws
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wgpu_server/metrics"
+)
+
+// Metrics counts server activity exposed on /metrics.
+type Metrics struct {
+	TickDuration *metrics.Histogram // seconds spent handling messages and running each tick
+	MessagesIn   [256]atomic.Int64  // messages received by type
+	MessagesOut  [256]atomic.Int64  // messages sent by type, once per recipient
+	DroppedSends atomic.Int64       // messages that failed to send
+	RateLimited  atomic.Int64       // messages dropped by the rate limit
+
+	lastTick   atomic.Int64 // unix nanoseconds at the end of the last tick
+	rateLock   sync.Mutex
+	lastSample time.Time
+	lastIn     int64
+	lastOut    int64
+	inRate     float64
+	outRate    float64
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		TickDuration: metrics.NewHistogram(metrics.ExponentialBuckets(0.0001, 2, 12)...),
+	}
+}
+
+// tickDone records a finished tick and, once a second, the byte rates.
+func (server *Server) tickDone(start time.Time) {
+	m := server.Metrics
+	now := time.Now()
+	m.TickDuration.Observe(now.Sub(start).Seconds())
+	m.lastTick.Store(now.UnixNano())
+
+	m.rateLock.Lock()
+	defer m.rateLock.Unlock()
+	elapsed := now.Sub(m.lastSample)
+	if elapsed < time.Second {
+		return
+	}
+	in, out := server.Stats.WireIn.Load(), server.Stats.WireOut.Load()
+	if !m.lastSample.IsZero() {
+		m.inRate = float64(in-m.lastIn) / elapsed.Seconds()
+		m.outRate = float64(out-m.lastOut) / elapsed.Seconds()
+	}
+	m.lastSample, m.lastIn, m.lastOut = now, in, out
+}
+
+// healthz reports whether the simulation has ticked recently.
+func (server *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	last := time.Unix(0, server.Metrics.lastTick.Load())
+	if time.Since(last) > 5*server.TickRate()+time.Second {
+		http.Error(w, "simulation is not ticking", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+func (server *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	m := server.Metrics
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	out := metrics.NewWriter(w)
+
+	out.Gauge("ws_connected_clients", "Number of connected clients.", float64(len(server.Clients())))
+	out.Counter("ws_ticks_total", "Simulation ticks run.", float64(server.Tick()))
+	out.Histogram("ws_tick_duration_seconds", "Time spent handling messages and running each tick.", m.TickDuration)
+
+	out.Counter("ws_bytes_in_total", "Bytes received from clients.", float64(server.Stats.WireIn.Load()))
+	out.Counter("ws_bytes_out_total", "Bytes sent to clients.", float64(server.Stats.WireOut.Load()))
+	m.rateLock.Lock()
+	inRate, outRate := m.inRate, m.outRate
+	m.rateLock.Unlock()
+	out.Gauge("ws_bytes_in_per_second", "Bytes received from clients over the last second.", inRate)
+	out.Gauge("ws_bytes_out_per_second", "Bytes sent to clients over the last second.", outRate)
+
+	out.Header("ws_messages_in_total", "counter", "Messages received from clients by type.")
+	for t := range m.MessagesIn {
+		if n := m.MessagesIn[t].Load(); n > 0 {
+			out.Sample("ws_messages_in_total", float64(n), "type", strconv.Itoa(t))
+		}
+	}
+	out.Header("ws_messages_out_total", "counter", "Messages sent to clients by type.")
+	for t := range m.MessagesOut {
+		if n := m.MessagesOut[t].Load(); n > 0 {
+			out.Sample("ws_messages_out_total", float64(n), "type", strconv.Itoa(t))
+		}
+	}
+	out.Counter("ws_dropped_sends_total", "Messages that failed to send.", float64(m.DroppedSends.Load()))
+	out.Counter("ws_rate_limited_total", "Messages dropped by the rate limit.", float64(m.RateLimited.Load()))
+
+	ids := server.Clients()
+	sort.Ints(ids)
+	out.Header("ws_client_rtt_seconds", "gauge", "Smoothed round trip time of each client.")
+	for _, id := range ids {
+		out.Sample("ws_client_rtt_seconds", server.RTT(id).Seconds(), "client", strconv.Itoa(id))
+	}
+}
@@ -0,0 +1,88 @@
+package ws
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetricsOutput(t *testing.T) {
+	server := NewServer(nil)
+	server.SetTick(42)
+	m := server.Metrics
+	m.TickDuration.Observe(0.00015)
+	m.TickDuration.Observe(0.25)
+	m.MessagesIn[MessagePlayerData].Add(3)
+	m.MessagesIn[MessageChat].Add(1)
+	m.MessagesOut[ServerSnapshot].Add(7)
+	m.DroppedSends.Add(2)
+	m.RateLimited.Add(5)
+	server.Stats.WireIn.Store(100)
+	server.Stats.WireOut.Store(2000)
+	for id, rtt := range map[int]time.Duration{4: 25 * time.Millisecond, 1: 80 * time.Millisecond} {
+		server.clients[id] = nil
+		server.rtt[id] = rtt
+	}
+
+	recorder := httptest.NewRecorder()
+	server.Mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := recorder.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4" {
+		t.Errorf("content type %q", ct)
+	}
+	want := `# HELP ws_connected_clients Number of connected clients.
+# TYPE ws_connected_clients gauge
+ws_connected_clients 2
+# HELP ws_ticks_total Simulation ticks run.
+# TYPE ws_ticks_total counter
+ws_ticks_total 42
+# HELP ws_tick_duration_seconds Time spent handling messages and running each tick.
+# TYPE ws_tick_duration_seconds histogram
+ws_tick_duration_seconds_bucket{le="0.0001"} 0
+ws_tick_duration_seconds_bucket{le="0.0002"} 1
+ws_tick_duration_seconds_bucket{le="0.0004"} 1
+ws_tick_duration_seconds_bucket{le="0.0008"} 1
+ws_tick_duration_seconds_bucket{le="0.0016"} 1
+ws_tick_duration_seconds_bucket{le="0.0032"} 1
+ws_tick_duration_seconds_bucket{le="0.0064"} 1
+ws_tick_duration_seconds_bucket{le="0.0128"} 1
+ws_tick_duration_seconds_bucket{le="0.0256"} 1
+ws_tick_duration_seconds_bucket{le="0.0512"} 1
+ws_tick_duration_seconds_bucket{le="0.1024"} 1
+ws_tick_duration_seconds_bucket{le="0.2048"} 1
+ws_tick_duration_seconds_bucket{le="+Inf"} 2
+ws_tick_duration_seconds_sum 0.25015
+ws_tick_duration_seconds_count 2
+# HELP ws_bytes_in_total Bytes received from clients.
+# TYPE ws_bytes_in_total counter
+ws_bytes_in_total 100
+# HELP ws_bytes_out_total Bytes sent to clients.
+# TYPE ws_bytes_out_total counter
+ws_bytes_out_total 2000
+# HELP ws_bytes_in_per_second Bytes received from clients over the last second.
+# TYPE ws_bytes_in_per_second gauge
+ws_bytes_in_per_second 0
+# HELP ws_bytes_out_per_second Bytes sent to clients over the last second.
+# TYPE ws_bytes_out_per_second gauge
+ws_bytes_out_per_second 0
+# HELP ws_messages_in_total Messages received from clients by type.
+# TYPE ws_messages_in_total counter
+ws_messages_in_total{type="0"} 3
+ws_messages_in_total{type="2"} 1
+# HELP ws_messages_out_total Messages sent to clients by type.
+# TYPE ws_messages_out_total counter
+ws_messages_out_total{type="0"} 7
+# HELP ws_dropped_sends_total Messages that failed to send.
+# TYPE ws_dropped_sends_total counter
+ws_dropped_sends_total 2
+# HELP ws_rate_limited_total Messages dropped by the rate limit.
+# TYPE ws_rate_limited_total counter
+ws_rate_limited_total 5
+# HELP ws_client_rtt_seconds Smoothed round trip time of each client.
+# TYPE ws_client_rtt_seconds gauge
+ws_client_rtt_seconds{client="1"} 0.08
+ws_client_rtt_seconds{client="4"} 0.025
+`
+	if got := recorder.Body.String(); got != want {
+		t.Errorf("/metrics wrote\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,432 @@
+package ws
+
+import (
+	"container/heap"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Conditions describes the network impairments Simulate applies to a
+// connection. The zero value passes traffic through untouched.
+type Conditions struct {
+	Latency   time.Duration // one-way delay added to every message
+	Jitter    time.Duration // random extra delay in [0, Jitter)
+	Loss      float64       // probability a message is dropped
+	Duplicate float64       // probability a message is delivered twice
+	Reorder   float64       // probability a message is held back behind later ones
+	Bandwidth int           // bytes per second, 0 for unlimited
+}
+
+func (c Conditions) Enabled() bool {
+	return c != Conditions{}
+}
+
+// Validate reports the first condition out of range: delays and bandwidth
+// must not be negative, and probabilities must be between 0 and 1.
+func (c Conditions) Validate() error {
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{{"latency", c.Latency}, {"jitter", c.Jitter}} {
+		if err := checkDuration(d.value); err != nil {
+			return fmt.Errorf("ws: %s %v %w", d.name, d.value, err)
+		}
+	}
+	for _, p := range []struct {
+		name  string
+		value float64
+	}{{"loss", c.Loss}, {"duplicate", c.Duplicate}, {"reorder", c.Reorder}} {
+		if err := checkProbability(p.value); err != nil {
+			return fmt.Errorf("ws: %s %v %w", p.name, p.value, err)
+		}
+	}
+	if err := checkBandwidth(c.Bandwidth); err != nil {
+		return fmt.Errorf("ws: bandwidth %d %w", c.Bandwidth, err)
+	}
+	return nil
+}
+
+var (
+	errNegative    = errors.New("must not be negative")
+	errProbability = errors.New("must be between 0 and 1")
+)
+
+func checkDuration(d time.Duration) error {
+	if d < 0 {
+		return errNegative
+	}
+	return nil
+}
+
+func checkProbability(p float64) error {
+	if !(p >= 0 && p <= 1) {
+		return errProbability
+	}
+	return nil
+}
+
+func checkBandwidth(b int) error {
+	if b < 0 {
+		return errNegative
+	}
+	return nil
+}
+
+// RegisterFlags adds -net-* flags for each condition to fs, which refuse
+// values out of range. Defaults are read from the NET_LATENCY, NET_JITTER,
+// NET_LOSS, NET_DUPLICATE, NET_REORDER and NET_BANDWIDTH environment
+// variables; values that do not parse or are out of range are ignored.
+func (c *Conditions) RegisterFlags(fs *flag.FlagSet) {
+	c.Latency = envDuration("NET_LATENCY")
+	c.Jitter = envDuration("NET_JITTER")
+	c.Loss = envFloat("NET_LOSS")
+	c.Duplicate = envFloat("NET_DUPLICATE")
+	c.Reorder = envFloat("NET_REORDER")
+	c.Bandwidth = envInt("NET_BANDWIDTH")
+	fs.Var(durationFlag{&c.Latency}, "net-latency", "simulated one-way latency")
+	fs.Var(durationFlag{&c.Jitter}, "net-jitter", "simulated random extra latency")
+	fs.Var(probabilityFlag{&c.Loss}, "net-loss", "simulated message loss probability")
+	fs.Var(probabilityFlag{&c.Duplicate}, "net-duplicate", "simulated message duplication probability")
+	fs.Var(probabilityFlag{&c.Reorder}, "net-reorder", "simulated message reordering probability")
+	fs.Var(bandwidthFlag{&c.Bandwidth}, "net-bandwidth", "simulated bandwidth cap in bytes per second")
+}
+
+func envDuration(name string) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || checkDuration(d) != nil {
+		return 0
+	}
+	return d
+}
+
+func envFloat(name string) float64 {
+	f, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil || checkProbability(f) != nil {
+		return 0
+	}
+	return f
+}
+
+func envInt(name string) int {
+	i, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || checkBandwidth(i) != nil {
+		return 0
+	}
+	return i
+}
+
+// durationFlag, probabilityFlag and bandwidthFlag are flag values that
+// refuse values out of range.
+type durationFlag struct{ d *time.Duration }
+
+func (f durationFlag) String() string {
+	if f.d == nil {
+		return "0s"
+	}
+	return f.d.String()
+}
+
+func (f durationFlag) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	if err := checkDuration(d); err != nil {
+		return err
+	}
+	*f.d = d
+	return nil
+}
+
+type probabilityFlag struct{ p *float64 }
+
+func (f probabilityFlag) String() string {
+	if f.p == nil {
+		return "0"
+	}
+	return strconv.FormatFloat(*f.p, 'g', -1, 64)
+}
+
+func (f probabilityFlag) Set(s string) error {
+	p, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	if err := checkProbability(p); err != nil {
+		return err
+	}
+	*f.p = p
+	return nil
+}
+
+type bandwidthFlag struct{ b *int }
+
+func (f bandwidthFlag) String() string {
+	if f.b == nil {
+		return "0"
+	}
+	return strconv.Itoa(*f.b)
+}
+
+func (f bandwidthFlag) Set(s string) error {
+	b, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	if err := checkBandwidth(b); err != nil {
+		return err
+	}
+	*f.b = b
+	return nil
+}
+
+// Simulate wraps conn so that messages in both directions are subject to
+// cond. Wrap a connection after its handshake, since handshake messages may
+// otherwise be dropped. It panics if cond is not valid.
+func Simulate(conn Conn, cond Conditions) Conn {
+	return simulate(conn, cond, rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())), time.Now)
+}
+
+// simulate is Simulate with the source of random numbers and the clock
+// given, for tests.
+func simulate(conn Conn, cond Conditions, random *rand.Rand, now func() time.Time) *simConn {
+	if err := cond.Validate(); err != nil {
+		panic(err)
+	}
+	c := &simConn{
+		conn:     conn,
+		cond:     cond,
+		random:   random,
+		incoming: make(chan simItem, loopbackBuffer),
+		closed:   make(chan struct{}),
+	}
+	c.send = newSimQueue(c.closed, now, func(m simItem) {
+		if err := c.conn.WriteMessage(m.messageType, m.data); err != nil {
+			c.mu.Lock()
+			c.writeErr = err
+			c.mu.Unlock()
+		}
+	})
+	c.recv = newSimQueue(c.closed, now, func(m simItem) {
+		select {
+		case c.incoming <- m:
+		case <-c.closed:
+		}
+	})
+	go c.pump()
+	return c
+}
+
+type simItem struct {
+	messageType int
+	data        []byte
+	err         error
+}
+
+type simConn struct {
+	conn     Conn
+	cond     Conditions
+	randomMu sync.Mutex
+	random   *rand.Rand
+	send     *simQueue
+	recv     *simQueue
+	incoming chan simItem
+	closed   chan struct{}
+	once     sync.Once
+	mu       sync.Mutex
+	writeErr error
+	readErr  error
+}
+
+// pump reads from the underlying connection and schedules each message for
+// delayed delivery to ReadMessage.
+func (c *simConn) pump() {
+	for {
+		mt, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.recv.push(simItem{err: err}, c.cond.Latency, false, 0)
+			return
+		}
+		c.schedule(c.recv, simItem{messageType: mt, data: data})
+	}
+}
+
+func (c *simConn) schedule(q *simQueue, m simItem) {
+	// Messages are scheduled from both the reading and the writing
+	// goroutine, which share the source of random numbers.
+	c.randomMu.Lock()
+	defer c.randomMu.Unlock()
+	if c.cond.Loss > 0 && c.random.Float64() < c.cond.Loss {
+		return
+	}
+	copies := 1
+	if c.cond.Duplicate > 0 && c.random.Float64() < c.cond.Duplicate {
+		copies = 2
+	}
+	for range copies {
+		delay := c.cond.Latency
+		if c.cond.Jitter > 0 {
+			delay += time.Duration(c.random.Int64N(int64(c.cond.Jitter)))
+		}
+		reorder := c.cond.Reorder > 0 && c.random.Float64() < c.cond.Reorder
+		if reorder {
+			delay += c.cond.Latency + c.cond.Jitter + time.Millisecond
+		}
+		q.push(m, delay, reorder, c.cond.Bandwidth)
+	}
+}
+
+func (c *simConn) ReadMessage() (int, []byte, error) {
+	c.mu.Lock()
+	err := c.readErr
+	c.mu.Unlock()
+	if err != nil {
+		return -1, nil, err
+	}
+	select {
+	case m := <-c.incoming:
+		if m.err != nil {
+			c.mu.Lock()
+			c.readErr = m.err
+			c.mu.Unlock()
+			return -1, nil, m.err
+		}
+		return m.messageType, m.data, nil
+	case <-c.closed:
+		return -1, nil, ErrClosed
+	}
+}
+
+func (c *simConn) WriteMessage(messageType int, data []byte) error {
+	select {
+	case <-c.closed:
+		return ErrClosed
+	default:
+	}
+	c.mu.Lock()
+	err := c.writeErr
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	c.schedule(c.send, simItem{messageType: messageType, data: append([]byte(nil), data...)})
+	return nil
+}
+
+func (c *simConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.conn.Close()
+}
+
+// simQueue delivers items at their scheduled time from a single goroutine.
+type simQueue struct {
+	mu      sync.Mutex
+	items   simHeap
+	seq     uint64
+	last    time.Time // delivery time of the latest in-order item
+	free    time.Time // when the bandwidth-limited link is next idle
+	wake    chan struct{}
+	closed  chan struct{}
+	now     func() time.Time
+	deliver func(simItem)
+}
+
+func newSimQueue(closed chan struct{}, now func() time.Time, deliver func(simItem)) *simQueue {
+	q := &simQueue{
+		wake:    make(chan struct{}, 1),
+		closed:  closed,
+		now:     now,
+		deliver: deliver,
+	}
+	go q.run()
+	return q
+}
+
+func (q *simQueue) push(m simItem, delay time.Duration, reorder bool, bandwidth int) {
+	q.mu.Lock()
+	now := q.now()
+	at := now.Add(delay)
+	if bandwidth > 0 {
+		start := q.free
+		if start.Before(now) {
+			start = now
+		}
+		q.free = start.Add(time.Duration(len(m.data)) * time.Second / time.Duration(bandwidth))
+		at = at.Add(q.free.Sub(now))
+	}
+	if !reorder {
+		if at.Before(q.last) {
+			at = q.last
+		}
+		q.last = at
+	}
+	heap.Push(&q.items, simEntry{at: at, seq: q.seq, item: m})
+	q.seq++
+	q.mu.Unlock()
+	q.poke()
+}
+
+// poke makes run look at the queue again.
+func (q *simQueue) poke() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *simQueue) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		q.mu.Lock()
+		now := q.now()
+		if len(q.items) > 0 && !now.Before(q.items[0].at) {
+			e := heap.Pop(&q.items).(simEntry)
+			q.mu.Unlock()
+			q.deliver(e.item)
+			continue
+		}
+		wait := time.Hour
+		if len(q.items) > 0 {
+			wait = q.items[0].at.Sub(now)
+		}
+		q.mu.Unlock()
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-q.wake:
+		case <-q.closed:
+			return
+		}
+	}
+}
+
+type simEntry struct {
+	at   time.Time
+	seq  uint64
+	item simItem
+}
+
+type simHeap []simEntry
+
+func (h simHeap) Len() int { return len(h) }
+func (h simHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at.Before(h[j].at)
+}
+func (h simHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *simHeap) Push(x any)   { *h = append(*h, x.(simEntry)) }
+func (h *simHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,265 @@
+package ws
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// clock is a fake clock for simulated connections. Moving it on makes the
+// connection's queues deliver what is due.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) advance(conn *simConn, d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+	conn.send.poke()
+	conn.recv.poke()
+}
+
+// simPipe returns a simulated end of a Pipe on a fake clock, and the other,
+// plain end.
+func simPipe(t *testing.T, cond Conditions) (*simConn, Conn, *clock) {
+	t.Helper()
+	a, b := Pipe()
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	sim := simulate(a, cond, rand.New(rand.NewPCG(1, 2)), c.Now)
+	t.Cleanup(func() { sim.Close() })
+	return sim, b, c
+}
+
+// receive reads messages from conn onto a channel until it is closed.
+func receive(conn Conn) <-chan []byte {
+	messages := make(chan []byte, loopbackBuffer)
+	go func() {
+		defer close(messages)
+		for {
+			_, m, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			messages <- m
+		}
+	}()
+	return messages
+}
+
+// expect waits for n messages and returns them.
+func expect(t *testing.T, messages <-chan []byte, n int) []string {
+	t.Helper()
+	var got []string
+	for range n {
+		select {
+		case m := <-messages:
+			got = append(got, string(m))
+		case <-time.After(time.Second):
+			t.Fatalf("got %d messages %v, want %d", len(got), got, n)
+		}
+	}
+	return got
+}
+
+// expectNone checks that nothing more arrives for a while.
+func expectNone(t *testing.T, messages <-chan []byte) {
+	t.Helper()
+	select {
+	case m := <-messages:
+		t.Fatalf("got %q, want nothing yet", m)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func send(t *testing.T, conn Conn, n int) []string {
+	t.Helper()
+	var sent []string
+	for i := range n {
+		m := fmt.Sprint(i)
+		if err := conn.WriteMessage(websocket.BinaryMessage, []byte(m)); err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, m)
+	}
+	return sent
+}
+
+func TestSimulateInOrder(t *testing.T) {
+	sim, remote, clock := simPipe(t, Conditions{Latency: 50 * time.Millisecond, Jitter: 30 * time.Millisecond})
+	messages := receive(remote)
+	sent := send(t, sim, 100)
+	clock.advance(sim, 49*time.Millisecond)
+	expectNone(t, messages)
+	clock.advance(sim, 31*time.Millisecond)
+	// Jitter delays messages by different amounts, but without Reorder
+	// they still arrive in order.
+	if got := expect(t, messages, 100); !slices.Equal(got, sent) {
+		t.Errorf("got %v, want %v", got, sent)
+	}
+
+	// And the same reading.
+	incoming := receive(sim)
+	sent = send(t, remote, 10)
+	expectNone(t, incoming)
+	clock.advance(sim, 80*time.Millisecond)
+	if got := expect(t, incoming, 10); !slices.Equal(got, sent) {
+		t.Errorf("read %v, want %v", got, sent)
+	}
+}
+
+func TestSimulateLoss(t *testing.T) {
+	sim, remote, clock := simPipe(t, Conditions{Loss: 1})
+	messages := receive(remote)
+	send(t, sim, 50)
+	clock.advance(sim, time.Second)
+	expectNone(t, messages)
+
+	sim, remote, clock = simPipe(t, Conditions{Loss: 0, Latency: time.Millisecond})
+	messages = receive(remote)
+	sent := send(t, sim, 50)
+	clock.advance(sim, time.Millisecond)
+	if got := expect(t, messages, 50); !slices.Equal(got, sent) {
+		t.Errorf("got %v, want %v", got, sent)
+	}
+
+	// Half the messages are lost, give or take.
+	sim, remote, clock = simPipe(t, Conditions{Loss: 0.5})
+	messages = receive(remote)
+	send(t, sim, 200)
+	clock.advance(sim, time.Millisecond)
+	n := 0
+	for drained := false; !drained; {
+		select {
+		case <-messages:
+			n++
+		case <-time.After(50 * time.Millisecond):
+			drained = true
+		}
+	}
+	if n < 70 || n > 130 {
+		t.Errorf("%d of 200 messages arrived with loss 0.5", n)
+	}
+}
+
+func TestSimulateDuplicate(t *testing.T) {
+	sim, remote, clock := simPipe(t, Conditions{Duplicate: 1, Latency: time.Millisecond})
+	messages := receive(remote)
+	sent := send(t, sim, 20)
+	clock.advance(sim, time.Millisecond)
+	var want []string
+	for _, m := range sent {
+		want = append(want, m, m)
+	}
+	if got := expect(t, messages, 40); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	expectNone(t, messages)
+}
+
+func TestSimulateReorder(t *testing.T) {
+	sim, remote, clock := simPipe(t, Conditions{Latency: 10 * time.Millisecond, Reorder: 0.3})
+	messages := receive(remote)
+	sent := send(t, sim, 100)
+	clock.advance(sim, time.Second)
+	got := expect(t, messages, 100)
+	if slices.Equal(got, sent) {
+		t.Error("no message was reordered")
+	}
+	slices.Sort(got)
+	slices.Sort(sent)
+	if !slices.Equal(got, sent) {
+		t.Errorf("reordering changed the messages to %v", got)
+	}
+}
+
+func TestSimulateBandwidth(t *testing.T) {
+	// 100 byte messages over 1000 bytes a second take 100ms each.
+	sim, remote, clock := simPipe(t, Conditions{Latency: 10 * time.Millisecond, Bandwidth: 1000})
+	messages := receive(remote)
+	for range 3 {
+		if err := sim.WriteMessage(websocket.BinaryMessage, bytes.Repeat([]byte{'x'}, 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// They arrive 110, 210 and 310ms after they were sent.
+	clock.advance(sim, 10*time.Millisecond)
+	for range 3 {
+		clock.advance(sim, 99*time.Millisecond)
+		expectNone(t, messages)
+		clock.advance(sim, time.Millisecond)
+		expect(t, messages, 1)
+	}
+	expectNone(t, messages)
+}
+
+func TestConditionsValidate(t *testing.T) {
+	for _, c := range []Conditions{
+		{Latency: -time.Millisecond},
+		{Jitter: -1},
+		{Loss: -0.1},
+		{Loss: 1.5},
+		{Duplicate: 2},
+		{Reorder: -1},
+		{Bandwidth: -1},
+	} {
+		if c.Validate() == nil {
+			t.Errorf("%+v is valid", c)
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Simulate accepted %+v", c)
+				}
+			}()
+			a, _ := Pipe()
+			Simulate(a, c)
+		}()
+	}
+	if err := (Conditions{Latency: time.Second, Loss: 1, Duplicate: 0, Reorder: 0.5, Bandwidth: 10}).Validate(); err != nil {
+		t.Errorf("valid conditions refused: %v", err)
+	}
+}
+
+func TestConditionsFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"-net-loss", "1.5"},
+		{"-net-duplicate", "-0.5"},
+		{"-net-reorder", "NaN"},
+		{"-net-latency", "-10ms"},
+		{"-net-jitter", "-1s"},
+		{"-net-bandwidth", "-100"},
+	} {
+		var c Conditions
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(new(bytes.Buffer))
+		c.RegisterFlags(fs)
+		if err := fs.Parse(args); err == nil {
+			t.Errorf("%v parsed to %+v", args, c)
+		}
+	}
+
+	var c Conditions
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c.RegisterFlags(fs)
+	if err := fs.Parse([]string{"-net-loss", "0.25", "-net-latency", "40ms", "-net-bandwidth", "5000"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Conditions{Loss: 0.25, Latency: 40 * time.Millisecond, Bandwidth: 5000}); c != want {
+		t.Errorf("parsed %+v, want %+v", c, want)
+	}
+}
@@ -0,0 +1,54 @@
+package ws
+
+import "time"
+
+// RateLimit bounds how many messages per second a client may send. Messages
+// over the limit are dropped, and a client dropping more than Disconnect
+// messages within one second is disconnected. Up to Burst messages may
+// arrive at once; a Burst under one is taken as one, so that a low
+// PerSecond still lets messages through. A zero PerSecond disables limiting
+// and a zero Disconnect never disconnects.
+type RateLimit struct {
+	PerSecond  float64
+	Burst      float64
+	Disconnect int
+}
+
+// Limiter is a token bucket tracking one client against a RateLimit.
+type Limiter struct {
+	limit   RateLimit
+	tokens  float64
+	last    time.Time
+	dropped int
+	window  time.Time
+}
+
+func NewLimiter(limit RateLimit) *Limiter {
+	limit.Burst = max(limit.Burst, 1)
+	now := time.Now()
+	return &Limiter{limit: limit, tokens: limit.Burst, last: now, window: now}
+}
+
+// Allow reports whether a message arriving now is within the limit, and
+// whether the client has exceeded the disconnect threshold.
+func (l *Limiter) Allow(now time.Time) (ok, disconnect bool) {
+	if l.limit.PerSecond <= 0 {
+		return true, false
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.limit.PerSecond
+	if l.tokens > l.limit.Burst {
+		l.tokens = l.limit.Burst
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, false
+	}
+
+	if now.Sub(l.window) >= time.Second {
+		l.window = now
+		l.dropped = 0
+	}
+	l.dropped++
+	return false, l.limit.Disconnect > 0 && l.dropped > l.limit.Disconnect
+}
@@ -0,0 +1,97 @@
+package ws
+
+import (
+	"testing"
+	"time"
+)
+
+// allowed counts the messages l allows out of n arriving at now.
+func allowed(l *Limiter, now time.Time, n int) int {
+	count := 0
+	for range n {
+		if ok, _ := l.Allow(now); ok {
+			count++
+		}
+	}
+	return count
+}
+
+func TestLimiterBurst(t *testing.T) {
+	l := NewLimiter(RateLimit{PerSecond: 10, Burst: 5})
+	now := l.last
+	if n := allowed(l, now, 20); n != 5 {
+		t.Errorf("allowed %d of a burst of 20, want 5", n)
+	}
+	// Tokens refill at PerSecond, up to Burst.
+	if n := allowed(l, now.Add(300*time.Millisecond), 20); n != 3 {
+		t.Errorf("allowed %d after 300ms, want 3", n)
+	}
+	if n := allowed(l, now.Add(time.Hour), 20); n != 5 {
+		t.Errorf("allowed %d after an hour, want the burst of 5", n)
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	l := NewLimiter(RateLimit{PerSecond: 4, Burst: 1})
+	now := l.last
+	total := 0
+	for i := range 100 {
+		total += allowed(l, now.Add(time.Duration(i)*50*time.Millisecond), 1)
+	}
+	// A message every 50ms for five seconds, at four a second.
+	if total < 20 || total > 21 {
+		t.Errorf("allowed %d messages in five seconds at 4 a second", total)
+	}
+}
+
+func TestLimiterBurstAtLeastOne(t *testing.T) {
+	for _, burst := range []float64{0, 0.5, -3} {
+		l := NewLimiter(RateLimit{PerSecond: 0.5, Burst: burst})
+		now := l.last
+		if n := allowed(l, now, 3); n != 1 {
+			t.Errorf("burst %v: allowed %d at once, want 1", burst, n)
+		}
+		if n := allowed(l, now.Add(2*time.Second), 3); n != 1 {
+			t.Errorf("burst %v: allowed %d two seconds later, want 1", burst, n)
+		}
+	}
+}
+
+func TestLimiterDisconnect(t *testing.T) {
+	l := NewLimiter(RateLimit{PerSecond: 1, Burst: 1, Disconnect: 3})
+	now := l.last
+	l.Allow(now)
+	for i := range 3 {
+		if ok, disconnect := l.Allow(now); ok || disconnect {
+			t.Fatalf("drop %d: ok %v, disconnect %v, want dropped without disconnecting", i+1, ok, disconnect)
+		}
+	}
+	if _, disconnect := l.Allow(now); !disconnect {
+		t.Error("the fourth drop within a second did not disconnect")
+	}
+
+	// Drops spread over more than a second are counted afresh.
+	l = NewLimiter(RateLimit{PerSecond: 0.01, Burst: 1, Disconnect: 3})
+	now = l.last
+	l.Allow(now)
+	for i := range 12 {
+		if _, disconnect := l.Allow(now.Add(time.Duration(i) * 400 * time.Millisecond)); disconnect {
+			t.Fatalf("drop %d disconnected, with at most three a second", i+1)
+		}
+	}
+
+	// Without a Disconnect threshold, clients are never disconnected.
+	l = NewLimiter(RateLimit{PerSecond: 1, Burst: 1})
+	for range 1000 {
+		if _, disconnect := l.Allow(l.last); disconnect {
+			t.Fatal("disconnected with no threshold")
+		}
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	l := NewLimiter(RateLimit{})
+	if n := allowed(l, time.Now(), 1000); n != 1000 {
+		t.Errorf("allowed %d of 1000 without a limit", n)
+	}
+}
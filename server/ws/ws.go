@@ -2,69 +2,402 @@ package ws
 
 import (
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
+	"wgpu_server/logging"
 
 	"github.com/EngoEngine/glm"
 	"github.com/gorilla/websocket"
 )
 
+// MaxClientFrame bounds the frames read from clients, both as read from the
+// socket and once inflated.
+const MaxClientFrame = 64 << 10
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true // Accepting all requests
 	},
 }
 
+// Conn is the subset of *websocket.Conn the server and client use, so a
+// connection can be backed by a real socket or an in-process Pipe.
+type Conn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+// Handler handles one message from client id. Handlers run on the Poll
+// goroutine at the start of a tick, in the order messages arrived. Returned
+// errors count towards the client's MaxErrors.
+type Handler func(server *Server, id int, message []byte) error
+
 type Server struct {
-	clients       map[int]*websocket.Conn
-	handleMessage func(server *Server, id int, message []byte) // New message handler
+	clients       map[int]*Codec
+	handleMessage Handler // New message handler
 	idGen         int
 	Lock          sync.Mutex
+	Mux           *http.ServeMux
+	Conditions    Conditions   // simulated network conditions for new connections
+	Codec         CodecOptions // framing of messages sent to clients
+	Stats         CodecStats   // bytes sent and received over all connections
+	RateLimit     RateLimit    // inbound message limit applied to each client
+	MaxErrors     int          // disconnect clients after this many invalid messages, 0 for never
+	OnDisconnect  func(id int) // called on the Poll goroutine just before a client is removed
+	Metrics       *Metrics
+	Recorder      Recorder // records traffic for replays, nil to disable
+
+	inboxLock sync.Mutex
+	inbox     []inbound
+	errors    map[int]int
+	addrs     map[int]string
+	banned    map[string]bool
+	listeners []*http.Server
+	stop      chan struct{}
+	stopOnce  sync.Once
+
+	tick      atomic.Uint64
+	tickRate  atomic.Int64
+	tickTimes [tickHistory]time.Time
+	rtt       map[int]time.Duration
+	arrived   time.Time // when the message being handled was received
+}
+
+// Recorder records the messages a server handles and sends.
+type Recorder interface {
+	// RecordIn is called on the Poll goroutine before message from client
+	// id is handled.
+	RecordIn(tick uint64, id int, message []byte)
+	// RecordOut is called once per WriteMessage, with client -1 for
+	// broadcasts.
+	RecordOut(tick uint64, client int, message []byte)
+}
+
+// tickHistory is how many past tick start times are kept for RTT estimates.
+const tickHistory = 256
+
+// MinTickRate is the shortest time between ticks SetTickRate accepts.
+const MinTickRate = time.Millisecond
+
+// inbound is a message, a disconnect or a task waiting for the next tick.
+type inbound struct {
+	id           int
+	message      []byte
+	arrived      time.Time
+	disconnected bool
+	task         func()
 }
 
-func StartServer(handleMessage func(server *Server, id int, message []byte)) *Server {
-	server := Server{
-		make(map[int]*websocket.Conn),
-		handleMessage,
-		0,
-		sync.Mutex{},
+// NewServer creates a server without listening on any address. Connections
+// can be attached with Serve, or over HTTP with ListenAndServe.
+func NewServer(handleMessage Handler) *Server {
+	server := &Server{
+		clients:       make(map[int]*Codec),
+		handleMessage: handleMessage,
+		Mux:           http.NewServeMux(),
+		Codec:         CodecOptions{CompressThreshold: 256},
+		RateLimit:     RateLimit{PerSecond: 240, Burst: 240, Disconnect: 1000},
+		MaxErrors:     10,
+		errors:        make(map[int]int),
+		rtt:           make(map[int]time.Duration),
+		addrs:         make(map[int]string),
+		banned:        make(map[string]bool),
+		stop:          make(chan struct{}),
+		Metrics:       newMetrics(),
 	}
+	server.Mux.HandleFunc("/", server.echo)
+	server.Mux.HandleFunc("/healthz", server.healthz)
+	server.Mux.HandleFunc("/metrics", server.metrics)
+	return server
+}
+
+func StartServer(handleMessage Handler) *Server {
+	server := NewServer(handleMessage)
+	go server.ListenAndServe(":8080")
+	return server
+}
 
-	http.HandleFunc("/", server.echo)
-	go http.ListenAndServe(":8080", nil)
+// ListenAndServe accepts connections on addr until Stop is called, when it
+// returns http.ErrServerClosed.
+func (server *Server) ListenAndServe(addr string) error {
+	listener := &http.Server{Addr: addr, Handler: server.Mux}
+	server.Lock.Lock()
+	select {
+	case <-server.stop:
+		server.Lock.Unlock()
+		return http.ErrServerClosed
+	default:
+	}
+	server.listeners = append(server.listeners, listener)
+	server.Lock.Unlock()
+	return listener.ListenAndServe()
+}
 
-	return &server
+// Stop makes Poll return after its current tick, stops ListenAndServe and
+// disconnects every client. A stopped server cannot be started again.
+func (server *Server) Stop() {
+	server.stopOnce.Do(func() {
+		server.Lock.Lock()
+		defer server.Lock.Unlock()
+		close(server.stop)
+		for _, listener := range server.listeners {
+			listener.Close()
+		}
+		for _, codec := range server.clients {
+			codec.Close()
+		}
+	})
 }
+
+// Poll runs the simulation until Stop is called: every dur it handles the
+// messages received since the last tick, in the order they arrived, and
+// then calls f. Messages are only handled while Poll is running.
 func (server *Server) Poll(dur time.Duration, f func()) {
+	server.SetTickRate(dur)
 	for {
-		time.Sleep(dur)
+		select {
+		case <-time.After(server.TickRate()):
+		case <-server.stop:
+			return
+		}
+		start := time.Now()
+		tick := server.tick.Add(1)
+		server.tickTimes[tick%tickHistory] = start
+		server.drain()
 		f()
+		server.tickDone(start)
+	}
+}
+
+// Tick returns the number of the current simulation tick.
+func (server *Server) Tick() uint64 {
+	return server.tick.Load()
+}
+
+// SetTick sets the number of the current simulation tick, so a restored
+// server carries on from where it stopped. Call it before Poll.
+func (server *Server) SetTick(tick uint64) {
+	server.tick.Store(tick)
+}
+
+// TickRate returns the time between simulation ticks.
+func (server *Server) TickRate() time.Duration {
+	return time.Duration(server.tickRate.Load())
+}
+
+// SetTickRate changes the time between simulation ticks of a running Poll.
+// Times shorter than MinTickRate are raised to it.
+func (server *Server) SetTickRate(dur time.Duration) {
+	server.tickRate.Store(int64(max(dur, MinTickRate)))
+}
+
+// Do runs f on the Poll goroutine at the start of the next tick, after the
+// messages received before it.
+func (server *Server) Do(f func()) {
+	server.receive(inbound{task: f})
+}
+
+// Kick disconnects client id, reporting whether it was connected.
+func (server *Server) Kick(id int) bool {
+	server.Lock.Lock()
+	defer server.Lock.Unlock()
+	codec, ok := server.clients[id]
+	if ok {
+		codec.Close()
+	}
+	return ok
+}
+
+// Addr returns the remote host of client id, or "" for in-process clients.
+func (server *Server) Addr(id int) string {
+	server.Lock.Lock()
+	defer server.Lock.Unlock()
+	return server.addrs[id]
+}
+
+// Ban refuses future connections from host.
+func (server *Server) Ban(host string) {
+	server.Lock.Lock()
+	server.banned[host] = true
+	server.Lock.Unlock()
+}
+
+func (server *Server) Unban(host string) bool {
+	server.Lock.Lock()
+	defer server.Lock.Unlock()
+	banned := server.banned[host]
+	delete(server.banned, host)
+	return banned
+}
+
+// Clients returns the ids of connected clients.
+func (server *Server) Clients() []int {
+	server.Lock.Lock()
+	defer server.Lock.Unlock()
+	ids := make([]int, 0, len(server.clients))
+	for id := range server.clients {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Ack records that client id has received the snapshot of tick, updating its
+// round trip time estimate. It must be called from a Handler: the sample is
+// measured to when the message being handled arrived, not to when the tick
+// got round to handling it.
+func (server *Server) Ack(id int, tick uint64) {
+	current := server.tick.Load()
+	if tick == 0 || tick > current || current-tick >= tickHistory {
+		return
+	}
+	sample := server.arrived.Sub(server.tickTimes[tick%tickHistory])
+	server.Lock.Lock()
+	if rtt, ok := server.rtt[id]; ok {
+		server.rtt[id] = rtt + (sample-rtt)/8
+	} else {
+		server.rtt[id] = sample
+	}
+	server.Lock.Unlock()
+}
+
+// RTT returns the smoothed round trip time of client id.
+func (server *Server) RTT(id int) time.Duration {
+	server.Lock.Lock()
+	defer server.Lock.Unlock()
+	return server.rtt[id]
+}
+
+func (server *Server) receive(in inbound) {
+	server.inboxLock.Lock()
+	server.inbox = append(server.inbox, in)
+	server.inboxLock.Unlock()
+}
+
+// drain handles every queued message and disconnect.
+func (server *Server) drain() {
+	server.inboxLock.Lock()
+	inbox := server.inbox
+	server.inbox = nil
+	server.inboxLock.Unlock()
+
+	for _, in := range inbox {
+		if in.task != nil {
+			in.task()
+			continue
+		}
+		if in.disconnected {
+			if server.OnDisconnect != nil {
+				server.OnDisconnect(in.id)
+			}
+			server.Lock.Lock()
+			delete(Players, in.id)
+			delete(server.clients, in.id) // Removing the connection
+			delete(server.rtt, in.id)
+			delete(server.addrs, in.id)
+			server.Lock.Unlock()
+			delete(server.errors, in.id)
+			continue
+		}
+		if server.Recorder != nil {
+			server.Recorder.RecordIn(server.Tick(), in.id, in.message)
+		}
+		if len(in.message) > 0 {
+			server.Metrics.MessagesIn[in.message[0]].Add(1)
+		}
+		server.arrived = in.arrived
+		if err := server.handleMessage(server, in.id, in.message); err != nil {
+			slog.Debug("invalid message", "client", in.id, "tick", server.Tick(), "err", err)
+			server.errors[in.id]++
+			if n := server.errors[in.id]; server.MaxErrors > 0 && n == server.MaxErrors {
+				slog.Warn("disconnecting client after invalid messages", "client", in.id, "tick", server.Tick(), "errors", n, "err", err)
+				server.Lock.Lock()
+				if codec, ok := server.clients[in.id]; ok {
+					codec.Close()
+				}
+				server.Lock.Unlock()
+			}
+		}
 	}
 }
 
 var Players = make(map[int]PlayerData)
 
 func (server *Server) echo(w http.ResponseWriter, r *http.Request) {
-	connection, _ := upgrader.Upgrade(w, r, nil)
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	server.Lock.Lock()
+	banned := server.banned[host]
+	server.Lock.Unlock()
+	if banned {
+		http.Error(w, "banned", http.StatusForbidden)
+		return
+	}
+	connection, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	connection.SetReadLimit(MaxClientFrame)
+	server.serve(connection, host)
+}
+
+// Serve registers connection as a new client and handles its messages until
+// it is closed.
+func (server *Server) Serve(connection Conn) {
+	server.serve(connection, "")
+}
+
+func (server *Server) serve(connection Conn, host string) {
+	server.Lock.Lock()
 	id := server.idGen
 	server.idGen++
-	server.clients[id] = connection // Save the connection using it as a key
+	server.addrs[id] = host
+	server.Lock.Unlock()
 	connection.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("%d", id)))
+	if server.Conditions.Enabled() {
+		connection = Simulate(connection, server.Conditions)
+	}
+	opts := server.Codec
+	opts.MaxInflated = MaxClientFrame
+	codec := NewCodec(connection, opts, &server.Stats)
+
+	server.Lock.Lock()
+	server.clients[id] = codec // Save the connection using it as a key
 	Players[id] = PlayerData{glm.Vec3{0, 0, 0}, glm.Quat{W: 0, V: glm.Vec3{0, 0, 1}}}
+	server.Lock.Unlock()
+	slog.Info("client connected", "client", id, "addr", host, "tick", server.Tick())
 	// server.WriteMessage([]byte(fmt.Sprintf("create: %d", id)))
 
+	limit := NewLimiter(server.RateLimit)
 	for {
-		mt, message, err := connection.ReadMessage()
+		mt, message, err := codec.ReadMessage()
 
 		if err != nil || mt == websocket.CloseMessage {
 			break // Exit the loop if the client tries to close the connection or the connection is interrupted
 		}
 
-		go server.handleMessage(server, id, message)
+		arrived := time.Now()
+		ok, disconnect := limit.Allow(arrived)
+		if disconnect {
+			slog.Warn("disconnecting client for exceeding the message rate limit", "client", id, "tick", server.Tick())
+			break
+		}
+		if !ok {
+			server.Metrics.RateLimited.Add(1)
+			continue
+		}
+
+		server.receive(inbound{id: id, message: message, arrived: arrived})
 	}
-	delete(Players, id)
-	delete(server.clients, id) // Removing the connection
+	// The client is removed at the next tick, after any messages it sent.
+	server.receive(inbound{id: id, disconnected: true})
+	slog.Info("client disconnected", "client", id, "tick", server.Tick())
 
 	connection.Close()
 	// server.WriteMessage([]byte(fmt.Sprintf("destroy: %d", id)))
@@ -79,15 +412,33 @@ type Message struct {
 	Data   PlayerData
 }
 
+// writeErrors limits how often failed writes are logged.
+var writeErrors = logging.Every(time.Second)
+
+// WriteMessage sends message to client, or to every client if client is -1.
 func (server *Server) WriteMessage(client int, message []byte) {
 	server.Lock.Lock()
+	if server.Recorder != nil {
+		server.Recorder.RecordOut(server.Tick(), client, message)
+	}
 
 	// newMessage := append([]byte(fmt.Sprintf("%d, ", client)), message...)
-	for _, conn := range server.clients {
+	frame := server.Codec.encode(0, message)
+	for id, codec := range server.clients {
+		if client >= 0 && id != client {
+			continue
+		}
 		// println(string(newMessage))
-		err := conn.WriteMessage(websocket.BinaryMessage, message)
+		err := codec.writeFrame(frame, len(message))
 		if err != nil {
-			println("Error writing message")
+			server.Metrics.DroppedSends.Add(1)
+			if ok, suppressed := writeErrors.Allow(); ok {
+				slog.Warn("write failed", "client", id, "tick", server.Tick(), "err", err, "suppressed", suppressed)
+			}
+			continue
+		}
+		if len(message) > 0 {
+			server.Metrics.MessagesOut[message[0]].Add(1)
 		}
 	}
 	server.Lock.Unlock()
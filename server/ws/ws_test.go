@@ -0,0 +1,125 @@
+package ws
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestAckMeasuresArrival(t *testing.T) {
+	server := NewServer(func(server *Server, id int, message []byte) error {
+		tick, err := DecodeAck(message[1:])
+		if err != nil {
+			return err
+		}
+		server.Ack(id, tick)
+		return nil
+	})
+	start := time.Now().Add(-time.Second)
+	server.SetTick(5)
+	server.tickTimes[5] = start
+
+	// The ack arrived 40ms after tick 5 started, but is handled much later.
+	server.receive(inbound{id: 3, message: EncodeAck(5), arrived: start.Add(40 * time.Millisecond)})
+	server.drain()
+	if rtt := server.RTT(3); rtt != 40*time.Millisecond {
+		t.Errorf("RTT %v, want 40ms", rtt)
+	}
+	server.receive(inbound{id: 3, message: EncodeAck(5), arrived: start.Add(120 * time.Millisecond)})
+	server.drain()
+	if rtt := server.RTT(3); rtt != 50*time.Millisecond {
+		t.Errorf("smoothed RTT %v, want 50ms", rtt)
+	}
+}
+
+func TestSetTickRate(t *testing.T) {
+	server := NewServer(nil)
+	server.SetTickRate(time.Microsecond)
+	if r := server.TickRate(); r != MinTickRate {
+		t.Errorf("tick rate %v, want it raised to %v", r, MinTickRate)
+	}
+}
+
+// handled collects the messages a server handles.
+func handled(server *Server) *[][]byte {
+	var messages [][]byte
+	server.handleMessage = func(server *Server, id int, message []byte) error {
+		messages = append(messages, message)
+		return nil
+	}
+	return &messages
+}
+
+// closed waits for conn to be closed by the other end.
+func closed(t *testing.T, conn Conn) {
+	t.Helper()
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("the server did not close the connection")
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	server := NewServer(nil)
+	messages := handled(server)
+	http := httptest.NewServer(server.Mux)
+	defer http.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(http.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	small := CodecOptions{}.encode(0, []byte{MessageChat, 'h', 'i'})
+	if err := conn.WriteMessage(websocket.BinaryMessage, small); err != nil {
+		t.Fatal(err)
+	}
+	large := CodecOptions{}.encode(0, make([]byte, MaxClientFrame))
+	if err := conn.WriteMessage(websocket.BinaryMessage, large); err != nil {
+		t.Fatal(err)
+	}
+	closed(t, conn)
+	server.drain()
+	if len(*messages) != 1 || !bytes.Equal((*messages)[0], small[1:]) {
+		t.Errorf("handled %d messages, want only the small one", len(*messages))
+	}
+}
+
+func TestInflateLimit(t *testing.T) {
+	server := NewServer(nil)
+	messages := handled(server)
+	client, conn := Pipe()
+	go server.Serve(conn)
+	if _, _, err := client.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	// Megabytes of zeros deflate to a frame well under the read limit.
+	bomb, ok := deflate(frameDeflate, make([]byte, 4<<20))
+	if !ok || len(bomb) > MaxClientFrame {
+		t.Fatalf("deflated to %d bytes", len(bomb))
+	}
+	fits, _ := deflate(frameDeflate, make([]byte, MaxClientFrame))
+	client.WriteMessage(websocket.BinaryMessage, fits)
+	client.WriteMessage(websocket.BinaryMessage, bomb)
+	closed(t, client)
+	server.drain()
+	if len(*messages) != 1 || len((*messages)[0]) != MaxClientFrame {
+		t.Errorf("handled %d messages, want only the one inflating to the limit", len(*messages))
+	}
+}
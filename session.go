@@ -0,0 +1,428 @@
+package main
+
+import (
+	"flag"
+	"go_wgpu/ecs"
+	"go_wgpu/jobs"
+	"go_wgpu/scene"
+	"go_wgpu/transform"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+	"unsafe"
+	"wgpu_server/character"
+	"wgpu_server/collision"
+	"wgpu_server/game"
+	"wgpu_server/physics"
+	"wgpu_server/replay"
+	"wgpu_server/ws"
+
+	"github.com/EngoEngine/glm"
+)
+
+var host = flag.Bool("host", false, "run the server in this process and play over a loopback connection")
+var listen = flag.String("listen", "", "when hosting, also accept remote players on this address")
+var scenePath = flag.String("scene", "", "spawn the entities of this scene file at startup")
+var fly = flag.Bool("fly", false, "start flying through colliders instead of walking, as the player always does in a scene without solid cubes; F toggles")
+
+func init() {
+	scene.Register[Simulated]("simulated")
+	scene.Register[physics.Body]("body")
+	scene.Register[Solid]("solid")
+}
+
+// numModels is how many model entities are simulated, and maxInstances how
+// many instances the renderer has room for.
+const (
+	numModels    = 1_000_000
+	maxInstances = 1_000_000
+)
+
+// Simulated marks the models the simulation spins and moves.
+type Simulated struct{}
+
+// Solid marks the cubes the player collides with.
+type Solid struct{}
+
+// Model is an instance's model matrix as the renderer reads it.
+type Model [16]float32
+
+// Player is the pose of a networked player, as received from the server.
+type Player struct {
+	Position glm.Vec3
+	Rotation glm.Quat
+}
+
+var numThreads = runtime.NumCPU()
+
+// simulateGrain is how many models each parallel chunk of the simulation
+// updates.
+const simulateGrain = 4096
+
+// physicsStep is the fixed timestep of rigid bodies, in seconds.
+const physicsStep = 1.0 / 60
+
+// Resources the systems share outside the world, for the schedule to order
+// them.
+const (
+	cameraResource    = "camera"    // the camera and the player's character
+	collisionResource = "collision" // colliders and solids
+)
+
+// eyeHeight is how far above the player's feet the camera is.
+const eyeHeight = 1.6
+
+// Session is the client's game loop without any rendering: networking,
+// movement and simulation, run as systems over an ECS world. The windowed
+// and headless clients both drive one a frame at a time.
+type Session struct {
+	World    *ecs.World
+	Schedule ecs.Schedule
+
+	camera    *Camera
+	client    Client
+	chatLog   ChatLog
+	player    *replay.Player // playing back a replay instead of a connection
+	server    *ws.Server     // hosted in this process with -host
+	teleports chan glm.Vec3
+	input     Input              // input of the frame being run
+	entities  map[int]ecs.Entity // entity of each client's player
+	scene     []ecs.Entity       // entities spawned from -scene
+	clock     physics.Clock
+	character character.Controller // the player
+	colliders collision.World      // a box for every solid cube
+	solids    map[ecs.Entity]solid
+	frame     uint64
+
+	mu       sync.Mutex
+	snapshot []ws.Message // latest snapshot received, nil once applied
+}
+
+// newSession connects to a server, hosts one or plays a replay, as selected
+// by the flags, and starts receiving.
+func newSession(camera *Camera) *Session {
+	session := &Session{
+		World:     ecs.NewWorld(),
+		camera:    camera,
+		teleports: make(chan glm.Vec3, 1),
+		entities:  make(map[int]ecs.Entity),
+		solids:    make(map[ecs.Entity]solid),
+		clock:     physics.NewClock(physicsStep),
+		character: character.New(camera.Position.Sub(&glm.Vec3{0, eyeHeight, 0})),
+	}
+	for range numModels {
+		e := session.World.Spawn()
+		ecs.Add(session.World, e, transform.New(glm.Vec3{}, glm.QuatIdent()))
+		ecs.Add(session.World, e, Simulated{})
+	}
+	if *scenePath != "" {
+		entities, err := scene.Load(*scenePath, session.World)
+		if err != nil {
+			slog.Error("could not load scene", "err", err)
+			os.Exit(1)
+		}
+		session.scene = entities
+		slog.Info("loaded scene", "path", *scenePath, "entities", len(entities))
+	}
+	session.Schedule.Pool = jobs.NewPool(numThreads)
+	session.Schedule.Add("network", session.applySnapshot)
+	session.Schedule.Add("simulate", session.simulate, ecs.Read[Simulated](), ecs.Write[transform.Transform]())
+	session.Schedule.Add("physics", session.physics, ecs.Write[physics.Body](), ecs.Write[transform.Transform]())
+	session.Schedule.Add("transforms", session.updateTransforms, ecs.Write[transform.Transform]())
+	session.Schedule.Add("movement", session.move, ecs.WriteResource(cameraResource), ecs.WriteResource(collisionResource), ecs.Read[Solid](), ecs.Read[transform.Transform]())
+	session.Schedule.Add("send", session.send, ecs.ReadResource(cameraResource))
+	slog.Debug("schedule", "systems", session.Schedule.Systems(), "waits_for", session.Schedule.Conflicts())
+
+	client := &session.client
+	if *replayPath != "" {
+		recording, err := replay.Load(*replayPath)
+		if err != nil {
+			slog.Error("could not load replay", "path", *replayPath, "err", err)
+			os.Exit(1)
+		}
+		slog.Info("replaying", "path", *replayPath, "duration", recording.Duration(), "records", len(recording.Records))
+		session.player = replay.NewPlayer(recording, *replayClient)
+		client.initReplay(session.player)
+	} else if *host {
+		server := game.NewServer()
+		if *listen != "" {
+			go func() {
+				if err := server.ListenAndServe(*listen); err != http.ErrServerClosed {
+					slog.Error("listen failed", "addr", *listen, "err", err)
+				}
+			}()
+		}
+		go server.Poll(game.TickRate, func() {
+			game.Tick(server)
+		})
+		session.server = server
+		client.initLocal(server)
+	} else {
+		client.init()
+	}
+	go client.Recv(session.receive)
+	return session
+}
+
+func (session *Session) receive(s []byte) {
+	client := &session.client
+	if len(s) > 0 && s[0] == ws.ServerChat {
+		session.chatLog.Receive(s)
+		return
+	}
+	if len(s) > 0 && s[0] == ws.ServerTeleport {
+		position, err := ws.DecodeTeleport(s)
+		if err != nil {
+			slog.Warn("invalid teleport", "client", client.id, "err", err)
+			return
+		}
+		select {
+		case <-session.teleports:
+		default:
+		}
+		session.teleports <- position
+		return
+	}
+	tick, messages, err := ws.DecodeSnapshot(s)
+	if err != nil {
+		slog.Warn("invalid snapshot", "client", client.id, "err", err)
+		return
+	}
+	client.Ack(tick)
+	slog.Debug("snapshot", "client", client.id, "tick", tick, "players", len(messages))
+	session.mu.Lock()
+	session.snapshot = messages
+	session.mu.Unlock()
+}
+
+// Close stops the server the session hosts, if any.
+func (session *Session) Close() {
+	if session.server != nil {
+		session.server.Stop()
+	}
+}
+
+// Update advances the session by one frame of dt seconds, running every
+// system in its schedule.
+func (session *Session) Update(dt float64, input Input) {
+	session.input = input
+	session.Schedule.Run(session.World, dt)
+}
+
+// reloadScene replaces the entities spawned from -scene with those the file
+// holds now. If it no longer loads, the old entities stay.
+func (session *Session) reloadScene() {
+	entities, err := scene.Load(*scenePath, session.World)
+	if err != nil {
+		slog.Error("dev mode: scene not reloaded", "err", err)
+		return
+	}
+	for _, e := range session.scene {
+		transform.Despawn(session.World, e)
+	}
+	session.scene = entities
+	slog.Info("dev mode: reloaded scene", "path", *scenePath, "entities", len(entities))
+}
+
+// applySnapshot brings the player entities up to date with the latest
+// snapshot, spawning players that joined and despawning those that left.
+func (session *Session) applySnapshot(w *ecs.World, dt float64) {
+	session.mu.Lock()
+	messages := session.snapshot
+	session.snapshot = nil
+	session.mu.Unlock()
+	if messages == nil {
+		return
+	}
+	seen := make(map[int]bool, len(messages))
+	for _, message := range messages {
+		id := message.Client
+		seen[id] = true
+		entity, ok := session.entities[id]
+		if !ok {
+			entity = w.Spawn()
+			session.entities[id] = entity
+			ecs.Add(w, entity, transform.New(message.Data.Position, message.Data.Rotation))
+			ecs.Add(w, entity, scene.Mesh{Name: "cube"})
+		}
+		ecs.Add(w, entity, Player(message.Data))
+		t := ecs.Get[transform.Transform](w, entity)
+		t.SetPosition(message.Data.Position)
+		t.SetRotation(message.Data.Rotation)
+		slog.Debug("player", "client", id, "position", message.Data.Position, "rotation", message.Data.Rotation)
+	}
+	for id, entity := range session.entities {
+		if !seen[id] {
+			transform.Despawn(w, entity)
+			delete(session.entities, id)
+		}
+	}
+}
+
+// move moves the player by the frame's input, walking into and along the
+// solid cubes or flying through them, or to where the server teleported it.
+// The camera follows the player's eyes.
+func (session *Session) move(w *ecs.World, dt float64) {
+	camera, input, player := session.camera, session.input, &session.character
+	camera.Rotation = input.Rotation
+	player.Flying = input.Fly
+	var wish glm.Vec3
+	if player.Flying {
+		wish = camera.Rotation.Rotate(&input.Move)
+	} else {
+		// Walk along the ground whichever way the camera is pitched.
+		up, right := glm.Vec3{0, 1, 0}, camera.Rotation.Rotate(&glm.Vec3{1, 0, 0})
+		right[1] = 0
+		right.Normalize()
+		forward := up.Cross(&right)
+		forward = forward.Mul(-input.Move[2])
+		wish = right.Mul(input.Move[0])
+		wish.AddWith(&forward)
+		if wish.Len() > 1 {
+			wish.Normalize()
+		}
+	}
+	session.updateSolids(w)
+	player.Move(&session.colliders, wish, input.Jump, float32(dt), nil)
+	select {
+	case position := <-session.teleports:
+		player.Position = position.Sub(&glm.Vec3{0, eyeHeight, 0})
+		player.Velocity = glm.Vec3{}
+	default:
+	}
+	camera.Position = player.Position.Add(&glm.Vec3{0, eyeHeight, 0})
+}
+
+// solid is the collision box of a solid cube.
+type solid struct {
+	proxy collision.Proxy
+	world glm.Mat4 // the cube's world matrix when its box was last set
+	seen  uint64   // frame the cube was last seen in
+}
+
+// updateSolids keeps a box in the collision world for every solid cube,
+// moving a box only when its cube has moved, so the broadphase stays
+// nearly sorted from frame to frame.
+func (session *Session) updateSolids(w *ecs.World) {
+	session.frame++
+	ecs.NewQuery2[Solid, transform.Transform](w).Each(func(e ecs.Entity, _ *Solid, t *transform.Transform) {
+		m := t.World()
+		s, ok := session.solids[e]
+		if !ok {
+			s.proxy = session.colliders.Add(cubeBox(m))
+		} else if s.world != m {
+			session.colliders.Set(s.proxy, cubeBox(m))
+		}
+		s.world, s.seen = m, session.frame
+		session.solids[e] = s
+	})
+	var gone []ecs.Entity
+	for e, s := range session.solids {
+		if s.seen != session.frame {
+			gone = append(gone, e)
+		}
+	}
+	// Remove in a fixed order, which decides how proxies are reused.
+	slices.Sort(gone)
+	for _, e := range gone {
+		session.colliders.Remove(session.solids[e].proxy)
+		delete(session.solids, e)
+	}
+}
+
+// StartFlying reports whether the player starts out flying: with -fly, or
+// when there are no solid cubes to walk on.
+func (session *Session) StartFlying() bool {
+	return *fly || ecs.Components[Solid](session.World).Len() == 0
+}
+
+// cubeBox returns the box the cube mesh, which spans -1 to 1 on every axis,
+// fills when drawn with model matrix m.
+func cubeBox(m glm.Mat4) collision.OBB {
+	var box collision.OBB
+	box.Center = glm.Vec3{m[12], m[13], m[14]}
+	for k := range 3 {
+		axis := glm.Vec3{m[4*k], m[4*k+1], m[4*k+2]}
+		box.HalfExtents[k] = axis.Len()
+		if box.HalfExtents[k] > 0 {
+			axis = axis.Mul(1 / box.HalfExtents[k])
+		}
+		m[4*k], m[4*k+1], m[4*k+2] = axis[0], axis[1], axis[2]
+	}
+	m[12], m[13], m[14] = 0, 0, 0
+	box.Rotation = glm.Mat4ToQuat(&m)
+	return box
+}
+
+// send sends the camera's pose as the player's state.
+func (session *Session) send(w *ecs.World, dt float64) {
+	player := Player{Position: session.camera.Position, Rotation: session.camera.Rotation}
+	message := (*[unsafe.Sizeof(player)]byte)(unsafe.Pointer(&player))
+	newMessage := append([]byte{ws.MessagePlayerData}, message[:]...)
+	session.client.SendState(newMessage)
+}
+
+// simulate spins and moves every simulated model.
+func (session *Session) simulate(w *ecs.World, dt float64) {
+	axis := glm.Vec3{0, 1, 0}
+	rotation := glm.QuatRotate(float32(dt), &axis)
+	move := glm.Vec3{0, 0, float32(dt) * 5.0}
+	ecs.NewQuery2[Simulated, transform.Transform](w).ParallelEach(session.Schedule.Pool, simulateGrain, func(e ecs.Entity, _ *Simulated, t *transform.Transform) {
+		t.Rotate(rotation)
+		t.Translate(move)
+	})
+}
+
+// physics moves every entity with a rigid body by the fixed steps due this
+// frame. Bodies start each frame at their entity's transform, so moving the
+// transform moves the body. Bodies move in world space, so a body on a
+// parented entity is left alone: it moves with its parent instead.
+func (session *Session) physics(w *ecs.World, dt float64) {
+	steps := session.clock.Advance(dt)
+	if steps == 0 {
+		return
+	}
+	ecs.NewQuery2[physics.Body, transform.Transform](w).Each(func(e ecs.Entity, body *physics.Body, t *transform.Transform) {
+		if t.Parent() != ecs.Nil {
+			return
+		}
+		body.Position, body.Rotation = t.Position(), t.Rotation()
+		for range steps {
+			body.Integrate(physics.Gravity, physicsStep)
+		}
+		t.SetPosition(body.Position)
+		t.SetRotation(body.Rotation)
+	})
+}
+
+// updateTransforms brings every world matrix up to date.
+func (session *Session) updateTransforms(w *ecs.World, dt float64) {
+	transform.Update(w, session.Schedule.Pool)
+}
+
+// writeInstances writes the model matrix of every entity with a mesh into
+// dst and returns how many it wrote.
+func writeInstances(w *ecs.World, dst [][16]float32) int {
+	i := 0
+	ecs.NewQuery2[scene.Mesh, transform.Transform](w).Each(func(e ecs.Entity, _ *scene.Mesh, t *transform.Transform) {
+		if i < len(dst) {
+			dst[i] = t.World()
+			i++
+		}
+	})
+	return i
+}
+
+// logStats logs the frame rate and network traffic once a second.
+func (session *Session) logStats(fps float32) {
+	if player := session.player; player != nil {
+		slog.Info("frame stats", "fps", fps, "replay", player.Position().Round(time.Second), "duration", player.Duration().Round(time.Second), "speed", player.Speed(), "paused", player.Paused())
+		return
+	}
+	stats := session.client.codec.Stats()
+	slog.Info("frame stats", "fps", fps, "sent", stats.WireOut.Load(), "received", stats.WireIn.Load(), "saved", stats.Saved())
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+	"wgpu_server/ws"
+
+	"github.com/EngoEngine/glm"
+	"github.com/gorilla/websocket"
+)
+
+// freeAddr returns a local address nothing is listening on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// dial connects to a server listening on addr, retrying while it starts.
+func dial(t *testing.T, addr string) *websocket.Conn {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/", nil)
+		if err == nil {
+			return conn
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("could not connect to %s: %v", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHostListen(t *testing.T) {
+	savedHost, savedListen := *host, *listen
+	t.Cleanup(func() { *host, *listen = savedHost, savedListen })
+	*host, *listen = true, freeAddr(t)
+
+	camera := NewCamera()
+	session := newSession(&camera)
+	defer session.Close()
+	if session.client.id < 0 || session.server == nil {
+		t.Fatalf("hosting session has client %d and server %v", session.client.id, session.server)
+	}
+
+	// A remote player joins the hosted world over the network.
+	conn := dial(t, *listen)
+	defer conn.Close()
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var remote int
+	if _, err := fmt.Sscanf(string(message), "%d", &remote); err != nil || remote == session.client.id {
+		t.Fatalf("remote player got id %q, the host is %d", message, session.client.id)
+	}
+	codec := ws.NewCodec(conn, ws.CodecOptions{}, nil)
+	// The host's frames are slow with a million models, so only the latest
+	// snapshot is kept.
+	snapshots := make(chan []ws.Message, 1)
+	go func() {
+		defer close(snapshots)
+		for {
+			_, message, err := codec.ReadMessage()
+			if err != nil {
+				return
+			}
+			if _, messages, err := ws.DecodeSnapshot(message); err == nil {
+				select {
+				case <-snapshots:
+				default:
+				}
+				snapshots <- messages
+			}
+		}
+	}()
+
+	// The host flies forward. The remote player sees it where its camera
+	// ends up, and the host sees the remote player.
+	input := Input{Move: glm.Vec3{0, 0, -1}, Rotation: camera.Rotation, Fly: true}
+	for range 10 {
+		session.Update(1.0/60, input)
+	}
+	input.Move = glm.Vec3{}
+	seenHost := false
+	deadline := time.After(2 * time.Second)
+	for !seenHost || session.entities[remote] == 0 {
+		session.Update(1.0/60, input)
+		select {
+		case messages := <-snapshots:
+			for _, m := range messages {
+				if m.Client == session.client.id && m.Data.Position == camera.Position && camera.Position != (glm.Vec3{}) {
+					seenHost = true
+				}
+			}
+		case <-deadline:
+			t.Fatalf("remote saw the host %v, host has remote entity %v", seenHost, session.entities[remote])
+		case <-time.After(time.Second / 60):
+		}
+	}
+
+	// Closing the session stops the hosted server and disconnects the
+	// remote player.
+	session.Close()
+	select {
+	case _, ok := <-snapshots:
+		for ok {
+			_, ok = <-snapshots
+		}
+	case <-time.After(time.Second):
+		t.Error("the remote player is still connected")
+	}
+	if conn, _, err := websocket.DefaultDialer.Dial("ws://"+*listen+"/", nil); err == nil {
+		conn.Close()
+		t.Error("still listening after Close")
+	}
+}
@@ -0,0 +1,279 @@
+package spatial_test
+
+import (
+	"go_wgpu/ecs"
+	"go_wgpu/spatial"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+	"wgpu_server/collision"
+
+	"github.com/EngoEngine/glm"
+)
+
+// The benchmarks measure the indexes with as many entities as the client
+// simulates: building them, moving every entity a frame's worth, and radius,
+// box, frustum and ray queries, each next to a scan of every entity.
+
+const (
+	entities = 1_000_000
+	extent   = 1000 // entities are spread over a cube this wide
+	cellSize = 16   // of the hash
+	margin   = 0.5  // of BVH leaves
+	radius   = 25   // of radius queries, and half the size of box queries
+	far      = 1000 // plane of frustum queries
+	seed     = 1
+
+	// step is how far entities move each frame, as far as the client's
+	// simulated models do at 60 frames per second.
+	step = 5.0 / 60
+)
+
+func randomPoint(r *rand.Rand) glm.Vec3 {
+	return glm.Vec3{(r.Float32() - 0.5) * extent, (r.Float32() - 0.5) * extent, (r.Float32() - 0.5) * extent}
+}
+
+func randomDirection(r *rand.Rand) glm.Vec3 {
+	for {
+		d := glm.Vec3{r.Float32()*2 - 1, r.Float32()*2 - 1, r.Float32()*2 - 1}
+		if l := d.Len(); l > 0.01 && l <= 1 {
+			return d.Mul(1 / l)
+		}
+	}
+}
+
+// cube returns the bounds of the client's cube mesh at p.
+func cube(p glm.Vec3) collision.AABB {
+	return collision.AABB{Min: glm.Vec3{p[0] - 1, p[1] - 1, p[2] - 1}, Max: glm.Vec3{p[0] + 1, p[1] + 1, p[2] + 1}}
+}
+
+// scene returns the bounds of every entity, indexed by entity minus one,
+// made the first time a benchmark needs them.
+var scene = sync.OnceValue(func() []collision.AABB {
+	r := rand.New(rand.NewSource(seed))
+	bounds := make([]collision.AABB, entities)
+	for i := range bounds {
+		bounds[i] = cube(randomPoint(r))
+	}
+	return bounds
+})
+
+func newHash() spatial.Index { return spatial.NewHash(cellSize) }
+func newBVH() spatial.Index  { return spatial.NewBVH(margin) }
+
+func filled(index spatial.Index) spatial.Index {
+	for i, b := range scene() {
+		index.Insert(ecs.Entity(i+1), b)
+	}
+	return index
+}
+
+// indexes returns a hash and a BVH holding the scene, for the queries.
+var indexes = sync.OnceValue(func() []struct {
+	name  string
+	index spatial.Index
+} {
+	return []struct {
+		name  string
+		index spatial.Index
+	}{{"Hash", filled(newHash())}, {"BVH", filled(newBVH())}}
+})
+
+func BenchmarkInsert(b *testing.B) {
+	for _, index := range []struct {
+		name string
+		new  func() spatial.Index
+	}{{"Hash", newHash}, {"BVH", newBVH}} {
+		b.Run(index.name, func(b *testing.B) {
+			scene()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				filled(index.new())
+			}
+		})
+	}
+}
+
+func BenchmarkRebuild(b *testing.B) {
+	bvh := filled(newBVH()).(*spatial.BVH)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		bvh.Rebuild()
+	}
+	b.ReportMetric(float64(bvh.Height()), "height")
+}
+
+// BenchmarkUpdate moves every entity one step in its own direction each
+// op, in indexes of its own so the others stay where the scene put them.
+func BenchmarkUpdate(b *testing.B) {
+	for _, index := range []struct {
+		name string
+		new  func() spatial.Index
+	}{{"Hash", newHash}, {"BVH", newBVH}} {
+		b.Run(index.name, func(b *testing.B) {
+			moved := filled(index.new())
+			bounds := append([]collision.AABB(nil), scene()...)
+			r := rand.New(rand.NewSource(seed))
+			directions := make([]glm.Vec3, len(bounds))
+			for i := range directions {
+				d := randomDirection(r)
+				directions[i] = d.Mul(step)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				for i := range bounds {
+					box := &bounds[i]
+					box.Min = box.Min.Add(&directions[i])
+					box.Max = box.Max.Add(&directions[i])
+					moved.Update(ecs.Entity(i+1), *box)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkQuery runs a random query each op on both indexes and on a scan
+// of every entity, and reports how many entities they found on average.
+// Queries use their own seed, or their random points would be where the
+// entities are.
+func benchmarkQuery(b *testing.B, query func(index spatial.Index, r *rand.Rand) int, scan func(bounds []collision.AABB, r *rand.Rand) int) {
+	run := func(b *testing.B, fn func(r *rand.Rand) int) {
+		r := rand.New(rand.NewSource(seed + 1))
+		total := 0
+		b.ReportAllocs()
+		b.ResetTimer()
+		for range b.N {
+			total += fn(r)
+		}
+		b.ReportMetric(float64(total)/float64(b.N), "found/op")
+	}
+	for _, index := range indexes() {
+		b.Run(index.name, func(b *testing.B) {
+			run(b, func(r *rand.Rand) int { return query(index.index, r) })
+		})
+	}
+	b.Run("scan", func(b *testing.B) {
+		bounds := scene()
+		run(b, func(r *rand.Rand) int { return scan(bounds, r) })
+	})
+}
+
+func BenchmarkRadius(b *testing.B) {
+	benchmarkQuery(b, func(index spatial.Index, r *rand.Rand) int {
+		count := 0
+		index.Radius(randomPoint(r), radius, func(e ecs.Entity) { count++ })
+		return count
+	}, func(bounds []collision.AABB, r *rand.Rand) int {
+		center := randomPoint(r)
+		count := 0
+		for _, b := range bounds {
+			var d2 float32
+			for k := range 3 {
+				v := max(b.Min[k]-center[k], 0, center[k]-b.Max[k])
+				d2 += v * v
+			}
+			if d2 <= radius*radius {
+				count++
+			}
+		}
+		return count
+	})
+}
+
+func box(r *rand.Rand) collision.AABB {
+	c := randomPoint(r)
+	return collision.AABB{Min: glm.Vec3{c[0] - radius, c[1] - radius, c[2] - radius}, Max: glm.Vec3{c[0] + radius, c[1] + radius, c[2] + radius}}
+}
+
+func BenchmarkBox(b *testing.B) {
+	benchmarkQuery(b, func(index spatial.Index, r *rand.Rand) int {
+		count := 0
+		index.Box(box(r), func(e ecs.Entity) { count++ })
+		return count
+	}, func(bounds []collision.AABB, r *rand.Rand) int {
+		q := box(r)
+		count := 0
+		for _, b := range bounds {
+			if b.Overlaps(q) {
+				count++
+			}
+		}
+		return count
+	})
+}
+
+// frustum returns the frustum of a camera like the client's at a random
+// point looking in a random direction.
+func frustum(r *rand.Rand) spatial.Frustum {
+	eye := randomPoint(r)
+	direction := randomDirection(r)
+	target := eye.Add(&direction)
+	up := glm.Vec3{0, 1, 0}
+	view := glm.LookAtV(&eye, &target, &up)
+	projection := glm.Perspective(math.Pi/4, 16.0/9, 1, far)
+	return spatial.NewFrustum(projection.Mul4(&view))
+}
+
+func BenchmarkFrustum(b *testing.B) {
+	benchmarkQuery(b, func(index spatial.Index, r *rand.Rand) int {
+		f := frustum(r)
+		count := 0
+		index.Frustum(&f, func(e ecs.Entity) { count++ })
+		return count
+	}, func(bounds []collision.AABB, r *rand.Rand) int {
+		// Test every entity against the frustum's planes.
+		f := frustum(r)
+		count := 0
+		for _, b := range bounds {
+			in := true
+			for _, p := range f.Planes {
+				// The corner of b furthest in front of the plane.
+				front := p.Distance
+				for k := range 3 {
+					corner := b.Min[k]
+					if p.Normal[k] >= 0 {
+						corner = b.Max[k]
+					}
+					front += p.Normal[k] * corner
+				}
+				if front < 0 {
+					in = false
+					break
+				}
+			}
+			if in {
+				count++
+			}
+		}
+		return count
+	})
+}
+
+func ray(r *rand.Rand) collision.Ray {
+	return collision.Ray{Origin: randomPoint(r), Dir: randomDirection(r)}
+}
+
+// BenchmarkRay finds the closest entity a random ray hits.
+func BenchmarkRay(b *testing.B) {
+	benchmarkQuery(b, func(index spatial.Index, r *rand.Rand) int {
+		hit := 0
+		index.Ray(ray(r), extent, func(e ecs.Entity, distance float32) float32 {
+			hit = 1
+			return distance
+		})
+		return hit
+	}, func(bounds []collision.AABB, r *rand.Rand) int {
+		q := ray(r)
+		hit, closest := 0, float32(extent)
+		for _, b := range bounds {
+			if d, ok := collision.RayCast(b, q, closest); ok {
+				hit, closest = 1, d.Distance
+			}
+		}
+		return hit
+	})
+}
@@ -0,0 +1,494 @@
+package spatial
+
+import (
+	"go_wgpu/ecs"
+	"wgpu_server/collision"
+
+	"github.com/EngoEngine/glm"
+)
+
+// null is the index of no node.
+const null = -1
+
+// BVH is a bounding volume hierarchy: a binary tree of boxes, each holding
+// the boxes below it, with an entity at every leaf. Queries descend only
+// into the boxes they touch.
+//
+// It is a dynamic tree like Box2D's: leaves are inserted next to the sibling
+// that grows the tree's surface area least, and the tree is rotated to keep
+// it balanced. Leaves hold their entity's bounds grown by a margin, so
+// entities that move a little stay where they are in the tree. Rebuild
+// builds the tree anew, which makes a better one faster than inserting
+// leaves one by one.
+type BVH struct {
+	margin float32
+	nodes  []bvhNode
+	root   int32
+	free   int32 // first of the free nodes, linked through parent
+	leaves map[ecs.Entity]int32
+}
+
+type bvhNode struct {
+	bounds collision.AABB // of both children, or an entity's bounds and margin
+	tight  collision.AABB // entity's bounds, for leaves
+	entity ecs.Entity
+
+	parent      int32 // next free node while free
+	left, right int32 // null for leaves
+	height      int32 // 0 for leaves, -1 while free
+}
+
+func (n *bvhNode) leaf() bool {
+	return n.left == null
+}
+
+// NewBVH returns an empty tree whose leaves are margin larger than their
+// entity's bounds on every side. Larger margins make moving entities
+// cheaper and queries slower.
+func NewBVH(margin float32) *BVH {
+	return &BVH{margin: margin, root: null, free: null, leaves: make(map[ecs.Entity]int32)}
+}
+
+func (t *BVH) allocate() int32 {
+	if t.free == null {
+		t.nodes = append(t.nodes, bvhNode{})
+		i := int32(len(t.nodes) - 1)
+		t.nodes[i] = bvhNode{parent: null, left: null, right: null}
+		return i
+	}
+	i := t.free
+	t.free = t.nodes[i].parent
+	t.nodes[i] = bvhNode{parent: null, left: null, right: null}
+	return i
+}
+
+func (t *BVH) release(i int32) {
+	t.nodes[i] = bvhNode{parent: t.free, left: null, right: null, height: -1}
+	t.free = i
+}
+
+func (t *BVH) fatten(b collision.AABB) collision.AABB {
+	m := glm.Vec3{t.margin, t.margin, t.margin}
+	return collision.AABB{Min: b.Min.Sub(&m), Max: b.Max.Add(&m)}
+}
+
+func (t *BVH) Insert(e ecs.Entity, bounds collision.AABB) {
+	if _, ok := t.leaves[e]; ok {
+		t.Update(e, bounds)
+		return
+	}
+	leaf := t.allocate()
+	n := &t.nodes[leaf]
+	n.bounds, n.tight, n.entity = t.fatten(bounds), bounds, e
+	t.leaves[e] = leaf
+	t.insertLeaf(leaf)
+}
+
+func (t *BVH) Update(e ecs.Entity, bounds collision.AABB) {
+	leaf, ok := t.leaves[e]
+	if !ok {
+		return
+	}
+	n := &t.nodes[leaf]
+	n.tight = bounds
+	if contains(n.bounds, bounds) {
+		return
+	}
+	t.removeLeaf(leaf)
+	t.nodes[leaf].bounds = t.fatten(bounds)
+	t.insertLeaf(leaf)
+}
+
+func (t *BVH) Remove(e ecs.Entity) bool {
+	leaf, ok := t.leaves[e]
+	if !ok {
+		return false
+	}
+	t.removeLeaf(leaf)
+	t.release(leaf)
+	delete(t.leaves, e)
+	return true
+}
+
+func (t *BVH) Bounds(e ecs.Entity) (collision.AABB, bool) {
+	leaf, ok := t.leaves[e]
+	if !ok {
+		return collision.AABB{}, false
+	}
+	return t.nodes[leaf].tight, true
+}
+
+func (t *BVH) Len() int {
+	return len(t.leaves)
+}
+
+// Height returns the number of levels below the root, 0 for a tree of one
+// leaf or none.
+func (t *BVH) Height() int {
+	if t.root == null {
+		return 0
+	}
+	return int(t.nodes[t.root].height)
+}
+
+func (t *BVH) insertLeaf(leaf int32) {
+	if t.root == null {
+		t.root = leaf
+		t.nodes[leaf].parent = null
+		return
+	}
+
+	// Find the best sibling: descend while growing a child costs less than
+	// making the leaf a sibling of the whole subtree.
+	box := t.nodes[leaf].bounds
+	index := t.root
+	for !t.nodes[index].leaf() {
+		n := &t.nodes[index]
+		area := surfaceArea(n.bounds)
+		combined := surfaceArea(n.bounds.Union(box))
+		cost := 2 * combined
+		inherited := 2 * (combined - area)
+		childCost := func(child int32) float32 {
+			c := &t.nodes[child]
+			grown := surfaceArea(c.bounds.Union(box))
+			if c.leaf() {
+				return grown + inherited
+			}
+			return grown - surfaceArea(c.bounds) + inherited
+		}
+		left, right := childCost(n.left), childCost(n.right)
+		if cost < left && cost < right {
+			break
+		}
+		if left < right {
+			index = n.left
+		} else {
+			index = n.right
+		}
+	}
+
+	sibling := index
+	oldParent := t.nodes[sibling].parent
+	parent := t.allocate()
+	p := &t.nodes[parent]
+	p.parent = oldParent
+	p.bounds = box.Union(t.nodes[sibling].bounds)
+	p.height = t.nodes[sibling].height + 1
+	p.left, p.right = sibling, leaf
+	if oldParent == null {
+		t.root = parent
+	} else if t.nodes[oldParent].left == sibling {
+		t.nodes[oldParent].left = parent
+	} else {
+		t.nodes[oldParent].right = parent
+	}
+	t.nodes[sibling].parent = parent
+	t.nodes[leaf].parent = parent
+	t.refit(parent)
+}
+
+func (t *BVH) removeLeaf(leaf int32) {
+	if leaf == t.root {
+		t.root = null
+		return
+	}
+	parent := t.nodes[leaf].parent
+	grandparent := t.nodes[parent].parent
+	sibling := t.nodes[parent].left
+	if sibling == leaf {
+		sibling = t.nodes[parent].right
+	}
+	t.release(parent)
+	t.nodes[leaf].parent = null
+	t.nodes[sibling].parent = grandparent
+	if grandparent == null {
+		t.root = sibling
+		return
+	}
+	if t.nodes[grandparent].left == parent {
+		t.nodes[grandparent].left = sibling
+	} else {
+		t.nodes[grandparent].right = sibling
+	}
+	t.refit(grandparent)
+}
+
+// refit balances and recomputes the bounds and heights of index and every
+// node above it.
+func (t *BVH) refit(index int32) {
+	for index != null {
+		index = t.balance(index)
+		n := &t.nodes[index]
+		left, right := &t.nodes[n.left], &t.nodes[n.right]
+		n.height = 1 + max(left.height, right.height)
+		n.bounds = left.bounds.Union(right.bounds)
+		index = n.parent
+	}
+}
+
+// balance rotates the taller child of a up if the children's heights
+// differ by more than one, and returns the node now where a was.
+func (t *BVH) balance(ia int32) int32 {
+	a := &t.nodes[ia]
+	if a.leaf() || a.height < 2 {
+		return ia
+	}
+	ib, ic := a.left, a.right
+	b, c := &t.nodes[ib], &t.nodes[ic]
+	switch d := c.height - b.height; {
+	case d > 1:
+		t.rotate(ia, ic, &a.right)
+		return ic
+	case d < -1:
+		t.rotate(ia, ib, &a.left)
+		return ib
+	}
+	return ia
+}
+
+// rotate puts up, a child of a held in slot, in a's place, with a as its
+// left child. up keeps its taller child, and the shorter one takes up's old
+// place under a.
+func (t *BVH) rotate(ia, iup int32, slot *int32) {
+	a, up := &t.nodes[ia], &t.nodes[iup]
+	taller, shorter := up.left, up.right
+	if t.nodes[taller].height <= t.nodes[shorter].height {
+		taller, shorter = shorter, taller
+	}
+
+	up.left = ia
+	up.parent = a.parent
+	a.parent = iup
+	if up.parent == null {
+		t.root = iup
+	} else if t.nodes[up.parent].left == ia {
+		t.nodes[up.parent].left = iup
+	} else {
+		t.nodes[up.parent].right = iup
+	}
+	up.right = taller
+	*slot = shorter
+	t.nodes[shorter].parent = ia
+
+	left, right := &t.nodes[a.left], &t.nodes[a.right]
+	a.bounds = left.bounds.Union(right.bounds)
+	a.height = 1 + max(left.height, right.height)
+	up.bounds = a.bounds.Union(t.nodes[taller].bounds)
+	up.height = 1 + max(a.height, t.nodes[taller].height)
+}
+
+// Rebuild builds the tree anew from its leaves, top down: each set of leaves
+// is split in half along the axis their centers spread furthest on.
+func (t *BVH) Rebuild() {
+	leaves := make([]buildLeaf, 0, len(t.leaves))
+	for i := range t.nodes {
+		switch n := &t.nodes[i]; {
+		case n.height == 0:
+			leaves = append(leaves, buildLeaf{int32(i), center(n.bounds)})
+		case n.height > 0:
+			t.release(int32(i))
+		}
+	}
+	t.root = null
+	if len(leaves) > 0 {
+		t.root = t.build(leaves, null)
+	}
+}
+
+// buildLeaf is a leaf being sorted into place by Rebuild, with its center
+// at hand rather than in the nodes.
+type buildLeaf struct {
+	node   int32
+	center glm.Vec3
+}
+
+func (t *BVH) build(leaves []buildLeaf, parent int32) int32 {
+	if len(leaves) == 1 {
+		t.nodes[leaves[0].node].parent = parent
+		return leaves[0].node
+	}
+	lo, hi := leaves[0].center, leaves[0].center
+	for _, leaf := range leaves[1:] {
+		for k := range 3 {
+			lo[k], hi[k] = min(lo[k], leaf.center[k]), max(hi[k], leaf.center[k])
+		}
+	}
+	axis := 0
+	for k := 1; k < 3; k++ {
+		if hi[k]-lo[k] > hi[axis]-lo[axis] {
+			axis = k
+		}
+	}
+	split(leaves, axis)
+
+	node := t.allocate()
+	half := len(leaves) / 2
+	left := t.build(leaves[:half], node)
+	right := t.build(leaves[half:], node)
+	n := &t.nodes[node]
+	n.parent, n.left, n.right = parent, left, right
+	n.bounds = t.nodes[left].bounds.Union(t.nodes[right].bounds)
+	n.height = 1 + max(t.nodes[left].height, t.nodes[right].height)
+	return node
+}
+
+// split reorders leaves so the centers of the first half are no further
+// along axis than those of the second, by quickselect with three way
+// partitions, which stays fast when many centers are equal.
+func split(leaves []buildLeaf, axis int) {
+	k := len(leaves) / 2
+	lo, hi := 0, len(leaves)
+	for hi-lo > 1 {
+		pivot := leaves[lo+(hi-lo)/2].center[axis]
+		less, i, greater := lo, lo, hi
+		for i < greater {
+			switch v := leaves[i].center[axis]; {
+			case v < pivot:
+				leaves[less], leaves[i] = leaves[i], leaves[less]
+				less++
+				i++
+			case v > pivot:
+				greater--
+				leaves[i], leaves[greater] = leaves[greater], leaves[i]
+			default:
+				i++
+			}
+		}
+		switch {
+		case k < less:
+			hi = less
+		case k >= greater:
+			lo = greater
+		default:
+			return
+		}
+	}
+}
+
+func (t *BVH) Radius(center glm.Vec3, radius float32, fn func(e ecs.Entity)) {
+	t.query(func(b collision.AABB) bool {
+		return withinRadius(b, center, radius)
+	}, fn)
+}
+
+func (t *BVH) Box(bounds collision.AABB, fn func(e ecs.Entity)) {
+	t.query(bounds.Overlaps, fn)
+}
+
+// query calls fn for the entity of every leaf whose bounds and tight
+// bounds pass test, descending only into nodes that pass it.
+func (t *BVH) query(test func(b collision.AABB) bool, fn func(e ecs.Entity)) {
+	if t.root == null {
+		return
+	}
+	var buf [64]int32
+	stack := append(buf[:0], t.root)
+	for len(stack) > 0 {
+		n := &t.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		if !test(n.bounds) {
+			continue
+		}
+		if n.leaf() {
+			if test(n.tight) {
+				fn(n.entity)
+			}
+			continue
+		}
+		stack = append(stack, n.left, n.right)
+	}
+}
+
+func (t *BVH) Frustum(f *Frustum, fn func(e ecs.Entity)) {
+	if t.root == null {
+		return
+	}
+	type entry struct {
+		node   int32
+		within bool // the node is inside f, so everything below it is
+	}
+	var buf [64]entry
+	stack := append(buf[:0], entry{t.root, false})
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		n := &t.nodes[top.node]
+		within := top.within
+		if !within {
+			switch f.classify(n.bounds) {
+			case outside:
+				continue
+			case inside:
+				within = true
+			}
+		}
+		if n.leaf() {
+			if within || f.classify(n.tight) != outside {
+				fn(n.entity)
+			}
+			continue
+		}
+		stack = append(stack, entry{n.left, within}, entry{n.right, within})
+	}
+}
+
+func (t *BVH) Ray(ray collision.Ray, maxDistance float32, fn func(e ecs.Entity, distance float32) float32) {
+	if t.root == null {
+		return
+	}
+	s := newSlab(ray)
+	type entry struct {
+		node     int32
+		distance float32 // at which the ray enters the node
+	}
+	d, ok := s.enter(t.nodes[t.root].bounds, maxDistance)
+	if !ok {
+		return
+	}
+	var buf [64]entry
+	stack := append(buf[:0], entry{t.root, d})
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if top.distance > maxDistance {
+			continue
+		}
+		n := &t.nodes[top.node]
+		if n.leaf() {
+			if d, ok := s.enter(n.tight, maxDistance); ok {
+				if maxDistance = fn(n.entity, d); maxDistance < 0 {
+					return
+				}
+			}
+			continue
+		}
+		// Visit the nearer child first, so the closest hit is found early
+		// and prunes the rest.
+		dl, hitLeft := s.enter(t.nodes[n.left].bounds, maxDistance)
+		dr, hitRight := s.enter(t.nodes[n.right].bounds, maxDistance)
+		switch {
+		case hitLeft && hitRight && dl <= dr:
+			stack = append(stack, entry{n.right, dr}, entry{n.left, dl})
+		case hitLeft && hitRight:
+			stack = append(stack, entry{n.left, dl}, entry{n.right, dr})
+		case hitLeft:
+			stack = append(stack, entry{n.left, dl})
+		case hitRight:
+			stack = append(stack, entry{n.right, dr})
+		}
+	}
+}
+
+func contains(outer, inner collision.AABB) bool {
+	return outer.Min[0] <= inner.Min[0] && outer.Min[1] <= inner.Min[1] && outer.Min[2] <= inner.Min[2] &&
+		inner.Max[0] <= outer.Max[0] && inner.Max[1] <= outer.Max[1] && inner.Max[2] <= outer.Max[2]
+}
+
+func surfaceArea(b collision.AABB) float32 {
+	x, y, z := b.Max[0]-b.Min[0], b.Max[1]-b.Min[1], b.Max[2]-b.Min[2]
+	return 2 * (x*y + y*z + z*x)
+}
+
+func center(b collision.AABB) glm.Vec3 {
+	return glm.Vec3{(b.Min[0] + b.Max[0]) / 2, (b.Min[1] + b.Max[1]) / 2, (b.Min[2] + b.Max[2]) / 2}
+}
@@ -0,0 +1,359 @@
+package spatial
+
+import (
+	"go_wgpu/ecs"
+	"math"
+	"wgpu_server/collision"
+
+	"github.com/EngoEngine/glm"
+)
+
+// cell is a cube of a Hash's grid, by its integer coordinates.
+type cell [3]int32
+
+// maxCell keeps cell coordinates, and their differences, from overflowing.
+const maxCell = 1 << 29
+
+// Hash is a spatial hash: space is divided into equal cubes, and each entity
+// is listed in every cube its bounds overlap. Queries only look at the
+// entities in the cubes they cover. Entities much larger than a cube are in
+// many of them, which makes them slow to move; a BVH suits those better.
+type Hash struct {
+	size  float32
+	cells map[cell][]int32 // items in each occupied cell
+	items []hashItem
+	index map[ecs.Entity]int32 // position in items
+
+	lo, hi cell // every occupied cell is between these
+	empty  bool // no cell has been occupied yet
+}
+
+type hashItem struct {
+	entity ecs.Entity
+	bounds collision.AABB
+	lo, hi cell
+}
+
+// NewHash returns an empty hash with cubes cellSize on a side. Queries are
+// fastest when most entities fit in a cube and a query covers a few.
+func NewHash(cellSize float32) *Hash {
+	return &Hash{
+		size:  cellSize,
+		cells: make(map[cell][]int32),
+		index: make(map[ecs.Entity]int32),
+		empty: true,
+	}
+}
+
+func (h *Hash) cellOf(p glm.Vec3) cell {
+	var c cell
+	for k := range 3 {
+		c[k] = int32(max(min(math.Floor(float64(p[k]/h.size)), maxCell), -maxCell))
+	}
+	return c
+}
+
+// span returns the first and last cells b overlaps.
+func (h *Hash) span(b collision.AABB) (cell, cell) {
+	return h.cellOf(b.Min), h.cellOf(b.Max)
+}
+
+func (h *Hash) Insert(e ecs.Entity, bounds collision.AABB) {
+	if _, ok := h.index[e]; ok {
+		h.Update(e, bounds)
+		return
+	}
+	i := int32(len(h.items))
+	lo, hi := h.span(bounds)
+	h.items = append(h.items, hashItem{entity: e, bounds: bounds, lo: lo, hi: hi})
+	h.index[e] = i
+	h.link(i)
+}
+
+func (h *Hash) Update(e ecs.Entity, bounds collision.AABB) {
+	i, ok := h.index[e]
+	if !ok {
+		return
+	}
+	item := &h.items[i]
+	item.bounds = bounds
+	lo, hi := h.span(bounds)
+	if lo == item.lo && hi == item.hi {
+		return
+	}
+	h.unlink(i)
+	item.lo, item.hi = lo, hi
+	h.link(i)
+}
+
+func (h *Hash) Remove(e ecs.Entity) bool {
+	i, ok := h.index[e]
+	if !ok {
+		return false
+	}
+	h.unlink(i)
+	delete(h.index, e)
+	last := int32(len(h.items) - 1)
+	if i != last {
+		// Move the last item into the hole and relist it under its new
+		// position.
+		moved := h.items[last]
+		forSpan(moved.lo, moved.hi, func(c cell) {
+			items := h.cells[c]
+			for j, item := range items {
+				if item == last {
+					items[j] = i
+					break
+				}
+			}
+		})
+		h.items[i] = moved
+		h.index[moved.entity] = i
+	}
+	h.items = h.items[:last]
+	return true
+}
+
+func (h *Hash) Bounds(e ecs.Entity) (collision.AABB, bool) {
+	i, ok := h.index[e]
+	if !ok {
+		return collision.AABB{}, false
+	}
+	return h.items[i].bounds, true
+}
+
+func (h *Hash) Len() int {
+	return len(h.items)
+}
+
+// link lists item i in every cell it overlaps.
+func (h *Hash) link(i int32) {
+	item := &h.items[i]
+	forSpan(item.lo, item.hi, func(c cell) {
+		h.cells[c] = append(h.cells[c], i)
+	})
+	if h.empty {
+		h.lo, h.hi, h.empty = item.lo, item.hi, false
+		return
+	}
+	for k := range 3 {
+		h.lo[k], h.hi[k] = min(h.lo[k], item.lo[k]), max(h.hi[k], item.hi[k])
+	}
+}
+
+// unlink takes item i out of every cell it is listed in.
+func (h *Hash) unlink(i int32) {
+	item := &h.items[i]
+	forSpan(item.lo, item.hi, func(c cell) {
+		items := h.cells[c]
+		for j, listed := range items {
+			if listed == i {
+				items[j] = items[len(items)-1]
+				items = items[:len(items)-1]
+				break
+			}
+		}
+		if len(items) == 0 {
+			delete(h.cells, c)
+		} else {
+			h.cells[c] = items
+		}
+	})
+}
+
+// forSpan calls fn for every cell from lo to hi.
+func forSpan(lo, hi cell, fn func(c cell)) {
+	for z := lo[2]; z <= hi[2]; z++ {
+		for y := lo[1]; y <= hi[1]; y++ {
+			for x := lo[0]; x <= hi[0]; x++ {
+				fn(cell{x, y, z})
+			}
+		}
+	}
+}
+
+// lookupCost is about how many items can be tested in the time it takes
+// to look up a cell.
+const lookupCost = 8
+
+// visit calls fn once for every item in the cells from lo to hi, with the
+// cell it was found in. When there are so many cells that testing every
+// item is faster, it does that instead, and passes inCell false.
+func (h *Hash) visit(lo, hi cell, fn func(item *hashItem, c cell, inCell bool)) {
+	if h.empty {
+		return
+	}
+	query := lo
+	for k := range 3 {
+		lo[k], hi[k] = max(lo[k], h.lo[k]), min(hi[k], h.hi[k])
+		if lo[k] > hi[k] {
+			return
+		}
+	}
+	if n := float64(hi[0]-lo[0]+1) * float64(hi[1]-lo[1]+1) * float64(hi[2]-lo[2]+1); n*lookupCost > float64(len(h.items)) {
+		for i := range h.items {
+			item := &h.items[i]
+			if item.lo[0] <= hi[0] && lo[0] <= item.hi[0] && item.lo[1] <= hi[1] && lo[1] <= item.hi[1] && item.lo[2] <= hi[2] && lo[2] <= item.hi[2] {
+				fn(item, cell{}, false)
+			}
+		}
+		return
+	}
+	forSpan(lo, hi, func(c cell) {
+		for _, i := range h.cells[c] {
+			item := &h.items[i]
+			// An item in several cells is visited in the lowest one both it
+			// and the query cover.
+			if c[0] == max(query[0], item.lo[0]) && c[1] == max(query[1], item.lo[1]) && c[2] == max(query[2], item.lo[2]) {
+				fn(item, c, true)
+			}
+		}
+	})
+}
+
+// cellBounds returns the box c covers.
+func (h *Hash) cellBounds(c cell) collision.AABB {
+	lo := glm.Vec3{float32(c[0]) * h.size, float32(c[1]) * h.size, float32(c[2]) * h.size}
+	return collision.AABB{Min: lo, Max: glm.Vec3{lo[0] + h.size, lo[1] + h.size, lo[2] + h.size}}
+}
+
+func (h *Hash) Radius(center glm.Vec3, radius float32, fn func(e ecs.Entity)) {
+	r := glm.Vec3{radius, radius, radius}
+	lo, hi := h.span(collision.AABB{Min: center.Sub(&r), Max: center.Add(&r)})
+	h.visit(lo, hi, func(item *hashItem, c cell, inCell bool) {
+		if withinRadius(item.bounds, center, radius) {
+			fn(item.entity)
+		}
+	})
+}
+
+func (h *Hash) Box(bounds collision.AABB, fn func(e ecs.Entity)) {
+	lo, hi := h.span(bounds)
+	h.visit(lo, hi, func(item *hashItem, c cell, inCell bool) {
+		if item.bounds.Overlaps(bounds) {
+			fn(item.entity)
+		}
+	})
+}
+
+// Frustum classifies blocks of cells against f, halving those partly
+// inside until they are single cells, so most cells are never looked up.
+func (h *Hash) Frustum(f *Frustum, fn func(e ecs.Entity)) {
+	if h.empty {
+		return
+	}
+	lo, hi := h.span(f.Bounds)
+	for k := range 3 {
+		lo[k], hi[k] = max(lo[k], h.lo[k]), min(hi[k], h.hi[k])
+		if lo[k] > hi[k] {
+			return
+		}
+	}
+	var seen map[int32]bool // items in several cells already reported or rejected
+	var walk func(lo, hi cell)
+	walk = func(lo, hi cell) {
+		where := f.classify(h.cellBounds(lo).Union(h.cellBounds(hi)))
+		if where == outside {
+			return
+		}
+		if where == intersecting && lo != hi {
+			axis := 0
+			for k := 1; k < 3; k++ {
+				if hi[k]-lo[k] > hi[axis]-lo[axis] {
+					axis = k
+				}
+			}
+			mid := lo[axis] + (hi[axis]-lo[axis])/2
+			lower, upper := hi, lo
+			lower[axis], upper[axis] = mid, mid+1
+			walk(lo, lower)
+			walk(upper, hi)
+			return
+		}
+		forSpan(lo, hi, func(c cell) {
+			for _, i := range h.cells[c] {
+				item := &h.items[i]
+				if item.lo != item.hi {
+					if seen[i] {
+						continue
+					}
+					if seen == nil {
+						seen = make(map[int32]bool)
+					}
+					seen[i] = true
+				}
+				if where == inside || f.classify(item.bounds) != outside {
+					fn(item.entity)
+				}
+			}
+		})
+	}
+	walk(lo, hi)
+}
+
+func (h *Hash) Ray(ray collision.Ray, maxDistance float32, fn func(e ecs.Entity, distance float32) float32) {
+	if h.empty {
+		return
+	}
+	s := newSlab(ray)
+	extent := h.cellBounds(h.lo).Union(h.cellBounds(h.hi))
+	t, ok := s.enter(extent, maxDistance)
+	if !ok {
+		return
+	}
+
+	// Walk the cells the ray passes through in order, as in Amanatides and
+	// Woo's "A Fast Voxel Traversal Algorithm".
+	c := h.cellOf(ray.At(t))
+	var step cell
+	var next, delta [3]float32 // distance to the next cell along each axis, and between cells
+	for k := range 3 {
+		c[k] = max(h.lo[k], min(c[k], h.hi[k]))
+		switch {
+		case ray.Dir[k] > 0:
+			step[k] = 1
+			next[k] = (float32(c[k]+1)*h.size - ray.Origin[k]) * s.inverse[k]
+			delta[k] = h.size * s.inverse[k]
+		case ray.Dir[k] < 0:
+			step[k] = -1
+			next[k] = (float32(c[k])*h.size - ray.Origin[k]) * s.inverse[k]
+			delta[k] = -h.size * s.inverse[k]
+		default:
+			next[k] = float32(math.Inf(1))
+		}
+	}
+
+	var seen map[int32]bool // items in several cells already tested
+	for t <= maxDistance {
+		for _, i := range h.cells[c] {
+			item := &h.items[i]
+			if item.lo != item.hi {
+				if seen[i] {
+					continue
+				}
+				if seen == nil {
+					seen = make(map[int32]bool)
+				}
+				seen[i] = true
+			}
+			if distance, ok := s.enter(item.bounds, maxDistance); ok {
+				if maxDistance = fn(item.entity, distance); maxDistance < 0 {
+					return
+				}
+			}
+		}
+		axis := 0
+		if next[1] < next[axis] {
+			axis = 1
+		}
+		if next[2] < next[axis] {
+			axis = 2
+		}
+		t = next[axis]
+		c[axis] += step[axis]
+		if c[axis] < h.lo[axis] || c[axis] > h.hi[axis] {
+			return
+		}
+		next[axis] += delta[axis]
+	}
+}
@@ -0,0 +1,189 @@
+// Package spatial indexes entities by their bounds, to find those within a
+// radius, a box or the view frustum, or hit by a ray, without scanning them
+// all.
+//
+// There are two indexes with the same methods: Hash, a uniform grid that
+// suits many entities of about the same size spread over a known area, and
+// BVH, a tree of boxes that suits entities of any size and layout. Queries
+// report the entities whose bounds match, in no particular order, and may be
+// run concurrently with each other but not with changes.
+package spatial
+
+import (
+	"go_wgpu/ecs"
+	"math"
+	"wgpu_server/collision"
+
+	"github.com/EngoEngine/glm"
+)
+
+// Index is implemented by Hash and BVH.
+type Index interface {
+	// Insert adds e with bounds, or updates it if it is already in.
+	Insert(e ecs.Entity, bounds collision.AABB)
+	// Update moves e to bounds. It does nothing if e is not in the index.
+	Update(e ecs.Entity, bounds collision.AABB)
+	// Remove removes e, reporting whether it was in the index.
+	Remove(e ecs.Entity) bool
+	Bounds(e ecs.Entity) (collision.AABB, bool)
+	Len() int
+
+	// Radius calls fn for every entity whose bounds are within radius of
+	// center.
+	Radius(center glm.Vec3, radius float32, fn func(e ecs.Entity))
+	// Box calls fn for every entity whose bounds overlap bounds.
+	Box(bounds collision.AABB, fn func(e ecs.Entity))
+	// Frustum calls fn for every entity whose bounds may be in f: some just
+	// outside its corners are reported too.
+	Frustum(f *Frustum, fn func(e ecs.Entity))
+	// Ray calls fn for every entity whose bounds ray enters within
+	// maxDistance, with the distance it enters at, as collision.RayCast
+	// measures it. fn returns the distance to keep looking within: its
+	// argument to find only the closest entity, maxDistance to find them
+	// all, or a negative number to stop.
+	Ray(ray collision.Ray, maxDistance float32, fn func(e ecs.Entity, distance float32) float32)
+}
+
+// Plane holds the points p with dot(Normal, p) + Distance = 0; those where
+// it is positive are in front of it.
+type Plane struct {
+	Normal   glm.Vec3
+	Distance float32
+}
+
+// Frustum is the volume a camera sees, as the six planes facing into it.
+type Frustum struct {
+	Planes [6]Plane
+	Bounds collision.AABB // of its corners
+}
+
+// NewFrustum returns the frustum of a view projection matrix whose clip
+// space, like that of glm.Perspective, spans -w to w on every axis.
+func NewFrustum(viewProjection glm.Mat4) Frustum {
+	m := viewProjection
+	row := func(i int) [4]float32 {
+		return [4]float32{m[i], m[4+i], m[8+i], m[12+i]}
+	}
+	w := row(3)
+	var f Frustum
+	for i := range 3 {
+		r := row(i)
+		for side, sign := range [2]float32{1, -1} {
+			n := glm.Vec3{w[0] + sign*r[0], w[1] + sign*r[1], w[2] + sign*r[2]}
+			d := w[3] + sign*r[3]
+			l := n.Len()
+			f.Planes[2*i+side] = Plane{n.Mul(1 / l), d / l}
+		}
+	}
+
+	inverse := m.Inverse()
+	f.Bounds = collision.AABB{
+		Min: glm.Vec3{float32(math.Inf(1)), float32(math.Inf(1)), float32(math.Inf(1))},
+		Max: glm.Vec3{float32(math.Inf(-1)), float32(math.Inf(-1)), float32(math.Inf(-1))},
+	}
+	for corner := range 8 {
+		clip := glm.Vec4{-1, -1, -1, 1}
+		for k := range 3 {
+			if corner&(1<<k) != 0 {
+				clip[k] = 1
+			}
+		}
+		p := inverse.Mul4x1(&clip)
+		point := glm.Vec3{p[0] / p[3], p[1] / p[3], p[2] / p[3]}
+		f.Bounds = f.Bounds.Union(collision.AABB{Min: point, Max: point})
+	}
+	return f
+}
+
+// containment is where a box is relative to a frustum.
+type containment int
+
+const (
+	outside containment = iota
+	intersecting
+	inside
+)
+
+// classify tells whether b is outside, inside or partly inside f. Boxes
+// near the corners of f may be classified intersecting though they are
+// outside.
+func (f *Frustum) classify(b collision.AABB) containment {
+	if !b.Overlaps(f.Bounds) {
+		return outside
+	}
+	result := inside
+	for i := range f.Planes {
+		p := &f.Planes[i]
+		// The corners of b furthest in front of and behind the plane.
+		front, back := p.Distance, p.Distance
+		for k := range 3 {
+			if p.Normal[k] >= 0 {
+				front += p.Normal[k] * b.Max[k]
+				back += p.Normal[k] * b.Min[k]
+			} else {
+				front += p.Normal[k] * b.Min[k]
+				back += p.Normal[k] * b.Max[k]
+			}
+		}
+		if front < 0 {
+			return outside
+		}
+		if back < 0 {
+			result = intersecting
+		}
+	}
+	return result
+}
+
+// withinRadius reports whether b has a point within radius of center.
+func withinRadius(b collision.AABB, center glm.Vec3, radius float32) bool {
+	var d2 float32
+	for k := range 3 {
+		if v := center[k]; v < b.Min[k] {
+			d2 += (b.Min[k] - v) * (b.Min[k] - v)
+		} else if v > b.Max[k] {
+			d2 += (v - b.Max[k]) * (v - b.Max[k])
+		}
+	}
+	return d2 <= radius*radius
+}
+
+// slab is a ray prepared for testing against many boxes.
+type slab struct {
+	origin  glm.Vec3
+	inverse glm.Vec3 // 1 / direction, infinite along axes it does not move on
+}
+
+func newSlab(ray collision.Ray) slab {
+	s := slab{origin: ray.Origin}
+	for k := range 3 {
+		s.inverse[k] = 1 / ray.Dir[k]
+	}
+	return s
+}
+
+// enter returns the distance at which the ray enters b, 0 if it starts in
+// it, and whether it does so within maxDistance.
+func (s *slab) enter(b collision.AABB, maxDistance float32) (float32, bool) {
+	near, far := float32(0), maxDistance
+	for k := range 3 {
+		t1 := (b.Min[k] - s.origin[k]) * s.inverse[k]
+		t2 := (b.Max[k] - s.origin[k]) * s.inverse[k]
+		if t1 != t1 || t2 != t2 {
+			// The ray runs along a face of b: it is in the slab if it
+			// starts in it.
+			if s.origin[k] < b.Min[k] || s.origin[k] > b.Max[k] {
+				return 0, false
+			}
+			continue
+		}
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		near, far = max(near, t1), min(far, t2)
+		if near > far {
+			return 0, false
+		}
+	}
+	return near, true
+}
@@ -0,0 +1,294 @@
+package spatial
+
+import (
+	"go_wgpu/ecs"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+	"wgpu_server/collision"
+
+	"github.com/EngoEngine/glm"
+)
+
+const extent = 200
+
+func randomPoint(r *rand.Rand) glm.Vec3 {
+	return glm.Vec3{(r.Float32() - 0.5) * extent, (r.Float32() - 0.5) * extent, (r.Float32() - 0.5) * extent}
+}
+
+func randomDirection(r *rand.Rand) glm.Vec3 {
+	for {
+		d := glm.Vec3{r.Float32()*2 - 1, r.Float32()*2 - 1, r.Float32()*2 - 1}
+		if l := d.Len(); l > 0.01 && l <= 1 {
+			return d.Mul(1 / l)
+		}
+	}
+}
+
+// randomBox returns a box mostly of the size of a few hash cells or less,
+// now and then much larger.
+func randomBox(r *rand.Rand) collision.AABB {
+	c := randomPoint(r)
+	var h glm.Vec3
+	for k := range 3 {
+		h[k] = 0.1 + r.Float32()*4
+	}
+	if r.Intn(20) == 0 {
+		h = h.Mul(10)
+	}
+	return collision.AABB{Min: c.Sub(&h), Max: c.Add(&h)}
+}
+
+// model is what the indexes should hold, checked by brute force.
+type model map[ecs.Entity]collision.AABB
+
+// entities returns the entities of m in order, so changes made while
+// walking them draw the same random numbers every run.
+func (m model) entities() []ecs.Entity {
+	return m.sorted(func(collision.AABB) bool { return true })
+}
+
+func (m model) sorted(keep func(b collision.AABB) bool) []ecs.Entity {
+	var found []ecs.Entity
+	for e, b := range m {
+		if keep(b) {
+			found = append(found, e)
+		}
+	}
+	slices.Sort(found)
+	return found
+}
+
+// collect returns what a query reports, sorted, failing the test if it
+// reports an entity twice.
+func collect(t *testing.T, name string, query func(fn func(e ecs.Entity))) []ecs.Entity {
+	t.Helper()
+	var found []ecs.Entity
+	query(func(e ecs.Entity) { found = append(found, e) })
+	slices.Sort(found)
+	for i := 1; i < len(found); i++ {
+		if found[i] == found[i-1] {
+			t.Fatalf("%s reported %v twice", name, found[i])
+		}
+	}
+	return found
+}
+
+// frontCorner returns how far the corner of b furthest in front of p is in
+// front of it.
+func frontCorner(p Plane, b collision.AABB) float32 {
+	d := p.Distance
+	for k := range 3 {
+		corner := b.Min[k]
+		if p.Normal[k] >= 0 {
+			corner = b.Max[k]
+		}
+		d += p.Normal[k] * corner
+	}
+	return d
+}
+
+func inFrustum(f *Frustum, p glm.Vec3) bool {
+	for _, plane := range f.Planes {
+		if plane.Normal.Dot(&p)+plane.Distance < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func randomFrustum(r *rand.Rand) Frustum {
+	eye := randomPoint(r)
+	direction := randomDirection(r)
+	target := eye.Add(&direction)
+	up := glm.Vec3{0, 1, 0}
+	view := glm.LookAtV(&eye, &target, &up)
+	projection := glm.Perspective(math.Pi/4, 16.0/9, 1, extent/2)
+	return NewFrustum(projection.Mul4(&view))
+}
+
+// check compares every kind of query on index against the model.
+func check(t *testing.T, name string, index Index, m model, r *rand.Rand) {
+	t.Helper()
+	if index.Len() != len(m) {
+		t.Fatalf("%s: Len %d, want %d", name, index.Len(), len(m))
+	}
+	for e, want := range m {
+		if got, ok := index.Bounds(e); !ok || got != want {
+			t.Fatalf("%s: bounds of %v are %v, %v, want %v", name, e, got, ok, want)
+		}
+	}
+
+	for range 100 {
+		box := randomBox(r)
+		pad := glm.Vec3{1, 1, 1}
+		pad = pad.Mul(r.Float32() * 10)
+		box.Min, box.Max = box.Min.Sub(&pad), box.Max.Add(&pad)
+		got := collect(t, name+" Box", func(fn func(e ecs.Entity)) { index.Box(box, fn) })
+		if want := m.sorted(box.Overlaps); !slices.Equal(got, want) {
+			t.Fatalf("%s: Box %v found %v, want %v", name, box, got, want)
+		}
+
+		center, radius := randomPoint(r), 1+r.Float32()*20
+		got = collect(t, name+" Radius", func(fn func(e ecs.Entity)) { index.Radius(center, radius, fn) })
+		want := m.sorted(func(b collision.AABB) bool { return withinRadius(b, center, radius) })
+		if !slices.Equal(got, want) {
+			t.Fatalf("%s: Radius %v %v found %v, want %v", name, center, radius, got, want)
+		}
+
+		// Frustum may report boxes just outside its corners, but never one
+		// that is behind a plane, and always those with a corner or their
+		// center inside.
+		f := randomFrustum(r)
+		got = collect(t, name+" Frustum", func(fn func(e ecs.Entity)) { index.Frustum(&f, fn) })
+		for _, e := range got {
+			for _, p := range f.Planes {
+				if frontCorner(p, m[e]) < 0 {
+					t.Fatalf("%s: Frustum reported %v, which is behind %v", name, m[e], p)
+				}
+			}
+		}
+		for _, e := range m.sorted(func(b collision.AABB) bool {
+			if inFrustum(&f, b.Center()) {
+				return true
+			}
+			for i := range 8 {
+				corner := b.Min
+				for k := range 3 {
+					if i&(1<<k) != 0 {
+						corner[k] = b.Max[k]
+					}
+				}
+				if inFrustum(&f, corner) {
+					return true
+				}
+			}
+			return false
+		}) {
+			if _, ok := slices.BinarySearch(got, e); !ok {
+				t.Fatalf("%s: Frustum missed %v at %v", name, e, m[e])
+			}
+		}
+
+		checkRay(t, name, index, m, collision.Ray{Origin: randomPoint(r), Dir: randomDirection(r)})
+	}
+}
+
+// checkRay compares every hit of ray, and the closest, with a cast against
+// every box.
+func checkRay(t *testing.T, name string, index Index, m model, ray collision.Ray) {
+	t.Helper()
+	const maxDistance = extent
+	want := make(map[ecs.Entity]float32)
+	closest, closestDistance := ecs.Nil, float32(maxDistance)
+	for e, b := range m {
+		if hit, ok := collision.RayCast(b, ray, maxDistance); ok {
+			want[e] = hit.Distance
+			if hit.Distance < closestDistance || hit.Distance == closestDistance && e < closest {
+				closest, closestDistance = e, hit.Distance
+			}
+		}
+	}
+	got := make(map[ecs.Entity]float32)
+	index.Ray(ray, maxDistance, func(e ecs.Entity, distance float32) float32 {
+		if _, ok := got[e]; ok {
+			t.Fatalf("%s: Ray reported %v twice", name, e)
+		}
+		got[e] = distance
+		return maxDistance
+	})
+	if len(got) != len(want) {
+		t.Fatalf("%s: Ray %v hit %d entities, want %d", name, ray, len(got), len(want))
+	}
+	for e, d := range want {
+		if g, ok := got[e]; !ok || math.Abs(float64(g-d)) > 1e-3 {
+			t.Fatalf("%s: Ray %v hit %v at %v, %v, want %v", name, ray, e, g, ok, d)
+		}
+	}
+
+	// Keeping only the closest finds the same one, up to ties.
+	found, foundDistance := ecs.Nil, float32(-1)
+	index.Ray(ray, maxDistance, func(e ecs.Entity, distance float32) float32 {
+		found, foundDistance = e, distance
+		return distance
+	})
+	if found != closest && math.Abs(float64(foundDistance-closestDistance)) > 1e-3 {
+		t.Fatalf("%s: closest hit of %v is %v at %v, want %v at %v", name, ray, found, foundDistance, closest, closestDistance)
+	}
+}
+
+func TestQueriesMatchBruteForce(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		index Index
+	}{
+		{"Hash", NewHash(16)},
+		{"BVH", NewBVH(0.5)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			index, m := test.index, model{}
+			next := ecs.Entity(1)
+			insert := func(count int) {
+				for range count {
+					b := randomBox(r)
+					index.Insert(next, b)
+					m[next] = b
+					next++
+				}
+			}
+
+			insert(2000)
+			check(t, "after Insert", index, m, r)
+
+			for _, e := range m.entities() {
+				b := m[e]
+				switch r.Intn(4) {
+				case 0:
+					// A frame's movement.
+					d := randomDirection(r)
+					d = d.Mul(0.1)
+					b = collision.AABB{Min: b.Min.Add(&d), Max: b.Max.Add(&d)}
+				case 1:
+					b = randomBox(r)
+				default:
+					continue
+				}
+				index.Update(e, b)
+				m[e] = b
+			}
+			index.Update(next+100, randomBox(r)) // not in the index
+			check(t, "after Update", index, m, r)
+
+			for _, e := range m.entities() {
+				if r.Intn(3) == 0 {
+					if !index.Remove(e) {
+						t.Fatalf("Remove of %v reported false", e)
+					}
+					delete(m, e)
+				}
+			}
+			if index.Remove(next + 100) {
+				t.Fatal("Remove of an entity not in the index reported true")
+			}
+			check(t, "after Remove", index, m, r)
+
+			// Inserting an entity already in the index moves it.
+			for _, e := range m.entities() {
+				if r.Intn(5) == 0 {
+					b := randomBox(r)
+					index.Insert(e, b)
+					m[e] = b
+				}
+			}
+			insert(500)
+			check(t, "after Insert again", index, m, r)
+
+			if bvh, ok := index.(*BVH); ok {
+				bvh.Rebuild()
+				check(t, "after Rebuild", index, m, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/EngoEngine/glm"
+)
+
+// transformJSON is how a Transform is written in scene files. Rotation is a
+// quaternion as x, y, z, w. The parent is stored by the scene, not here.
+type transformJSON struct {
+	Position glm.Vec3   `json:"position"`
+	Rotation [4]float32 `json:"rotation"`
+	Scale    glm.Vec3   `json:"scale"`
+}
+
+func (t Transform) MarshalJSON() ([]byte, error) {
+	r := t.rotation
+	return json.Marshal(transformJSON{
+		Position: t.position,
+		Rotation: [4]float32{r.V[0], r.V[1], r.V[2], r.W},
+		Scale:    t.scale,
+	})
+}
+
+// UnmarshalJSON reads a transform, leaving it unparented. Missing fields
+// default to those of New: the origin, no rotation and unit scale.
+func (t *Transform) UnmarshalJSON(data []byte) error {
+	v := transformJSON{Rotation: [4]float32{0, 0, 0, 1}, Scale: glm.Vec3{1, 1, 1}}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&v); err != nil {
+		return err
+	}
+	rotation := glm.Quat{W: v.Rotation[3], V: glm.Vec3{v.Rotation[0], v.Rotation[1], v.Rotation[2]}}
+	if rotation.Len() == 0 {
+		return errors.New("zero rotation")
+	}
+	*t = New(v.Position, rotation.Normalized())
+	t.scale = v.Scale
+	return nil
+}
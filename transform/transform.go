@@ -0,0 +1,263 @@
+// Package transform gives entities a position, rotation and scale relative
+// to a parent entity, and keeps their world matrices up to date.
+//
+// Transforms are ECS components. Setters mark a transform dirty, and Update
+// recomputes the world matrix of every dirty transform and of everything
+// attached below it, parents before children.
+package transform
+
+import (
+	"go_wgpu/ecs"
+	"go_wgpu/jobs"
+	"slices"
+
+	"github.com/EngoEngine/glm"
+)
+
+// Transform is an entity's pose relative to its parent, or to the world if it
+// has none. The zero value has zero scale; use New.
+type Transform struct {
+	position glm.Vec3
+	rotation glm.Quat
+	scale    glm.Vec3
+
+	parent   ecs.Entity
+	children []ecs.Entity
+	dirty    bool
+	world    glm.Mat4 // as of the last Update
+}
+
+// New returns an unparented transform with unit scale.
+func New(position glm.Vec3, rotation glm.Quat) Transform {
+	return Transform{
+		position: position,
+		rotation: rotation,
+		scale:    glm.Vec3{1, 1, 1},
+		dirty:    true,
+		world:    glm.Ident4(),
+	}
+}
+
+func (t *Transform) Position() glm.Vec3 {
+	return t.position
+}
+
+func (t *Transform) SetPosition(position glm.Vec3) {
+	t.position = position
+	t.dirty = true
+}
+
+func (t *Transform) Rotation() glm.Quat {
+	return t.rotation
+}
+
+func (t *Transform) SetRotation(rotation glm.Quat) {
+	t.rotation = rotation
+	t.dirty = true
+}
+
+func (t *Transform) Scale() glm.Vec3 {
+	return t.scale
+}
+
+func (t *Transform) SetScale(scale glm.Vec3) {
+	t.scale = scale
+	t.dirty = true
+}
+
+// Translate moves the transform by v along its own axes.
+func (t *Transform) Translate(v glm.Vec3) {
+	v = t.rotation.Rotate(&v)
+	t.position = t.position.Add(&v)
+	t.dirty = true
+}
+
+// Rotate turns the transform by rotation about its own axes.
+func (t *Transform) Rotate(rotation glm.Quat) {
+	t.rotation = t.rotation.Mul(&rotation)
+	t.rotation.Normalize()
+	t.dirty = true
+}
+
+// LookAt turns the transform so that its forward axis, -Z, points at target
+// and its Y axis is as close to up as possible. Both are in the parent's
+// space. Nothing changes if target is the transform's position.
+func (t *Transform) LookAt(target, up glm.Vec3) {
+	forward := target.Sub(&t.position)
+	if forward.Len2() == 0 {
+		return
+	}
+	forward = forward.Normalized()
+	right := forward.Cross(&up)
+	if right.Len2() < 1e-12 {
+		// up is parallel to forward; any perpendicular will do
+		other := glm.Vec3{1, 0, 0}
+		if forward[0]*forward[0] > 0.5 {
+			other = glm.Vec3{0, 0, 1}
+		}
+		right = forward.Cross(&other)
+	}
+	right = right.Normalized()
+	up = right.Cross(&forward)
+	basis := glm.Mat4{
+		right[0], right[1], right[2], 0,
+		up[0], up[1], up[2], 0,
+		-forward[0], -forward[1], -forward[2], 0,
+		0, 0, 0, 1,
+	}
+	t.rotation = glm.Mat4ToQuat(&basis)
+	t.rotation.Normalize()
+	t.dirty = true
+}
+
+// Local returns the transform's matrix relative to its parent.
+func (t *Transform) Local() glm.Mat4 {
+	m := t.rotation.Mat4()
+	for column := range 3 {
+		for row := range 3 {
+			m[column*4+row] *= t.scale[column]
+		}
+	}
+	m[12], m[13], m[14] = t.position[0], t.position[1], t.position[2]
+	return m
+}
+
+// World returns the transform's world matrix as of the last Update.
+func (t *Transform) World() glm.Mat4 {
+	return t.world
+}
+
+// WorldPosition returns the transform's position in the world as of the last
+// Update.
+func (t *Transform) WorldPosition() glm.Vec3 {
+	return glm.Vec3{t.world[12], t.world[13], t.world[14]}
+}
+
+// Parent returns the entity the transform is attached to, or ecs.Nil.
+func (t *Transform) Parent() ecs.Entity {
+	return t.parent
+}
+
+// Children returns the entities attached to the transform. The slice must not
+// be modified.
+func (t *Transform) Children() []ecs.Entity {
+	return t.children
+}
+
+// SetParent attaches child to parent, keeping its local pose, or detaches it
+// if parent is ecs.Nil. Both must have a Transform. It panics if parent is
+// child or one of its descendants.
+func SetParent(w *ecs.World, child, parent ecs.Entity) {
+	transforms := ecs.Components[Transform](w)
+	t := transforms.Get(child)
+	if t == nil {
+		panic("transform: SetParent of an entity without a Transform")
+	}
+	if t.parent == parent {
+		return
+	}
+	if parent != ecs.Nil {
+		p := transforms.Get(parent)
+		if p == nil {
+			panic("transform: SetParent to an entity without a Transform")
+		}
+		for ancestor := parent; ancestor != ecs.Nil; {
+			if ancestor == child {
+				panic("transform: SetParent would make a cycle")
+			}
+			a := transforms.Get(ancestor)
+			if a == nil {
+				break
+			}
+			ancestor = a.parent
+		}
+		p.children = append(p.children, child)
+	}
+	if old := transforms.Get(t.parent); old != nil {
+		old.removeChild(child)
+	}
+	t.parent = parent
+	t.dirty = true
+}
+
+func (t *Transform) removeChild(child ecs.Entity) {
+	for i, c := range t.children {
+		if c == child {
+			t.children = append(t.children[:i], t.children[i+1:]...)
+			return
+		}
+	}
+}
+
+// Despawn despawns e and every entity attached below it. Despawning e
+// through the ecs.World instead leaves its children behind, to be detached
+// by the next Update.
+func Despawn(w *ecs.World, e ecs.Entity) {
+	transforms := ecs.Components[Transform](w)
+	if t := transforms.Get(e); t != nil {
+		if parent := transforms.Get(t.parent); parent != nil {
+			parent.removeChild(e)
+		}
+		despawn(w, transforms, e)
+		return
+	}
+	w.Despawn(e)
+}
+
+func despawn(w *ecs.World, transforms *ecs.Storage[Transform], e ecs.Entity) {
+	if t := transforms.Get(e); t != nil {
+		for _, child := range t.children {
+			despawn(w, transforms, child)
+		}
+	}
+	w.Despawn(e)
+}
+
+// updateGrain is how many transforms each parallel chunk of Update looks at.
+const updateGrain = 4096
+
+// Update recomputes the world matrices of dirty transforms and their
+// descendants. Hierarchies are updated in parallel on pool, each from its
+// root down. A transform whose parent was despawned, or lost its Transform,
+// is detached and becomes a root, its local pose now relative to the world.
+func Update(w *ecs.World, pool *jobs.Pool) {
+	transforms := ecs.Components[Transform](w)
+	data := transforms.Data()
+	pool.ParallelFor(len(data), updateGrain, func(start, end int) {
+		for i := start; i < end; i++ {
+			t := &data[i]
+			if t.parent != ecs.Nil {
+				if transforms.Get(t.parent) != nil {
+					continue
+				}
+				t.parent, t.dirty = ecs.Nil, true
+			}
+			t.update(transforms, nil, false)
+		}
+	})
+}
+
+func (t *Transform) update(transforms *ecs.Storage[Transform], parent *glm.Mat4, parentChanged bool) {
+	changed := t.dirty || parentChanged
+	if changed {
+		t.world = t.Local()
+		if parent != nil {
+			t.world = parent.Mul4(&t.world)
+		}
+		t.dirty = false
+	}
+	stale := false
+	for _, child := range t.children {
+		if c := transforms.Get(child); c != nil {
+			c.update(transforms, &t.world, changed)
+		} else {
+			stale = true
+		}
+	}
+	if stale {
+		// Children despawned without Despawn.
+		t.children = slices.DeleteFunc(t.children, func(child ecs.Entity) bool {
+			return transforms.Get(child) == nil
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package transform
+
+import (
+	"go_wgpu/ecs"
+	"go_wgpu/jobs"
+	"math"
+	"testing"
+
+	"github.com/EngoEngine/glm"
+)
+
+var pool = jobs.NewPool(4)
+
+func spawn(w *ecs.World, position glm.Vec3) ecs.Entity {
+	e := w.Spawn()
+	ecs.Add(w, e, New(position, glm.QuatIdent()))
+	return e
+}
+
+func get(w *ecs.World, e ecs.Entity) *Transform {
+	return ecs.Get[Transform](w, e)
+}
+
+func near(a, b glm.Vec3) bool {
+	d := a.Sub(&b)
+	return d.Len() < 1e-5
+}
+
+// panics reports whether fn panics.
+func panics(fn func()) (panicked bool) {
+	defer func() { panicked = recover() != nil }()
+	fn()
+	return false
+}
+
+func TestSetParentCycle(t *testing.T) {
+	w := ecs.NewWorld()
+	a, b, c := spawn(w, glm.Vec3{}), spawn(w, glm.Vec3{}), spawn(w, glm.Vec3{})
+	SetParent(w, b, a)
+	SetParent(w, c, b)
+	for _, test := range []struct {
+		name          string
+		child, parent ecs.Entity
+	}{
+		{"itself", a, a},
+		{"its child", a, b},
+		{"its grandchild", a, c},
+	} {
+		if !panics(func() { SetParent(w, test.child, test.parent) }) {
+			t.Errorf("parenting an entity to %s did not panic", test.name)
+		}
+	}
+	if get(w, a).Parent() != ecs.Nil || len(get(w, a).Children()) != 1 {
+		t.Error("a refused SetParent changed the hierarchy")
+	}
+	if !panics(func() { SetParent(w, a, w.Spawn()) }) {
+		t.Error("parenting to an entity without a Transform did not panic")
+	}
+
+	// Reparenting moves the child between parents' lists.
+	SetParent(w, c, a)
+	if len(get(w, b).Children()) != 0 || len(get(w, a).Children()) != 2 || get(w, c).Parent() != a {
+		t.Errorf("after reparenting, b has %v and a has %v", get(w, b).Children(), get(w, a).Children())
+	}
+	SetParent(w, c, ecs.Nil)
+	if get(w, c).Parent() != ecs.Nil || len(get(w, a).Children()) != 1 {
+		t.Error("detaching left c attached")
+	}
+}
+
+func TestUpdatePropagates(t *testing.T) {
+	w := ecs.NewWorld()
+	root, child, grandchild := spawn(w, glm.Vec3{1, 0, 0}), spawn(w, glm.Vec3{0, 2, 0}), spawn(w, glm.Vec3{0, 0, 3})
+	SetParent(w, child, root)
+	SetParent(w, grandchild, child)
+	Update(w, pool)
+	if p := get(w, grandchild).WorldPosition(); !near(p, glm.Vec3{1, 2, 3}) {
+		t.Fatalf("grandchild at %v, want [1 2 3]", p)
+	}
+
+	// Moving the root moves everything below it, though only the root is
+	// dirty.
+	get(w, root).SetPosition(glm.Vec3{10, 0, 0})
+	get(w, root).SetRotation(glm.QuatRotate(math.Pi/2, &glm.Vec3{0, 1, 0}))
+	Update(w, pool)
+	if p := get(w, child).WorldPosition(); !near(p, glm.Vec3{10, 2, 0}) {
+		t.Errorf("child at %v, want [10 2 0]", p)
+	}
+	if p := get(w, grandchild).WorldPosition(); !near(p, glm.Vec3{13, 2, 0}) {
+		t.Errorf("grandchild at %v, want [13 2 0]", p)
+	}
+
+	// Moving a child leaves its parent alone.
+	get(w, child).SetScale(glm.Vec3{2, 2, 2})
+	Update(w, pool)
+	if p := get(w, root).WorldPosition(); !near(p, glm.Vec3{10, 0, 0}) {
+		t.Errorf("root moved to %v with its child", p)
+	}
+	if p := get(w, grandchild).WorldPosition(); !near(p, glm.Vec3{16, 2, 0}) {
+		t.Errorf("grandchild at %v after scaling its parent, want [16 2 0]", p)
+	}
+}
+
+func TestUpdateParallelRoots(t *testing.T) {
+	// Enough roots for Update to split them across the pool, each with a
+	// chain of children spawned before and after it.
+	w := ecs.NewWorld()
+	const roots = 3 * updateGrain
+	var leaves []ecs.Entity
+	for i := range roots {
+		first := spawn(w, glm.Vec3{0, 1, 0})
+		root := spawn(w, glm.Vec3{float32(i), 0, 0})
+		SetParent(w, first, root)
+		second := spawn(w, glm.Vec3{0, 0, 1})
+		SetParent(w, second, first)
+		leaves = append(leaves, second)
+	}
+	Update(w, pool)
+	for i, leaf := range leaves {
+		if p := get(w, leaf).WorldPosition(); !near(p, glm.Vec3{float32(i), 1, 1}) {
+			t.Fatalf("leaf %d at %v", i, p)
+		}
+	}
+}
+
+func TestLookAt(t *testing.T) {
+	for _, test := range []struct {
+		target, up glm.Vec3
+	}{
+		{glm.Vec3{0, 0, -5}, glm.Vec3{0, 1, 0}},
+		{glm.Vec3{5, 0, 0}, glm.Vec3{0, 1, 0}},
+		{glm.Vec3{1, 2, 3}, glm.Vec3{0, 1, 0}},
+		// up parallel to the direction looked in.
+		{glm.Vec3{0, 5, 0}, glm.Vec3{0, 1, 0}},
+		{glm.Vec3{-3, 0, 0}, glm.Vec3{1, 0, 0}},
+	} {
+		tr := New(glm.Vec3{}, glm.QuatIdent())
+		tr.LookAt(test.target, test.up)
+		rotation := tr.Rotation()
+		forward := rotation.Rotate(&glm.Vec3{0, 0, -1})
+		want := test.target.Normalized()
+		if !near(forward, want) {
+			t.Errorf("looking at %v, forward is %v", test.target, forward)
+		}
+		up := rotation.Rotate(&glm.Vec3{0, 1, 0})
+		if math.Abs(float64(up.Dot(&forward))) > 1e-5 {
+			t.Errorf("looking at %v, up %v is not perpendicular to forward", test.target, up)
+		}
+		if right := forward.Cross(&test.up); right.Len() > 1e-5 && up.Dot(&test.up) <= 0 {
+			t.Errorf("looking at %v, up %v points away from %v", test.target, up, test.up)
+		}
+	}
+
+	tr := New(glm.Vec3{1, 1, 1}, glm.QuatIdent())
+	tr.LookAt(glm.Vec3{1, 1, 1}, glm.Vec3{0, 1, 0})
+	if tr.Rotation() != glm.QuatIdent() {
+		t.Errorf("looking at its own position turned it to %v", tr.Rotation())
+	}
+}
+
+func TestDespawnSubtree(t *testing.T) {
+	w := ecs.NewWorld()
+	root, a, b := spawn(w, glm.Vec3{}), spawn(w, glm.Vec3{}), spawn(w, glm.Vec3{})
+	aa, ab := spawn(w, glm.Vec3{}), spawn(w, glm.Vec3{})
+	SetParent(w, a, root)
+	SetParent(w, b, root)
+	SetParent(w, aa, a)
+	SetParent(w, ab, a)
+
+	Despawn(w, a)
+	for _, e := range []ecs.Entity{a, aa, ab} {
+		if w.Alive(e) {
+			t.Errorf("%v is alive after despawning its subtree", e)
+		}
+	}
+	if !w.Alive(root) || !w.Alive(b) {
+		t.Error("Despawn took the parent or a sibling with it")
+	}
+	if children := get(w, root).Children(); len(children) != 1 || children[0] != b {
+		t.Errorf("root's children are %v, want [%v]", children, b)
+	}
+}
+
+func TestWorldDespawnDetachesChildren(t *testing.T) {
+	w := ecs.NewWorld()
+	root, parent := spawn(w, glm.Vec3{100, 0, 0}), spawn(w, glm.Vec3{10, 0, 0})
+	child, sibling := spawn(w, glm.Vec3{1, 0, 0}), spawn(w, glm.Vec3{0, 1, 0})
+	SetParent(w, parent, root)
+	SetParent(w, sibling, root)
+	SetParent(w, child, parent)
+	Update(w, pool)
+
+	// Despawned through the world rather than Despawn: the child is left
+	// with a parent that no longer exists, and the root with a stale child.
+	w.Despawn(parent)
+	reused := spawn(w, glm.Vec3{}) // may take the despawned index
+	Update(w, pool)
+	c := get(w, child)
+	if c.Parent() != ecs.Nil {
+		t.Errorf("child still has parent %v", c.Parent())
+	}
+	if p := c.WorldPosition(); !near(p, glm.Vec3{1, 0, 0}) {
+		t.Errorf("detached child at %v, want its local position", p)
+	}
+	if children := get(w, root).Children(); len(children) != 1 || children[0] != sibling {
+		t.Errorf("root's children are %v, want [%v]", children, sibling)
+	}
+	if get(w, reused).Parent() != ecs.Nil || len(get(w, reused).Children()) != 0 {
+		t.Error("the entity reusing the index inherited the hierarchy")
+	}
+}